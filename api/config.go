@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/grafana/metrictank/expr"
 	"github.com/raintank/dur"
 	"github.com/raintank/worldping-api/pkg/log"
 	"github.com/rakyll/globalconf"
@@ -25,7 +26,12 @@ var (
 	keyFile          string
 	multiTenant      bool
 	fallbackGraphite string
+	partialExecution bool
 	timeZoneStr      string
+	macrosFile       string
+	macrosReloadStr  string
+
+	prometheusReadMaxSize int
 
 	graphiteProxy *httputil.ReverseProxy
 	timeZone      *time.Location
@@ -44,7 +50,11 @@ func ConfigSetup() {
 	apiCfg.StringVar(&keyFile, "key-file", "", "SSL key file")
 	apiCfg.BoolVar(&multiTenant, "multi-tenant", true, "require x-org-id authentication to auth as a specific org. otherwise orgId 1 is assumed")
 	apiCfg.StringVar(&fallbackGraphite, "fallback-graphite-addr", "http://localhost:8080", "in case our /render endpoint does not support the requested processing, proxy the request to this graphite")
+	apiCfg.BoolVar(&partialExecution, "partial-execution", false, "when proxying a request to graphite, execute the parts of it that we support ourselves and have graphite fetch their output from us. requires the fallback graphite to query this instance")
 	apiCfg.StringVar(&timeZoneStr, "time-zone", "local", "timezone for interpreting from/until values when needed, specified using [zoneinfo name](https://en.wikipedia.org/wiki/Tz_database#Names_of_time_zones) e.g. 'America/New_York', 'UTC' or 'local' to use local server timezone")
+	apiCfg.StringVar(&macrosFile, "macros-file", "", "path to a file with macro definitions, which can be used as functions in render requests. empty to disable")
+	apiCfg.StringVar(&macrosReloadStr, "macros-reload-interval", "10s", "how often to check the macros-file for changes, and reload it if it changed. 0 to disable")
+	apiCfg.IntVar(&prometheusReadMaxSize, "prometheus-read-max-size", 1024*1024, "maximum size in bytes of a prometheus remote read request, after decompression. larger requests are rejected")
 	globalconf.Register("http", apiCfg)
 }
 
@@ -63,6 +73,10 @@ func ConfigProcess() {
 	}
 	graphiteProxy = NewGraphiteProxy(u)
 
+	if prometheusReadMaxSize <= 0 {
+		log.Fatal(4, "API prometheus-read-max-size must be positive")
+	}
+
 	if timeZoneStr == "local" {
 		timeZone = time.Local
 	} else {
@@ -71,4 +85,16 @@ func ConfigProcess() {
 			log.Fatal(4, "API Cannot load timezone %q: %s", timeZoneStr, err)
 		}
 	}
+
+	if macrosFile != "" {
+		macros, err := expr.ReadMacros(macrosFile)
+		if err != nil {
+			log.Fatal(4, "API Cannot read macros-file %q: %s", macrosFile, err)
+		}
+		expr.SetMacros(macros)
+		macrosReload := dur.MustParseDuration("macros-reload-interval", macrosReloadStr)
+		if macrosReload != 0 {
+			go reloadMacros(macrosFile, time.Duration(macrosReload)*time.Second)
+		}
+	}
 }
@@ -236,7 +236,7 @@ func (s *Server) getTargetsLocal(ctx context.Context, reqs []models.Req) ([]mode
 				errorsChan <- err
 			} else {
 				getTargetDuration.Value(time.Now().Sub(pre))
-				seriesChan <- models.Series{
+				serie := models.Series{
 					Target:       req.Target, // always simply the metric name from index
 					Datapoints:   points,
 					Interval:     interval,
@@ -246,6 +246,8 @@ func (s *Server) getTargetsLocal(ctx context.Context, reqs []models.Req) ([]mode
 					QueryCons:    req.ConsReq,
 					Consolidator: req.Consolidator,
 				}
+				serie.SetTags()
+				seriesChan <- serie
 			}
 			wg.Done()
 		}(ctx, &wg, req)
@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"errors"
-	"math"
 	"net/http"
 	"strings"
 	"sync"
@@ -21,11 +20,11 @@ import (
 	"github.com/grafana/metrictank/mdata"
 	"github.com/grafana/metrictank/stats"
 	"github.com/grafana/metrictank/tracing"
-	"github.com/grafana/metrictank/util"
 	opentracing "github.com/opentracing/opentracing-go"
 	tags "github.com/opentracing/opentracing-go/ext"
 	"github.com/raintank/dur"
 	"github.com/raintank/worldping-api/pkg/log"
+	"gopkg.in/raintank/schema.v1"
 )
 
 var MissingOrgHeaderErr = errors.New("orgId not set in headers")
@@ -44,6 +43,9 @@ var (
 
 	// metric plan.run is the time spent running the plan for a request (function processing of all targets and runtime consolidation)
 	planRunDuration = stats.NewLatencyHistogram15s32("plan.run")
+
+	// metric api.request.render.dedup_ratio is the percentage of the function calls and series requests of a /render request that are identical to others in the request, and thus only computed or fetched once
+	reqRenderDedupRatio = stats.NewMeter32("api.request.render.dedup_ratio", false)
 )
 
 type Series struct {
@@ -192,9 +194,9 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 	fromUnix += 1
 	toUnix += 1
 
-	exprs, err := expr.ParseMany(request.Targets)
+	exprs, err := expr.ParseManyTemplate(request.Targets, templateVars(ctx.Req.Request))
 	if err != nil {
-		ctx.Error(http.StatusBadRequest, err.Error())
+		response.Write(ctx, newTargetError(err))
 		return
 	}
 
@@ -202,7 +204,7 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 
 	if request.Process == "none" {
 		ctx.Req.Request.Body = ctx.Body
-		graphiteProxy.ServeHTTP(ctx.Resp, ctx.Req.Request)
+		graphiteProxy.ServeHTTP(ctx.Resp, macroProxyRequest(ctx.Req.Request, expr.ExpandedTargets(exprs)))
 		renderReqProxied.Inc()
 		return
 	}
@@ -214,7 +216,9 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 		// as graphite needs high-res data to perform its processing.
 		mdp = 0
 	}
-	plan, err := expr.NewPlan(exprs, fromUnix, toUnix, mdp, stable, nil)
+	// getFromTo already validated the timezone
+	loc, _ := getLocation(request.FromTo.Tz)
+	plan, err := expr.NewPlan(exprs, fromUnix, toUnix, mdp, stable, loc, nil)
 	if err != nil {
 		if fun, ok := err.(expr.ErrUnknownFunction); ok {
 			if request.NoProxy {
@@ -226,7 +230,28 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 			tags.PeerService.Set(span, "graphite")
 			ctx.Req = macaron.Request{ctx.Req.WithContext(newctx)}
 			ctx.Req.Request.Body = ctx.Body
-			graphiteProxy.ServeHTTP(ctx.Resp, ctx.Req.Request)
+			proxyReq := macroProxyRequest(ctx.Req.Request, expr.ExpandedTargets(exprs))
+			// json bodies can't be rewritten, as we don't know all the parameters graphite may use
+			if partialExecution && !strings.Contains(ctx.Req.Header.Get("Content-Type"), "json") {
+				token := newPartialToken()
+				partial := expr.NewPartial(exprs, fromUnix, toUnix, stable, loc, partialPlaceholder(token))
+				if partial.Len() != 0 {
+					partials.add(token, &partialEntry{
+						orgId:   ctx.OrgId,
+						from:    fromUnix,
+						to:      toUnix,
+						stable:  stable,
+						loc:     loc,
+						partial: partial,
+						results: make(map[partialResultKey][]models.Series),
+					})
+					defer partials.del(token)
+					span.SetTag("partial", partial.Targets)
+					proxyReq = targetsProxyRequest(proxyReq, partial.Targets)
+					renderReqPartial.Inc()
+				}
+			}
+			graphiteProxy.ServeHTTP(ctx.Resp, proxyReq)
 			if span != nil {
 				span.Finish()
 			}
@@ -234,9 +259,14 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 			renderReqProxied.Inc()
 			return
 		}
-		ctx.Error(http.StatusBadRequest, err.Error())
+		response.Write(ctx, newTargetError(err))
 		return
 	}
+	if plan.Nodes != 0 {
+		reqRenderDedupRatio.Value(plan.Deduped * 100 / plan.Nodes)
+	}
+	// the output of the plan is backed by pooled buffers, which are only returned once the response has been written
+	defer plan.Clean()
 
 	newctx, span := tracing.NewSpan(ctx.Req.Context(), s.Tracer, "executePlan")
 	defer span.Finish()
@@ -267,7 +297,31 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 	default:
 		response.Write(ctx, response.NewFastJson(200, models.SeriesByTarget(out)))
 	}
-	plan.Clean()
+}
+
+// templateVars returns the variables for template() that are given as template[<name>]=<value> request parameters
+func templateVars(r *http.Request) map[string]string {
+	r.ParseForm()
+	var vars map[string]string
+	for key, values := range r.Form {
+		if len(values) == 0 || !strings.HasPrefix(key, "template[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[key[len("template["):len(key)-1]] = values[0]
+	}
+	return vars
+}
+
+// newTargetError returns the response for an invalid target.
+// errors in a target are described in json, such that clients can point out where the problem is.
+func newTargetError(err error) response.Response {
+	if e, ok := err.(expr.ErrTarget); ok {
+		return response.NewJson(http.StatusBadRequest, e, "")
+	}
+	return response.NewError(http.StatusBadRequest, err.Error())
 }
 
 func (s *Server) metricsFind(ctx *middleware.Context, request models.GraphiteFind) {
@@ -279,6 +333,20 @@ func (s *Server) metricsFind(ctx *middleware.Context, request models.GraphiteFin
 		return
 	}
 	nodes := make([]idx.Node, 0)
+	if isPartialQuery(request.Query) {
+		// like the render api, from is exclusive and to is inclusive
+		if fromUnix != 0 && toUnix != 0 {
+			fromUnix += 1
+			toUnix += 1
+		}
+		nodes, err = s.findPartial(ctx.Req.Context(), ctx.OrgId, request.Query, fromUnix, toUnix)
+		if err != nil {
+			response.Write(ctx, response.WrapError(err))
+			return
+		}
+		writeFind(ctx, request, nodes, fromUnix, toUnix)
+		return
+	}
 	series, err := s.findSeries(ctx.Req.Context(), ctx.OrgId, []string{request.Query}, int64(fromUnix))
 	if err != nil {
 		response.Write(ctx, response.WrapError(err))
@@ -299,6 +367,10 @@ func (s *Server) metricsFind(ctx *middleware.Context, request models.GraphiteFin
 		}
 	}
 
+	writeFind(ctx, request, nodes, fromUnix, toUnix)
+}
+
+func writeFind(ctx *middleware.Context, request models.GraphiteFind, nodes []idx.Node, fromUnix, toUnix uint32) {
 	switch request.Format {
 	case "", "treejson", "json":
 		response.Write(ctx, response.NewJson(200, findTreejson(request.Query, nodes), request.Jsonp))
@@ -555,27 +627,32 @@ func (s *Server) metricsDeleteRemote(ctx context.Context, orgId int, query strin
 	return resp.DeletedDefs, nil
 }
 
-// executePlan looks up the needed data, retrieves it, and then invokes the processing
-// note if you do something like sum(foo.*) and all of those metrics happen to be on another node,
-// we will collect all the indidividual series from the peer, and then sum here. that could be optimized
-func (s *Server) executePlan(ctx context.Context, orgId int, plan expr.Plan) ([]models.Series, error) {
+// planFetch describes how the data needed by a plan is obtained
+type planFetch struct {
+	reqs         []models.Req // requests for the series that the plan requests resolved to, with their archive chosen
+	planReqs     []expr.Req   // the plan request that each of reqs is for
+	pointsFetch  uint32
+	pointsReturn uint32
+}
 
-	minFrom := uint32(math.MaxUint32)
-	var maxTo uint32
-	var reqs []models.Req
+// resolvePlan looks up the series needed by the plan, and decides which archive to fetch each of them from
+func (s *Server) resolvePlan(ctx context.Context, orgId int, plan expr.Plan) (planFetch, error) {
+	var fetch planFetch
 
 	// note that different patterns to query can have different from / to, so they require different index lookups
 	// e.g. target=movingAvg(foo.*, "1h")&target=foo.*
 	// note that in this case we fetch foo.* twice. can be optimized later
 	for _, r := range plan.Reqs {
-		series, err := s.findSeries(ctx, orgId, []string{r.Query}, int64(r.From))
+		if isPartialQuery(r.Query) {
+			// the output of a partially executed request, which graphite fetches back from us.
+			// it is not fetched but computed, which executePlan takes care of
+			continue
+		}
+		series, err := s.resolveReq(ctx, orgId, plan, r)
 		if err != nil {
-			return nil, err
+			return fetch, err
 		}
 
-		minFrom = util.Min(minFrom, r.From)
-		maxTo = util.Max(maxTo, r.To)
-
 		for _, s := range series {
 			for _, metric := range s.Series {
 				for _, archive := range metric.Defs {
@@ -594,23 +671,73 @@ func (s *Server) executePlan(ctx context.Context, orgId int, plan expr.Plan) ([]
 
 					newReq := models.NewReq(
 						archive.Id, archive.NameWithTags(), r.Query, r.From, r.To, plan.MaxDataPoints, uint32(archive.Interval), cons, consReq, s.Node, archive.SchemaId, archive.AggId)
-					reqs = append(reqs, newReq)
+					newReq.PrePoints = r.PrePoints
+					fetch.reqs = append(fetch.reqs, newReq)
+					fetch.planReqs = append(fetch.planReqs, r)
 				}
 			}
 		}
 	}
-
-	reqRenderSeriesCount.Value(len(reqs))
-	if len(reqs) == 0 {
-		return nil, nil
+	if len(fetch.reqs) == 0 {
+		return fetch, nil
 	}
 
 	// note: if 1 series has a movingAvg that requires a long time range extension, it may push other reqs into another archive. can be optimized later
-	reqs, pointsFetch, pointsReturn, err := alignRequests(uint32(time.Now().Unix()), minFrom, maxTo, reqs)
+	var err error
+	fetch.reqs, fetch.pointsFetch, fetch.pointsReturn, err = alignRequests(uint32(time.Now().Unix()), fetch.reqs)
 	if err != nil {
 		log.Error(3, "HTTP Render alignReq error: %s", err)
+		return fetch, err
+	}
+	return fetch, nil
+}
+
+// executePlan looks up the needed data, retrieves it, and then invokes the processing
+// note if you do something like sum(foo.*) and all of those metrics happen to be on another node,
+// we will collect all the indidividual series from the peer, and then sum here. that could be optimized
+func (s *Server) executePlan(ctx context.Context, orgId int, plan expr.Plan) ([]models.Series, error) {
+	fetch, err := s.resolvePlan(ctx, orgId, plan)
+	if err != nil {
 		return nil, err
 	}
+	reqs, planReqs := fetch.reqs, fetch.planReqs
+	pointsFetch, pointsReturn := fetch.pointsFetch, fetch.pointsReturn
+
+	data := make(map[expr.Req][]models.Series)
+	for _, r := range plan.Reqs {
+		if !isPartialQuery(r.Query) {
+			continue
+		}
+		// the output of a partially executed request, which graphite fetches back from us
+		series, _, err := s.partialSeries(ctx, orgId, r.Query, r.From, r.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, serie := range series {
+			serie.QueryPatt = r.Query
+			serie.Datapoints = append(pointSlicePool.Get().([]schema.Point), serie.Datapoints...)
+			data[r] = append(data[r], serie)
+		}
+	}
+
+	reqRenderSeriesCount.Value(len(reqs))
+	if len(reqs) == 0 {
+		if len(data) != 0 {
+			return plan.Run(data)
+		}
+		return nil, nil
+	}
+
+	// we track which plan requests the fetched data corresponds to.
+	// note that multiple plan requests may result in the same fetch
+	planReqsByFetch := make(map[expr.Req][]expr.Req)
+	for i := range reqs {
+		fetch := expr.NewReq(planReqs[i].Query, reqs[i].From, planReqs[i].To, planReqs[i].Cons)
+		if !containsReq(planReqsByFetch[fetch], planReqs[i]) {
+			planReqsByFetch[fetch] = append(planReqsByFetch[fetch], planReqs[i])
+		}
+	}
+
 	span := opentracing.SpanFromContext(ctx)
 	span.SetTag("points_fetch", pointsFetch)
 	span.SetTag("points_return", pointsReturn)
@@ -631,10 +758,16 @@ func (s *Server) executePlan(ctx context.Context, orgId int, plan expr.Plan) ([]
 	// instead of waiting for all data to come in and then start processing everything, we could consider starting processing earlier, at the risk of doing needless work
 	// if we need to cancel the request due to a fetch error
 
-	data := make(map[expr.Req][]models.Series)
 	for _, serie := range out {
 		q := expr.NewReq(serie.QueryPatt, serie.QueryFrom, serie.QueryTo, serie.QueryCons)
-		data[q] = append(data[q], serie)
+		for i, r := range planReqsByFetch[q] {
+			if i > 0 {
+				// all data is returned to the pool after the plan runs, so each plan request needs its own copy
+				points := pointSlicePool.Get().([]schema.Point)
+				serie.Datapoints = append(points, serie.Datapoints...)
+			}
+			data[r] = append(data[r], serie)
+		}
 	}
 
 	preRun := time.Now()
@@ -643,6 +776,32 @@ func (s *Server) executePlan(ctx context.Context, orgId int, plan expr.Plan) ([]
 	return out, err
 }
 
+// resolveReq looks up the series that match the query of the given request.
+// the query is either a metric pattern, or a seriesByTag query which is resolved via the tag index.
+func (s *Server) resolveReq(ctx context.Context, orgId int, plan expr.Plan, r expr.Req) ([]Series, error) {
+	expressions, ok := plan.TagExpressions(r)
+	if !ok {
+		return s.findSeries(ctx, orgId, []string{r.Query}, int64(r.From))
+	}
+	names, err := s.clusterFindByTag(ctx, orgId, expressions, int64(r.From))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return s.findSeries(ctx, orgId, names, int64(r.From))
+}
+
+func containsReq(reqs []expr.Req, req expr.Req) bool {
+	for _, r := range reqs {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
 func getFromTo(ft models.FromTo, now time.Time, defaultFrom, defaultTo uint32) (uint32, uint32, error) {
 	loc, err := getLocation(ft.Tz)
 	if err != nil {
@@ -830,3 +989,20 @@ func (s *Server) clusterTags(ctx context.Context, orgId int, filter string, from
 
 	return tags, nil
 }
+
+// graphiteFunctions describes the natively supported functions, like graphite's /functions api,
+// so that clients such as grafana's function editor can see which functions metrictank handles natively.
+func (s *Server) graphiteFunctions(ctx *middleware.Context) {
+	funcs := expr.Describe()
+	name := ctx.Params(":func")
+	if name == "" {
+		response.Write(ctx, response.NewJson(200, funcs, ""))
+		return
+	}
+	desc, ok := funcs[name]
+	if !ok {
+		response.Write(ctx, response.NewError(http.StatusNotFound, "function not found"))
+		return
+	}
+	response.Write(ctx, response.NewJson(200, desc, ""))
+}
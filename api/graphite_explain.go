@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/util"
+)
+
+// explainResponse describes how a render request would be executed
+type explainResponse struct {
+	From            uint32             `json:"from"`
+	To              uint32             `json:"to"`
+	MaxDataPoints   uint32             `json:"maxDataPoints"`
+	Stable          bool               `json:"stable"`
+	Execution       string             `json:"execution"` // native, partial (see partial-execution) or proxy
+	ProxyReason     string             `json:"proxyReason,omitempty"`
+	GraphiteTargets []string           `json:"graphiteTargets,omitempty"` // for partial execution, the targets graphite executes
+	Exprs           []expr.ExplainNode `json:"exprs"`
+	Requests        []explainRequest   `json:"requests"`
+	Peers           []string           `json:"peers"` // the cluster peers that have series for the request
+	PointsFetch     uint32             `json:"pointsFetch"`
+	PointsReturn    uint32             `json:"pointsReturn"`
+	Nodes           int                `json:"nodes"`   // number of function calls and series requests planned
+	Deduped         int                `json:"deduped"` // how many of those are computed or fetched only once, because they're identical to others
+}
+
+// explainRequest describes a request for the series matching a pattern or seriesByTag query.
+// requests for the output of a partially executed request have no series, as it is only known once executed.
+type explainRequest struct {
+	Query     string                     `json:"query"`
+	From      uint32                     `json:"from"`
+	To        uint32                     `json:"to"`
+	Cons      consolidation.Consolidator `json:"consolidator"`
+	PrePoints uint32                     `json:"prePoints"`
+	Series    []explainSeries            `json:"series"`
+}
+
+// explainSeries describes the fetch of a series, including the archive that alignRequests chose for it
+type explainSeries struct {
+	models.Req
+	Node    string          `json:"node"`
+	Sources *explainSources `json:"sources,omitempty"` // only for series on this node
+}
+
+// explainSources estimates how many points of a fetch come from each of the data sources
+type explainSources struct {
+	Memory uint32 `json:"memory"`
+	Cache  uint32 `json:"cache"`
+	Store  uint32 `json:"store"`
+}
+
+func (s *Server) explainRender(ctx *middleware.Context, request models.GraphiteRender) {
+	if len(request.Targets) == 0 {
+		request.Targets = request.TargetsRails
+	}
+
+	now := time.Now()
+	defaultFrom := uint32(now.Add(-time.Duration(24) * time.Hour).Unix())
+	defaultTo := uint32(now.Unix())
+	fromUnix, toUnix, err := getFromTo(request.FromTo, now, defaultFrom, defaultTo)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if fromUnix >= toUnix {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, InvalidTimeRangeErr.Error()))
+		return
+	}
+	// like the render api, from is exclusive and to is inclusive
+	fromUnix += 1
+	toUnix += 1
+
+	exprs, err := expr.ParseManyTemplate(request.Targets, templateVars(ctx.Req.Request))
+	if err != nil {
+		response.Write(ctx, newTargetError(err))
+		return
+	}
+
+	stable := request.Process == "stable"
+	mdp := request.MaxDataPoints
+	if request.NoProxy {
+		mdp = 0
+	}
+	loc, _ := getLocation(request.FromTo.Tz)
+
+	resp := explainResponse{
+		From:          fromUnix,
+		To:            toUnix,
+		MaxDataPoints: mdp,
+		Stable:        stable,
+		Execution:     "native",
+		Exprs:         expr.Explain(exprs, stable),
+		Requests:      []explainRequest{},
+		Peers:         []string{},
+	}
+
+	if request.Process == "none" {
+		resp.Execution = "proxy"
+		resp.ProxyReason = "process=none requested"
+		response.Write(ctx, response.NewJson(200, resp, ""))
+		return
+	}
+
+	var plans []expr.Plan
+	plan, err := expr.NewPlan(exprs, fromUnix, toUnix, mdp, stable, loc, nil)
+	if err == nil {
+		plans = append(plans, plan)
+	} else {
+		if _, ok := err.(expr.ErrUnknownFunction); !ok {
+			response.Write(ctx, newTargetError(err))
+			return
+		}
+		resp.Execution = "proxy"
+		resp.ProxyReason = err.Error()
+		if partialExecution && !request.NoProxy {
+			partial := expr.NewPartial(exprs, fromUnix, toUnix, stable, loc, partialPlaceholder("<token>"))
+			if partial.Len() != 0 {
+				resp.Execution = "partial"
+				resp.GraphiteTargets = partial.Targets
+			}
+			// graphite executes the subtrees for the time range it needs, which we assume is the one of the request
+			for i := 0; i < partial.Len(); i++ {
+				plan, err := partial.NewPlan(i, fromUnix, toUnix, stable, loc)
+				if err != nil {
+					response.Write(ctx, response.WrapError(err))
+					return
+				}
+				plans = append(plans, plan)
+			}
+		}
+	}
+
+	peers := make(map[string]struct{})
+	for _, plan := range plans {
+		fetch, err := s.resolvePlan(ctx.Req.Context(), ctx.OrgId, plan)
+		if err != nil {
+			response.Write(ctx, response.WrapError(err))
+			return
+		}
+		resp.PointsFetch += fetch.pointsFetch
+		resp.PointsReturn += fetch.pointsReturn
+		resp.Nodes += plan.Nodes
+		resp.Deduped += plan.Deduped
+
+		for _, r := range plan.Reqs {
+			req := explainRequest{
+				Query:     r.Query,
+				From:      r.From,
+				To:        r.To,
+				Cons:      r.Cons,
+				PrePoints: r.PrePoints,
+				Series:    []explainSeries{},
+			}
+			for i, fetchReq := range fetch.reqs {
+				if fetch.planReqs[i] != r {
+					continue
+				}
+				series := explainSeries{
+					Req:  fetchReq,
+					Node: fetchReq.Node.Name,
+				}
+				if fetchReq.Node.IsLocal() {
+					series.Sources = s.explainSources(ctx.Req.Context(), fetchReq)
+				}
+				peers[fetchReq.Node.Name] = struct{}{}
+				req.Series = append(req.Series, series)
+			}
+			resp.Requests = append(resp.Requests, req)
+		}
+	}
+	for peer := range peers {
+		resp.Peers = append(resp.Peers, peer)
+	}
+	sort.Strings(resp.Peers)
+
+	response.Write(ctx, response.NewJson(200, resp, ""))
+}
+
+// explainSources estimates how many points of the given request for a local series would come from memory,
+// from the chunk cache and from the backend store, the same way getSeries decides it, but without fetching any data.
+func (s *Server) explainSources(ctx context.Context, req models.Req) *explainSources {
+	cons := consolidation.None
+	if req.Archive != 0 {
+		cons = req.Consolidator
+		if cons == consolidation.Avg {
+			// averages are computed from the sum and count rollups, which have the same data sources
+			cons = consolidation.Sum
+		}
+	}
+	rctx := newRequestContext(ctx, &req, cons)
+	key := rctx.Key
+	if cons != consolidation.None {
+		key = rctx.AggKey
+	}
+
+	oldest := rctx.To
+	if metric, ok := s.MemoryStore.Get(rctx.Key); ok {
+		var res mdata.Result
+		if cons != consolidation.None {
+			res = metric.GetAggregated(cons, req.ArchInterval, rctx.From, rctx.To)
+		} else {
+			res = metric.Get(rctx.From, rctx.To)
+		}
+		oldest = res.Oldest
+	}
+	if oldest <= rctx.From {
+		return &explainSources{Memory: (rctx.To - rctx.From) / req.ArchInterval}
+	}
+	until := util.Min(oldest, rctx.To)
+	sources := explainSources{
+		Memory: (rctx.To - until) / req.ArchInterval,
+	}
+	cacheRes := s.Cache.Peek(ctx, key, rctx.From, until)
+	var store uint32
+	if !cacheRes.Complete {
+		store = cacheRes.Until - cacheRes.From
+	}
+	sources.Cache = (until - rctx.From - store) / req.ArchInterval
+	sources.Store = store / req.ArchInterval
+	return &sources
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/cache"
+	"github.com/grafana/metrictank/mdata/cache/accnt"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/test"
+)
+
+func TestExplainSources(t *testing.T) {
+	mdata.SetSingleAgg(conf.Avg, conf.Min, conf.Max)
+	mdata.SetSingleSchema(conf.NewRetentionMT(1, 10000, 600, 10, true))
+	store := mdata.NewMockStore()
+	metrics := mdata.NewAggMetrics(store, &cache.MockCache{}, false, 0, 0, 0)
+	srv, _ := NewServer()
+	srv.BindBackendStore(store)
+	srv.BindMemoryStore(metrics)
+	c := cache.NewCCache()
+	srv.BindCache(c)
+
+	// metric1 is in memory from 1200 onwards, as the first chunk is not served unless we're primary
+	metric := metrics.GetOrCreate("metric1", "metric1", 0, 0)
+	for i := uint32(600); i < 3000; i++ {
+		metric.Add(i, float64(i))
+	}
+	// metric2 only has its chunk 600-1200 in the chunk cache
+	chunks := generateChunks(600, 600, 1800)
+	c.Add("metric2", 0, *chunk.NewBareIterGen(chunks[0].Series.Bytes(), chunks[0].Series.T0, 600))
+
+	cases := []struct {
+		key  string
+		from uint32
+		to   uint32
+		exp  explainSources
+	}{
+		{"metric1", 1744, 1888, explainSources{Memory: 144}},
+		{"metric2", 600, 1800, explainSources{Cache: 600, Store: 600}},
+	}
+	hits, misses := accnt.CacheChunkHit.Peek(), accnt.CacheMetricMiss.Peek()
+	for i, c := range cases {
+		req := reqRaw(c.key, c.from, c.to, 1000, 1, consolidation.None, 0, 0)
+		req.Archive = 0
+		req.ArchInterval = 1
+		got := srv.explainSources(test.NewContext(), req)
+		if *got != c.exp {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.exp, *got)
+		}
+	}
+	if accnt.CacheChunkHit.Peek() != hits || accnt.CacheMetricMiss.Peek() != misses {
+		t.Fatalf("expected the cache stats not to change")
+	}
+}
+
+// TestExplainPartialNotExecuted tests that resolving a plan, as explain does, doesn't execute
+// the partially executed requests it refers to
+func TestExplainPartialNotExecuted(t *testing.T) {
+	srv, _ := NewServer()
+	exprs, err := expr.ParseMany([]string{"sumSeries(_mtpartial.unknown.0.*)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := expr.NewPlan(exprs, 0, 10, 0, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch, err := srv.resolvePlan(test.NewContext(), 1, plan)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(fetch.reqs) != 0 {
+		t.Fatalf("expected no requests, got %v", fetch.reqs)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/stats"
+	"github.com/raintank/worldping-api/pkg/log"
+)
+
+// metric api.macros.reload_fail is the number of times the macros file was modified but could not be reloaded
+var macrosReloadFail = stats.NewCounter32("api.macros.reload_fail")
+
+// macroProxyRequest returns the render request to proxy to graphite, given the targets with their macros expanded
+// (see expr.ExpandedTargets), which is nil if they don't use any. graphite doesn't know our macros, so if any are used,
+// the targets are replaced by their expansions. json bodies can't be rewritten, as we don't know all the parameters graphite may use.
+func macroProxyRequest(r *http.Request, expanded []string) *http.Request {
+	if expanded == nil || strings.Contains(r.Header.Get("Content-Type"), "json") {
+		return r
+	}
+	return targetsProxyRequest(r, expanded)
+}
+
+// reloadMacros reloads the macros from the given file whenever it has been modified, checking at the given interval.
+// if the new definitions are invalid, the current macros remain in use.
+func reloadMacros(file string, interval time.Duration) {
+	var modTime time.Time
+	if info, err := os.Stat(file); err == nil {
+		modTime = info.ModTime()
+	}
+	for range time.Tick(interval) {
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Error(3, "API can't stat macros-file %q: %s", file, err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		macros, err := expr.ReadMacros(file)
+		if err != nil {
+			macrosReloadFail.Inc()
+			log.Error(3, "API can't reload macros-file %q, keeping the current macros: %s", file, err)
+			continue
+		}
+		expr.SetMacros(macros)
+		log.Info("API reloaded %d macros from %q", len(macros), file)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/stats"
+)
+
+// partial execution works as follows: when a render request uses functions we don't have,
+// we execute the largest subtrees of the targets that we do support, and proxy the request to graphite
+// with those subtrees replaced by a placeholder pattern like _mtpartial.<token>.<subtree>.*
+// graphite then fetches the placeholders from us like any other series: it finds them via /metrics/find,
+// which returns a leaf per output series of the subtree, and renders them via /render.
+// this way, graphite only has to apply the functions we don't have, on top of our output.
+// the subtrees are executed when graphite asks for them, for the time range it asks for,
+// because the functions graphite applies may need a different time range than the original request.
+const partialPrefix = "_mtpartial"
+
+// the output of a partially executed request is only kept by the instance that received the request, while graphite processes it.
+// so a token may be unknown because graphite queries another instance, or because graphite's request already completed.
+var errPartialNotFound = response.NewError(http.StatusNotFound, "partial token not found or expired")
+
+// metric api.request.render.partial is the number of render requests that were partially executed by metrictank, and proxied to graphite for the remainder
+var renderReqPartial = stats.NewCounter32("api.request.render.partial")
+
+var partials = partialRegistry{
+	entries: make(map[string]*partialEntry),
+}
+
+type partialRegistry struct {
+	sync.Mutex
+	entries map[string]*partialEntry
+}
+
+// partialEntry tracks a partially executed render request while graphite processes it
+type partialEntry struct {
+	sync.Mutex
+	orgId   int
+	from    uint32
+	to      uint32
+	stable  bool
+	loc     *time.Location
+	partial expr.Partial
+	results map[partialResultKey][]models.Series
+}
+
+type partialResultKey struct {
+	subtree int
+	from    uint32
+	to      uint32
+}
+
+// newPartialToken returns a new token to identify a partially executed request by
+func newPartialToken() string {
+	return strconv.FormatUint(uint64(rand.Int63()), 36)
+}
+
+// partialPlaceholder returns the function that returns the placeholder pattern for each native subtree
+// of the partially executed request with the given token
+func partialPlaceholder(token string) func(i int) string {
+	return func(i int) string {
+		return fmt.Sprintf("%s.%s.%d.*", partialPrefix, token, i)
+	}
+}
+
+func (r *partialRegistry) add(token string, entry *partialEntry) {
+	r.Lock()
+	r.entries[token] = entry
+	r.Unlock()
+}
+
+func (r *partialRegistry) get(orgId int, token string) (*partialEntry, bool) {
+	r.Lock()
+	entry, ok := r.entries[token]
+	r.Unlock()
+	if !ok || entry.orgId != orgId {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (r *partialRegistry) del(token string) {
+	r.Lock()
+	delete(r.entries, token)
+	r.Unlock()
+}
+
+// isPartialQuery returns whether the query refers to the output of a partially executed request
+func isPartialQuery(query string) bool {
+	return strings.HasPrefix(query, partialPrefix+".")
+}
+
+// parsePartialQuery parses a query of the form _mtpartial.<token>.<subtree>.<leaf>,
+// where leaf is either the index of an output series, or * for all of them (returned as -1)
+func parsePartialQuery(query string) (token string, subtree, leaf int, err error) {
+	parts := strings.Split(query, ".")
+	if len(parts) != 4 || parts[0] != partialPrefix {
+		return "", 0, 0, fmt.Errorf("invalid partial query %q", query)
+	}
+	subtree, err = strconv.Atoi(parts[2])
+	if err != nil || subtree < 0 {
+		return "", 0, 0, fmt.Errorf("invalid partial query %q", query)
+	}
+	leaf = -1
+	if parts[3] != "*" {
+		leaf, err = strconv.Atoi(parts[3])
+		if err != nil || leaf < 0 {
+			return "", 0, 0, fmt.Errorf("invalid partial query %q", query)
+		}
+	}
+	return parts[1], subtree, leaf, nil
+}
+
+// partialSeries returns the output series of the partially executed request that the query refers to,
+// for the given time range. a time range of 0 means the time range of the original request.
+// the returned series are named after the target that produced them, and the leaf path is returned for each.
+// the series are shared with other callers, so their data must be copied before it is used in a plan.
+func (s *Server) partialSeries(ctx context.Context, orgId int, query string, from, to uint32) ([]models.Series, []string, error) {
+	token, subtree, leaf, err := parsePartialQuery(query)
+	if err != nil {
+		return nil, nil, response.NewError(http.StatusBadRequest, err.Error())
+	}
+	entry, ok := partials.get(orgId, token)
+	if !ok {
+		return nil, nil, errPartialNotFound
+	}
+	if subtree >= entry.partial.Len() {
+		return nil, nil, response.NewError(http.StatusBadRequest, fmt.Sprintf("invalid partial query %q: no such subtree", query))
+	}
+	if from == 0 || to == 0 {
+		from, to = entry.from, entry.to
+	}
+
+	entry.Lock()
+	defer entry.Unlock()
+	key := partialResultKey{subtree, from, to}
+	out, ok := entry.results[key]
+	if !ok {
+		plan, err := entry.partial.NewPlan(subtree, from, to, entry.stable, entry.loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, err = s.executePlan(ctx, orgId, plan)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.results[key] = out
+	}
+
+	var series []models.Series
+	var paths []string
+	for i, serie := range out {
+		if leaf != -1 && leaf != i {
+			continue
+		}
+		series = append(series, serie)
+		paths = append(paths, fmt.Sprintf("%s.%s.%d.%d", partialPrefix, token, subtree, i))
+	}
+	return series, paths, nil
+}
+
+// findPartial returns a leaf node for each output series of the partially executed request that the query refers to
+func (s *Server) findPartial(ctx context.Context, orgId int, query string, from, to uint32) ([]idx.Node, error) {
+	_, paths, err := s.partialSeries(ctx, orgId, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]idx.Node, 0, len(paths))
+	for _, path := range paths {
+		nodes = append(nodes, idx.Node{Path: path, Leaf: true})
+	}
+	return nodes, nil
+}
+
+// targetsProxyRequest returns a copy of the given render request, for graphite to execute the given targets instead.
+// all parameters are sent as a form encoded body.
+func targetsProxyRequest(r *http.Request, targets []string) *http.Request {
+	r.ParseForm()
+	values := make(url.Values)
+	for k, v := range r.Form {
+		values[k] = v
+	}
+	values.Del("target[]")
+	values["target"] = targets
+	body := values.Encode()
+
+	out := r.WithContext(r.Context())
+	u := *r.URL
+	u.RawQuery = ""
+	out.URL = &u
+	out.Method = "POST"
+	out.Header = make(http.Header)
+	for k, v := range r.Header {
+		out.Header[k] = v
+	}
+	out.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	out.Header.Del("Content-Length")
+	out.Body = ioutil.NopCloser(strings.NewReader(body))
+	out.ContentLength = int64(len(body))
+	return out
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/metrictank/api/response"
+)
+
+func TestParsePartialQuery(t *testing.T) {
+	cases := []struct {
+		query      string
+		expToken   string
+		expSubtree int
+		expLeaf    int
+		expErr     bool
+	}{
+		{"_mtpartial.abc.0.*", "abc", 0, -1, false},
+		{"_mtpartial.abc.2.13", "abc", 2, 13, false},
+		{"_mtpartial.abc.2", "", 0, 0, true},
+		{"_mtpartial.abc.x.*", "", 0, 0, true},
+		{"_mtpartial.abc.1.-1", "", 0, 0, true},
+		{"_mtpartial.abc.1.2.3", "", 0, 0, true},
+		{"foo.abc.1.2", "", 0, 0, true},
+	}
+	for _, c := range cases {
+		token, subtree, leaf, err := parsePartialQuery(c.query)
+		if (err != nil) != c.expErr {
+			t.Fatalf("%q: expected error %t, got %v", c.query, c.expErr, err)
+		}
+		if token != c.expToken || subtree != c.expSubtree || leaf != c.expLeaf {
+			t.Fatalf("%q: expected %q %d %d, got %q %d %d", c.query, c.expToken, c.expSubtree, c.expLeaf, token, subtree, leaf)
+		}
+	}
+}
+
+// TestPartialSeriesNotFound tests that querying an unknown (or expired) token results in an error, rather than in empty data
+func TestPartialSeriesNotFound(t *testing.T) {
+	s := &Server{}
+	_, _, err := s.partialSeries(context.Background(), 1, "_mtpartial.unknown.0.*", 0, 0)
+	if err != errPartialNotFound {
+		t.Fatalf("expected error %v, got %v", errPartialNotFound, err)
+	}
+	_, _, err = s.partialSeries(context.Background(), 1, "_mtpartial.unknown.x.*", 0, 0)
+	if err == nil || response.WrapError(err).Code() != http.StatusBadRequest {
+		t.Fatalf("expected a bad request error, got %v", err)
+	}
+}
+
+func TestTargetsProxyRequest(t *testing.T) {
+	body := "until=now&target=someFunc(sumSeries(foo.*))"
+	req, err := http.NewRequest("POST", "http://localhost:6060/render?from=-1h&target[]=bar&format=json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Org-Id", "1")
+
+	out := targetsProxyRequest(req, []string{"someFunc(_mtpartial.abc.0.*)", "_mtpartial.abc.1.*"})
+	if out.Method != "POST" || out.URL.RawQuery != "" || out.URL.Path != "/render" {
+		t.Fatalf("expected a POST to /render without query string, got %s %s", out.Method, out.URL)
+	}
+	if out.Header.Get("X-Org-Id") != "1" {
+		t.Fatalf("expected headers to be retained, got %v", out.Header)
+	}
+	buf, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(buf)) != out.ContentLength {
+		t.Fatalf("expected content length %d, got %d", len(buf), out.ContentLength)
+	}
+	values, err := url.ParseQuery(string(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := url.Values{
+		"from":   {"-1h"},
+		"until":  {"now"},
+		"format": {"json"},
+		"target": {"someFunc(_mtpartial.abc.0.*)", "_mtpartial.abc.1.*"},
+	}
+	if !reflect.DeepEqual(values, exp) {
+		t.Fatalf("expected form %v, got %v", exp, values)
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+type PrometheusQuery struct {
+	Query string `json:"query" form:"query"`
+	Time  string `json:"time" form:"time"`
+}
+
+type PrometheusQueryRange struct {
+	Query string `json:"query" form:"query"`
+	Start string `json:"start" form:"start"`
+	End   string `json:"end" form:"end"`
+	Step  string `json:"step" form:"step"`
+}
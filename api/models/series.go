@@ -3,7 +3,9 @@ package models
 import (
 	"bytes"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/grafana/metrictank/consolidation"
 	pickle "github.com/kisielk/og-rek"
@@ -12,7 +14,8 @@ import (
 
 //go:generate msgp
 type Series struct {
-	Target       string // for fetched data, set from models.Req.Target, i.e. the metric graphite key. for function output, whatever should be shown as target string (legend)
+	Target       string            // for fetched data, set from models.Req.Target, i.e. the metric graphite key. for function output, whatever should be shown as target string (legend)
+	Tags         map[string]string // tags of the series, including its name under the "name" key. for function output, the tags that still apply
 	Datapoints   []schema.Point
 	Interval     uint32
 	QueryPatt    string                     // to tie series back to request it came from. e.g. foo.bar.*, or if series outputted by func it would be e.g. scale(foo.bar.*,0.123456)
@@ -22,6 +25,34 @@ type Series struct {
 	Consolidator consolidation.Consolidator // consolidator to actually use (for fetched series this may not be 0, default must be resolved. if series created by function, may be 0)
 }
 
+// SetTags fills in the tags of the series based on its target,
+// which for fetched data is the metric name, optionally followed by tags in the form ;key=value
+func (s *Series) SetTags() {
+	tags := strings.Split(s.Target, ";")
+	s.Tags = make(map[string]string, len(tags))
+	for _, tag := range tags[1:] {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		s.Tags[parts[0]] = parts[1]
+	}
+	s.Tags["name"] = tags[0]
+}
+
+// CopyTags returns a copy of the tags of the series, for a series derived from it,
+// such that the tags of either can be changed without affecting the other
+func (s Series) CopyTags() map[string]string {
+	if s.Tags == nil {
+		return nil
+	}
+	tags := make(map[string]string, len(s.Tags))
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
 type SeriesByTarget []Series
 
 func (g SeriesByTarget) Len() int           { return len(g) }
@@ -34,6 +65,17 @@ func (series SeriesByTarget) MarshalJSONFast(b []byte) ([]byte, error) {
 	for _, s := range series {
 		b = append(b, `{"target":`...)
 		b = strconv.AppendQuoteToASCII(b, s.Target)
+		if len(s.Tags) != 0 {
+			b = append(b, `,"tags":{`...)
+			for _, k := range sortedKeys(s.Tags) {
+				b = strconv.AppendQuoteToASCII(b, k)
+				b = append(b, ':')
+				b = strconv.AppendQuoteToASCII(b, s.Tags[k])
+				b = append(b, ',')
+			}
+			b = b[:len(b)-1] // cut last comma
+			b = append(b, '}')
+		}
 		b = append(b, `,"datapoints":[`...)
 		for _, p := range s.Datapoints {
 			b = append(b, '[')
@@ -75,10 +117,14 @@ func (series SeriesByTarget) Pickle(buf []byte) ([]byte, error) {
 		}
 		data[i] = seriesForPickle{
 			Name:           s.Target,
+			Tags:           s.Tags,
 			Step:           s.Interval,
 			Values:         datapoints,
 			PathExpression: s.QueryPatt,
 		}
+		if data[i].Tags == nil {
+			data[i].Tags = map[string]string{"name": s.Target}
+		}
 		if len(datapoints) > 0 {
 			data[i].Start = s.Datapoints[0].Ts
 			data[i].End = s.Datapoints[len(s.Datapoints)-1].Ts + s.Interval
@@ -94,10 +140,21 @@ func (series SeriesByTarget) Pickle(buf []byte) ([]byte, error) {
 }
 
 type seriesForPickle struct {
-	Name           string        `pickle:"name"`
-	Start          uint32        `pickle:"start"`
-	End            uint32        `pickle:"end"`
-	Step           uint32        `pickle:"step"`
-	Values         []interface{} `pickle:"values"`
-	PathExpression string        `pickle:"pathExpression"`
+	Name           string            `pickle:"name"`
+	Tags           map[string]string `pickle:"tags"`
+	Start          uint32            `pickle:"start"`
+	End            uint32            `pickle:"end"`
+	Step           uint32            `pickle:"step"`
+	Values         []interface{}     `pickle:"values"`
+	PathExpression string            `pickle:"pathExpression"`
+}
+
+// sortedKeys returns the keys of the given map in sorted order, for a deterministic output
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
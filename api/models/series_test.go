@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"gopkg.in/raintank/schema.v1"
+	"reflect"
 	"testing"
 )
 
@@ -35,6 +36,17 @@ func TestJsonMarshal(t *testing.T) {
 			},
 			out: `[{"target":"a\\b","datapoints":[]}]`,
 		},
+		{
+			in: []Series{
+				{
+					Target:     "a;dc=east",
+					Tags:       map[string]string{"name": "a", "dc": "east"},
+					Datapoints: []schema.Point{},
+					Interval:   60,
+				},
+			},
+			out: `[{"target":"a;dc=east","tags":{"dc":"east","name":"a"},"datapoints":[]}]`,
+		},
 		{
 			in: []Series{
 				{
@@ -89,3 +101,37 @@ func TestJsonMarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestSetTags(t *testing.T) {
+	cases := []struct {
+		target string
+		tags   map[string]string
+	}{
+		{"a.b.c", map[string]string{"name": "a.b.c"}},
+		{"a.b.c;dc=east;host=a=b", map[string]string{"name": "a.b.c", "dc": "east", "host": "a=b"}},
+		{"a.b.c;invalid", map[string]string{"name": "a.b.c"}},
+	}
+	for i, c := range cases {
+		s := Series{Target: c.target}
+		s.SetTags()
+		if !reflect.DeepEqual(s.Tags, c.tags) {
+			t.Fatalf("case %d: expected tags %v, got %v", i, c.tags, s.Tags)
+		}
+	}
+}
+
+func TestCopyTags(t *testing.T) {
+	s := Series{Target: "a.b.c;dc=east"}
+	s.SetTags()
+	tags := s.CopyTags()
+	if !reflect.DeepEqual(tags, s.Tags) {
+		t.Fatalf("expected tags %v, got %v", s.Tags, tags)
+	}
+	tags["dc"] = "west"
+	if s.Tags["dc"] != "east" {
+		t.Fatalf("changing the copy changed the tags of the series: %v", s.Tags)
+	}
+	if tags := (Series{}).CopyTags(); tags != nil {
+		t.Fatalf("expected no tags, got %v", tags)
+	}
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/promql"
+	"github.com/grafana/metrictank/tracing"
+	macaron "gopkg.in/macaron.v1"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// maxPrometheusSteps is the maximum number of points per series a range query may return, like in prometheus
+const maxPrometheusSteps = 11000
+
+// prometheusResponse is a response in the format of the prometheus http api
+type prometheusResponse struct {
+	Status    string          `json:"status"`
+	Data      *prometheusData `json:"data,omitempty"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type prometheusData struct {
+	ResultType string      `json:"resultType"` // matrix, vector or scalar
+	Result     interface{} `json:"result"`
+}
+
+type prometheusSeries struct {
+	Metric map[string]string  `json:"metric"`
+	Values []prometheusSample `json:"values,omitempty"` // for matrix results
+	Value  *prometheusSample  `json:"value,omitempty"`  // for vector results
+}
+
+// prometheusSample is encoded like [<timestamp>, "<value>"]
+type prometheusSample schema.Point
+
+func (s prometheusSample) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 32)
+	b = append(b, '[')
+	b = strconv.AppendUint(b, uint64(s.Ts), 10)
+	b = append(b, ',', '"')
+	b = strconv.AppendFloat(b, s.Val, 'f', -1, 64)
+	return append(b, '"', ']'), nil
+}
+
+func newPrometheusError(code int, errorType string, err error) response.Response {
+	return response.NewJson(code, prometheusResponse{Status: "error", ErrorType: errorType, Error: err.Error()}, "")
+}
+
+// prometheusQuery evaluates an instant query, returning a vector or a scalar
+func (s *Server) prometheusQuery(ctx *middleware.Context, request models.PrometheusQuery) {
+	ts, err := parsePrometheusTime(request.Time, time.Now())
+	if err != nil {
+		response.Write(ctx, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'time': %s", err)))
+		return
+	}
+	prog, series, resp := s.prometheusEval(ctx, request.Query, ts, ts, 1)
+	if resp != nil {
+		response.Write(ctx, resp)
+		return
+	}
+	data := &prometheusData{ResultType: "vector"}
+	if prog.Target == "" {
+		data.ResultType = "scalar"
+		data.Result = prometheusSample{Val: prog.Scalar, Ts: ts}
+	} else {
+		result := make([]prometheusSeries, 0, len(series))
+		for _, serie := range series {
+			value := serie.Values[0]
+			result = append(result, prometheusSeries{Metric: serie.Metric, Value: &value})
+		}
+		data.Result = result
+	}
+	response.Write(ctx, response.NewJson(200, prometheusResponse{Status: "success", Data: data}, ""))
+}
+
+// prometheusQueryRange evaluates a query at every step of a time range, returning a matrix
+func (s *Server) prometheusQueryRange(ctx *middleware.Context, request models.PrometheusQueryRange) {
+	now := time.Now()
+	start, err := parsePrometheusTime(request.Start, now)
+	if err != nil || request.Start == "" {
+		response.Write(ctx, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'start': %v", errOrMissing(err))))
+		return
+	}
+	end, err := parsePrometheusTime(request.End, now)
+	if err != nil || request.End == "" {
+		response.Write(ctx, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'end': %v", errOrMissing(err))))
+		return
+	}
+	if end < start {
+		response.Write(ctx, newPrometheusError(400, "bad_data", errors.New("invalid parameter 'end': end timestamp must not be before start time")))
+		return
+	}
+	step, err := parsePrometheusStep(request.Step)
+	if err != nil {
+		response.Write(ctx, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'step': %s", err)))
+		return
+	}
+	if (end-start)/step >= maxPrometheusSteps {
+		response.Write(ctx, newPrometheusError(400, "bad_data", errors.New("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")))
+		return
+	}
+
+	prog, series, resp := s.prometheusEval(ctx, request.Query, start, end, step)
+	if resp != nil {
+		response.Write(ctx, resp)
+		return
+	}
+	if prog.Target == "" {
+		// like prometheus, scalars are returned as a series without labels
+		values := make([]prometheusSample, 0, (end-start)/step+1)
+		for ts := start; ts <= end; ts += step {
+			values = append(values, prometheusSample{Val: prog.Scalar, Ts: ts})
+		}
+		series = []prometheusSeries{{Metric: map[string]string{}, Values: values}}
+	}
+	response.Write(ctx, response.NewJson(200, prometheusResponse{Status: "success", Data: &prometheusData{ResultType: "matrix", Result: series}}, ""))
+}
+
+func errOrMissing(err error) error {
+	if err == nil {
+		return errors.New("missing value")
+	}
+	return err
+}
+
+// prometheusEval evaluates the query at every step from start to end, inclusive.
+// series that have no value at any of the steps are left out. for scalar queries, no series are returned.
+// if the query can't be evaluated, the error response is returned.
+func (s *Server) prometheusEval(ctx *middleware.Context, query string, start, end, step uint32) (promql.Program, []prometheusSeries, response.Response) {
+	if query == "" {
+		return promql.Program{}, nil, newPrometheusError(400, "bad_data", errors.New("invalid parameter 'query': missing value"))
+	}
+	node, err := promql.Parse(query)
+	if err != nil {
+		return promql.Program{}, nil, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'query': %s", err))
+	}
+	prog, err := promql.Compile(node)
+	if err != nil {
+		return prog, nil, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'query': %s", err))
+	}
+	if prog.Target == "" {
+		return prog, nil, nil
+	}
+
+	exprs, err := expr.ParseMany([]string{prog.Target})
+	if err != nil {
+		return prog, nil, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'query': %s", err))
+	}
+	// we fetch the points within the lookback period before the first step, and up to and including the last one.
+	// for range queries, the output is consolidated to at most one point per step.
+	from := uint32(0)
+	if start > promql.Lookback {
+		from = start - promql.Lookback
+	}
+	to := end + 1
+	mdp := uint32(0)
+	if start != end {
+		mdp = (to-from)/step + 1
+	}
+	plan, err := expr.NewPlan(exprs, from, to, mdp, true, nil, nil)
+	if err != nil {
+		return prog, nil, newPrometheusError(400, "bad_data", fmt.Errorf("invalid parameter 'query': %s", err))
+	}
+	// the samples are copied from the output of the plan, so its buffers can be returned as soon as we have them
+	defer plan.Clean()
+
+	newctx, span := tracing.NewSpan(ctx.Req.Context(), s.Tracer, "executePlan")
+	defer span.Finish()
+	ctx.Req = macaron.Request{ctx.Req.WithContext(newctx)}
+	out, err := s.executePlan(ctx.Req.Context(), ctx.OrgId, plan)
+	if err != nil {
+		tracing.Failure(span)
+		tracing.Error(span, err)
+		resp := response.WrapError(err)
+		return prog, nil, newPrometheusError(resp.Code(), "execution", resp)
+	}
+
+	var series []prometheusSeries
+	for _, serie := range prog.Result(out) {
+		samples := serie.Samples(start, end, step)
+		if len(samples) == 0 {
+			continue
+		}
+		values := make([]prometheusSample, len(samples))
+		for i, p := range samples {
+			values[i] = prometheusSample(p)
+		}
+		series = append(series, prometheusSeries{Metric: serie.Labels, Values: values})
+	}
+	if series == nil {
+		series = []prometheusSeries{}
+	}
+	return prog, series, nil
+}
+
+// parsePrometheusTime parses a unix timestamp, which may have decimals, or an RFC 3339 time.
+// like our other timestamps, they are truncated to seconds.
+func parsePrometheusTime(s string, def time.Time) (uint32, error) {
+	if s == "" {
+		return uint32(def.Unix()), nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f < 0 || f >= math.MaxUint32 {
+			return 0, fmt.Errorf("timestamp %q out of range", s)
+		}
+		return uint32(f), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+	}
+	if t.Unix() < 0 || t.Unix() >= math.MaxUint32 {
+		return 0, fmt.Errorf("timestamp %q out of range", s)
+	}
+	return uint32(t.Unix()), nil
+}
+
+// parsePrometheusStep parses a step given in seconds, which may have decimals, or as a promql duration.
+// steps are rounded up to whole seconds.
+func parsePrometheusStep(s string) (uint32, error) {
+	if s == "" {
+		return 0, errors.New("missing value")
+	}
+	var seconds float64
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		seconds = f
+	} else {
+		d, err := promql.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+		}
+		seconds = d.Seconds()
+	}
+	if seconds <= 0 || seconds >= math.MaxUint32 || math.IsNaN(seconds) {
+		return 0, errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")
+	}
+	return uint32(math.Ceil(seconds)), nil
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/prompb"
+	"github.com/grafana/metrictank/promql"
+	"github.com/grafana/metrictank/stats"
+	"github.com/raintank/worldping-api/pkg/log"
+)
+
+// metric api.request.prometheus_read.series is the number of series a prometheus remote read request returns
+var reqPrometheusReadSeriesCount = stats.NewMeter32("api.request.prometheus_read.series", false)
+
+// prometheusRead implements the prometheus remote read protocol: every query of the request is resolved via the tag index,
+// and the raw points of the matching series are returned.
+func (s *Server) prometheusRead(ctx *middleware.Context) {
+	// the body is limited before it is read, and its decompressed size before it is decompressed
+	body, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Resp, ctx.Req.Request.Body, int64(prompb.MaxEncodedLen(prometheusReadMaxSize))))
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		response.Write(ctx, response.NewError(status, fmt.Sprintf("failed to read request body: %s", err)))
+		return
+	}
+	req, err := prompb.DecodeReadRequest(body, prometheusReadMaxSize)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(prompb.ErrTooLarge); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		response.Write(ctx, response.NewError(status, fmt.Sprintf("invalid read request: %s", err)))
+		return
+	}
+
+	resp := prompb.ReadResponse{
+		Results: make([]prompb.QueryResult, len(req.Queries)),
+	}
+	for i, q := range req.Queries {
+		series, err := s.prometheusReadQuery(ctx.Req.Context(), ctx.OrgId, q)
+		if err != nil {
+			response.Write(ctx, response.WrapError(err))
+			return
+		}
+		reqPrometheusReadSeriesCount.Value(len(series))
+		resp.Results[i].Timeseries = make([]prompb.TimeSeries, 0, len(series))
+		for _, serie := range series {
+			resp.Results[i].Timeseries = append(resp.Results[i].Timeseries, toTimeSeries(serie))
+			pointSlicePool.Put(serie.Datapoints[:0])
+		}
+	}
+	response.Write(ctx, response.NewSnappyProtobuf(200, resp))
+}
+
+// prometheusReadQuery returns the series matching the query, sorted by target
+func (s *Server) prometheusReadQuery(ctx context.Context, orgId int, q prompb.Query) ([]models.Series, error) {
+	expressions, err := promql.TagExpressions(q.Matchers)
+	if err != nil {
+		return nil, response.NewError(400, err.Error())
+	}
+	// prometheus' time range is inclusive and in ms. ours excludes the end.
+	if q.StartTimestampMs < 0 {
+		q.StartTimestampMs = 0
+	}
+	if q.EndTimestampMs < q.StartTimestampMs || q.EndTimestampMs/1000 >= math.MaxUint32 {
+		return nil, response.NewError(400, InvalidTimeRangeErr.Error())
+	}
+	from := uint32(q.StartTimestampMs / 1000)
+	to := uint32(q.EndTimestampMs/1000) + 1
+
+	names, err := s.clusterFindByTag(ctx, orgId, expressions, int64(from))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	found, err := s.findSeries(ctx, orgId, names, int64(from))
+	if err != nil {
+		return nil, err
+	}
+
+	var reqs []models.Req
+	for _, s := range found {
+		for _, metric := range s.Series {
+			for _, archive := range metric.Defs {
+				fn := mdata.Aggregations.Get(archive.AggId).AggregationMethod[0]
+				cons := consolidation.Consolidator(fn)
+				reqs = append(reqs, models.NewReq(
+					archive.Id, archive.NameWithTags(), s.Pattern, from, to, 0, uint32(archive.Interval), cons, 0, s.Node, archive.SchemaId, archive.AggId))
+			}
+		}
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	// the series are aligned together, like the series of a graphite request,
+	// so that the max-points-per-req limits apply to the query as a whole
+	reqs, _, _, err = alignRequests(uint32(time.Now().Unix()), reqs)
+	if err != nil {
+		log.Error(3, "HTTP prometheusRead alignReq error: %s", err)
+		return nil, err
+	}
+
+	out, err := s.getTargets(ctx, reqs)
+	if err != nil {
+		log.Error(3, "HTTP prometheusRead %s", err.Error())
+		return nil, err
+	}
+	out = mergeSeries(out)
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out, nil
+}
+
+// toTimeSeries converts the fetched series into a prometheus time series, of which the labels are its tags.
+// null points are left out.
+func toTimeSeries(serie models.Series) prompb.TimeSeries {
+	serie.SetTags()
+	ts := prompb.TimeSeries{
+		Labels: make([]prompb.Label, 0, len(serie.Tags)),
+	}
+	for key, val := range serie.Tags {
+		if key == "name" {
+			key = "__name__"
+		}
+		ts.Labels = append(ts.Labels, prompb.Label{Name: key, Value: val})
+	}
+	sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+	for _, p := range serie.Datapoints {
+		if math.IsNaN(p.Val) {
+			continue
+		}
+		ts.Samples = append(ts.Samples, prompb.Sample{Value: p.Val, Timestamp: int64(p.Ts) * 1000})
+	}
+	return ts
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/prompb"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestToTimeSeries(t *testing.T) {
+	serie := models.Series{
+		Target: "cpu.usage;host=a;dc=east",
+		Datapoints: []schema.Point{
+			{Val: 1, Ts: 10},
+			{Val: math.NaN(), Ts: 20},
+			{Val: 3, Ts: 30},
+		},
+	}
+	exp := prompb.TimeSeries{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "cpu.usage"},
+			{Name: "dc", Value: "east"},
+			{Name: "host", Value: "a"},
+		},
+		Samples: []prompb.Sample{
+			{Value: 1, Timestamp: 10000},
+			{Value: 3, Timestamp: 30000},
+		},
+	}
+	got := toTimeSeries(serie)
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+}
+
+func TestParsePrometheusTime(t *testing.T) {
+	def := time.Unix(1000, 0)
+	cases := []struct {
+		in  string
+		exp uint32
+		err bool
+	}{
+		{"", 1000, false},
+		{"1526480400", 1526480400, false},
+		{"1526480400.781", 1526480400, false},
+		{"2018-05-16T14:20:00Z", 1526480400, false},
+		{"2018-05-16T16:20:00.5+02:00", 1526480400, false},
+		{"-1", 0, true},
+		{"yesterday", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parsePrometheusTime(c.in, def)
+		if (err != nil) != c.err {
+			t.Errorf("time %q: expected error %t, got %v", c.in, c.err, err)
+			continue
+		}
+		if got != c.exp {
+			t.Errorf("time %q: expected %d, got %d", c.in, c.exp, got)
+		}
+	}
+}
+
+func TestParsePrometheusStep(t *testing.T) {
+	cases := []struct {
+		in  string
+		exp uint32
+		err bool
+	}{
+		{"15", 15, false},
+		{"0.5", 1, false},
+		{"1m30s", 90, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"-10", 0, true},
+		{"5x", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parsePrometheusStep(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("step %q: expected error %t, got %v", c.in, c.err, err)
+			continue
+		}
+		if got != c.exp {
+			t.Errorf("step %q: expected %d, got %d", c.in, c.exp, got)
+		}
+	}
+}
@@ -24,31 +24,97 @@ var (
 )
 
 // alignRequests updates the requests with all details for fetching, making sure all metrics are in the same, optimal interval
-// note: it is assumed that all requests have the same from & to.
+// note: requests may have different from & to, e.g. due to functions such as timeShift or movingAverage.
 // also takes a "now" value which we compare the TTL against
-func alignRequests(now, from, to uint32, reqs []models.Req) ([]models.Req, uint32, uint32, error) {
-	tsRange := to - from
+// requests with PrePoints get their From extended by that many points of the output interval, before the archives
+// are chosen and the limits are checked. but the output interval depends on the time range, so we start off
+// assuming the raw interval, and extend further (and align again) as long as the chosen interval requires it.
+func alignRequests(now uint32, reqs []models.Req) ([]models.Req, uint32, uint32, error) {
+	from := make([]uint32, len(reqs))
+	for i := range reqs {
+		req := &reqs[i]
+		from[i] = req.From
+		req.From = preFrom(req.From, req.PrePoints, req.RawInterval)
+	}
+
+	var pointsFetch, pointsReturn uint32
+	for {
+		var interval uint32
+		var err error
+		interval, pointsFetch, pointsReturn, err = alignRequestsOnce(now, reqs)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		// we only ever extend, so that this terminates even with exotic retentions
+		// where a longer time range may result in a smaller interval.
+		var extended bool
+		for i := range reqs {
+			req := &reqs[i]
+			if f := preFrom(from[i], req.PrePoints, interval); f < req.From {
+				req.From = f
+				extended = true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+
+	for _, req := range reqs {
+		reqRenderChosenArchive.Value(req.Archive)
+	}
+	reqRenderPointsFetched.ValueUint32(pointsFetch)
+	reqRenderPointsReturned.ValueUint32(pointsReturn)
+
+	return reqs, pointsFetch, pointsReturn, nil
+}
+
+// preFrom returns from, extended by the given number of points of the given interval, but not before 0
+func preFrom(from, points, interval uint32) uint32 {
+	ext := uint64(points) * uint64(interval)
+	if ext >= uint64(from) {
+		return 0
+	}
+	return from - uint32(ext)
+}
+
+// alignRequestsOnce chooses the archive and output interval of the requests for their current time range.
+// it returns the output interval, and the number of points to fetch and to return.
+func alignRequestsOnce(now uint32, reqs []models.Req) (uint32, uint32, uint32, error) {
 
 	var listIntervals []uint32
 	var seenIntervals = make(map[uint32]struct{})
-	var targets = make(map[string]struct{})
 
+	// the total time range covered by all targets. a target requested for multiple time ranges counts once for each range.
+	type targetRange struct {
+		target   string
+		from, to uint32
+	}
+	var targets = make(map[targetRange]struct{})
+	var totalRange uint32
+
+	minTTL := uint32(0)
 	for i := range reqs {
 		req := &reqs[i]
 		req.Archive = -1
-		targets[req.Target] = struct{}{}
+		key := targetRange{req.Target, req.From, req.To}
+		if _, ok := targets[key]; !ok {
+			targets[key] = struct{}{}
+			totalRange += req.To - req.From
+		}
+		if now-req.From > minTTL {
+			minTTL = now - req.From
+		}
 	}
-	numTargets := uint32(len(targets))
-	minTTL := now - reqs[0].From
 
 	minIntervalSoft := uint32(0)
 	minIntervalHard := uint32(0)
 
 	if maxPointsPerReqSoft > 0 {
-		minIntervalSoft = uint32(math.Ceil(float64(tsRange) / (float64(maxPointsPerReqSoft) / float64(numTargets))))
+		minIntervalSoft = uint32(math.Ceil(float64(totalRange) / float64(maxPointsPerReqSoft)))
 	}
 	if maxPointsPerReqHard > 0 {
-		minIntervalHard = uint32(math.Ceil(float64(tsRange) / (float64(maxPointsPerReqHard) / float64(numTargets))))
+		minIntervalHard = uint32(math.Ceil(float64(totalRange) / float64(maxPointsPerReqHard)))
 	}
 
 	// set preliminary settings. may be adjusted further down
@@ -79,7 +145,7 @@ func alignRequests(now, from, to uint32, reqs []models.Req) ([]models.Req, uint3
 			}
 		}
 		if req.Archive == -1 {
-			return nil, 0, 0, errUnSatisfiable
+			return 0, 0, 0, errUnSatisfiable
 		}
 
 		if _, ok := seenIntervals[req.ArchInterval]; !ok {
@@ -93,7 +159,7 @@ func alignRequests(now, from, to uint32, reqs []models.Req) ([]models.Req, uint3
 	interval := util.Lcm(listIntervals)
 
 	if interval < minIntervalHard {
-		return nil, 0, 0, errMaxPointsPerReq
+		return 0, 0, 0, errMaxPointsPerReq
 	}
 
 	// now, for all our requests, set all their properties.  we may have to apply runtime consolidation to get the
@@ -101,7 +167,7 @@ func alignRequests(now, from, to uint32, reqs []models.Req) ([]models.Req, uint3
 	// the request by reading from an archive instead (i.e. whether it has the correct interval.
 	// the TTL of lower resolution archives is always assumed to be at least as long so we don't have to check that)
 
-	var pointsFetch uint32
+	var pointsFetch, pointsReturn uint32
 	for i := range reqs {
 		req := &reqs[i]
 		if req.ArchInterval == interval {
@@ -139,13 +205,9 @@ func alignRequests(now, from, to uint32, reqs []models.Req) ([]models.Req, uint3
 				req.AggNum = interval / req.ArchInterval
 			}
 		}
-		pointsFetch += tsRange / req.ArchInterval
-		reqRenderChosenArchive.Value(req.Archive)
+		pointsFetch += (req.To - req.From) / req.ArchInterval
+		pointsReturn += (req.To - req.From) / interval
 	}
 
-	pointsReturn := uint32(len(reqs)) * tsRange / interval
-	reqRenderPointsFetched.ValueUint32(pointsFetch)
-	reqRenderPointsReturned.ValueUint32(pointsReturn)
-
-	return reqs, pointsFetch, pointsReturn, nil
+	return interval, pointsFetch, pointsReturn, nil
 }
@@ -28,7 +28,7 @@ func testAlign(reqs []models.Req, retentions [][]conf.Retention, outReqs []model
 	}
 
 	mdata.Schemas = conf.NewSchemas(schemas)
-	out, _, _, err := alignRequests(now, reqs[0].From, reqs[0].To, reqs)
+	out, _, _, err := alignRequests(now, reqs)
 	if err != outErr {
 		t.Errorf("different err value expected: %v, got: %v", outErr, err)
 	}
@@ -90,6 +90,29 @@ func TestAlignRequestsBasicDiff(t *testing.T) {
 	)
 }
 
+// 2 series requested with different time ranges (e.g. due to timeShift). req 1200-3600 and 0-2400. now 3600.
+// the raw archive of ttl=3000 suffices for the first, but not for the second, so both use the rollup
+func TestAlignRequestsDifferentRanges(t *testing.T) {
+	testAlign([]models.Req{
+		reqRaw("a", 1200, 3600, 800, 60, consolidation.Avg, 0, 0),
+		reqRaw("a", 0, 2400, 800, 60, consolidation.Avg, 0, 0),
+	},
+		[][]conf.Retention{
+			{
+				conf.NewRetentionMT(60, 3000, 0, 0, true),
+				conf.NewRetentionMT(120, 7200, 0, 0, true),
+			},
+		},
+		[]models.Req{
+			reqOut("a", 1200, 3600, 800, 60, consolidation.Avg, 0, 0, 1, 120, 7200, 120, 1),
+			reqOut("a", 0, 2400, 800, 60, consolidation.Avg, 0, 0, 1, 120, 7200, 120, 1),
+		},
+		nil,
+		3600,
+		t,
+	)
+}
+
 // 2 series requested with different raw intervals from different schemas. req 0-30. now 1200. their archives of ttl=1200 do it, but needs normalizing
 // (real example seen with alerting queries)
 func TestAlignRequestsAlerting(t *testing.T) {
@@ -430,7 +453,7 @@ func testMaxPointsPerReq(maxPointsSoft, maxPointsHard int, reqs []models.Req, t
 		}),
 	}})
 
-	out, _, _, err := alignRequests(30*day, reqs[0].From, reqs[0].To, reqs)
+	out, _, _, err := alignRequests(30*day, reqs)
 	maxPointsPerReqSoft = origMaxPointsPerReqSoft
 	maxPointsPerReqHard = origMaxPointsPerReqHard
 	return out, err
@@ -480,6 +503,41 @@ func TestMaxPointsPerReqHardLimit(t *testing.T) {
 	}
 }
 
+// the pre-window of functions such as movingAverage counts towards the limits.
+// it is first assumed to be 24 points of 1s, and then 24 points of 3600s, which exceeds the hard limit
+func TestPrePointsHardLimit(t *testing.T) {
+	reqs := []models.Req{
+		reqOut("a", 29*day, 30*day, 30*day, 1, consolidation.Avg, 0, 0, 0, 1, hour, 1, 1),
+	}
+	_, err := testMaxPointsPerReq(24, 30, reqs, t)
+	if err != nil {
+		t.Fatalf("expected to get no error without pre-window, got %v", err)
+	}
+	reqs[0].From = 29 * day
+	reqs[0].PrePoints = 24
+	_, err = testMaxPointsPerReq(24, 30, reqs, t)
+	if err != errMaxPointsPerReq {
+		t.Fatalf("expected to get an error, got %v", err)
+	}
+}
+
+// the pre-window counts towards the TTL the archive must have. 2 days of 1s points exceeds the TTL of the raw archive,
+// and 2 days of 60s points exceeds the time since 0, so the request is clamped to 0, which requires the last archive.
+func TestPrePointsTTL(t *testing.T) {
+	req := reqOut("a", 29*day, 30*day, 30*day, 1, consolidation.Avg, 0, 0, 0, 1, hour, 1, 1)
+	req.PrePoints = 2 * day
+	out, err := testMaxPointsPerReq(0, 0, []models.Req{req}, t)
+	if err != nil {
+		t.Fatalf("expected to get no error, got %v", err)
+	}
+	if out[0].From != 0 {
+		t.Errorf("expected from %d, but got %d", 0, out[0].From)
+	}
+	if out[0].Archive != 2 {
+		t.Errorf("expected archive %d, but got archive %d", 2, out[0].Archive)
+	}
+}
+
 var result []models.Req
 
 func BenchmarkAlignRequests(b *testing.B) {
@@ -523,7 +581,7 @@ func BenchmarkAlignRequests(b *testing.B) {
 	})
 
 	for n := 0; n < b.N; n++ {
-		res, _, _, _ = alignRequests(14*24*3600, 0, 3600*24*7, reqs)
+		res, _, _, _ = alignRequests(14*24*3600, reqs)
 	}
 	result = res
 }
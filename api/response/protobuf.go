@@ -0,0 +1,51 @@
+package response
+
+import (
+	"github.com/golang/snappy"
+)
+
+type ProtobufMarshaler interface {
+	Marshal() []byte
+}
+
+// SnappyProtobuf is a snappy compressed protocol buffer message, as used by the prometheus remote storage protocols
+type SnappyProtobuf struct {
+	code int
+	body ProtobufMarshaler
+	buf  []byte
+}
+
+func NewSnappyProtobuf(code int, body ProtobufMarshaler) *SnappyProtobuf {
+	return &SnappyProtobuf{
+		code: code,
+		body: body,
+		buf:  BufferPool.Get(),
+	}
+}
+
+func (r *SnappyProtobuf) Code() int {
+	return r.code
+}
+
+func (r *SnappyProtobuf) Close() {
+	BufferPool.Put(r.buf)
+}
+
+func (r *SnappyProtobuf) Body() ([]byte, error) {
+	msg := r.body.Marshal()
+	// snappy only encodes into the given buffer if it is long enough
+	n := snappy.MaxEncodedLen(len(msg))
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = snappy.Encode(r.buf[:n], msg)
+	return r.buf, nil
+}
+
+func (r *SnappyProtobuf) Headers() (headers map[string]string) {
+	headers = map[string]string{
+		"content-type":     "application/x-protobuf",
+		"content-encoding": "snappy",
+	}
+	return headers
+}
@@ -49,10 +49,18 @@ func (s *Server) RegisterRoutes() {
 
 	// Graphite endpoints
 	r.Combo("/render", cBody, withOrg, ready, bind(models.GraphiteRender{})).Get(s.renderMetrics).Post(s.renderMetrics)
+	r.Combo("/explain", withOrg, ready, bind(models.GraphiteRender{})).Get(s.explainRender).Post(s.explainRender)
 	r.Combo("/metrics/find", withOrg, ready, bind(models.GraphiteFind{})).Get(s.metricsFind).Post(s.metricsFind)
 	r.Get("/metrics/index.json", withOrg, ready, s.metricsIndex)
 	r.Post("/metrics/delete", withOrg, ready, bind(models.MetricsDelete{}), s.metricsDelete)
 	r.Combo("/metrics/tags", withOrg, ready, bind(models.GraphiteTags{})).Get(s.graphiteTags).Post(s.graphiteTags)
 	r.Combo("/metrics/tags/:tag([0-9a-zA-Z]+)", withOrg, ready, bind(models.GraphiteTagDetails{})).Get(s.graphiteTagDetails).Post(s.graphiteTagDetails)
 	r.Combo("/metrics/tags/findSeries", withOrg, ready, bind(models.GraphiteTagFindSeries{})).Get(s.graphiteTagFindSeries).Post(s.graphiteTagFindSeries)
+	r.Get("/functions", s.graphiteFunctions)
+	r.Get("/functions/:func", s.graphiteFunctions)
+
+	// Prometheus endpoints
+	r.Post("/api/v1/read", withOrg, ready, s.prometheusRead)
+	r.Combo("/api/v1/query", withOrg, ready, bind(models.PrometheusQuery{})).Get(s.prometheusQuery).Post(s.prometheusQuery)
+	r.Combo("/api/v1/query_range", withOrg, ready, bind(models.PrometheusQueryRange{})).Get(s.prometheusQueryRange).Post(s.prometheusQueryRange)
 }
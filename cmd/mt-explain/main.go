@@ -17,6 +17,7 @@ func main() {
 	to := flag.String("to", "now", "get data until (exclusive)")
 	mdp := flag.Int("mdp", 800, "max data points to return")
 	timeZoneStr := flag.String("time-zone", "local", "time-zone to use for interpreting from/to when needed. (check your config)")
+	macrosFile := flag.String("macros-file", "", "path to a file with macro definitions to expand. (check your config)")
 
 	flag.Usage = func() {
 		fmt.Println("mt-explain")
@@ -62,13 +63,21 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if *macrosFile != "" {
+		macros, err := expr.ReadMacros(*macrosFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		expr.SetMacros(macros)
+	}
+
 	exps, err := expr.ParseMany(targets)
 	if err != nil {
 		fmt.Println("Error while parsing:", err)
 		return
 	}
 
-	plan, err := expr.NewPlan(exps, fromUnix, toUnix, uint32(*mdp), *stable, nil)
+	plan, err := expr.NewPlan(exps, fromUnix, toUnix, uint32(*mdp), *stable, loc, nil)
 	if err != nil {
 		if fun, ok := err.(expr.ErrUnknownFunction); ok {
 			fmt.Printf("Unsupported function %q: must defer query to graphite\n", string(fun))
@@ -0,0 +1,80 @@
+package expr
+
+import "time"
+
+const secondsPerDay = 24 * 60 * 60
+
+// bucketer assigns timestamps to consecutive buckets of a given size.
+// unless alignToFrom is set, buckets are aligned to the calendar of the given location,
+// such that e.g. daily buckets start at local midnight rather than at UTC midnight.
+// buckets of a whole number of days follow the local calendar, taking daylight saving time into account.
+// like in graphite, they are aligned relative to 1970-01-01, e.g. weekly buckets start on Thursday.
+// shorter buckets are aligned using the zone offset at the start of the range.
+type bucketer struct {
+	interval    uint32
+	loc         *time.Location
+	from        uint32 // start of the range, used for alignToFrom and to determine the zone offset
+	alignToFrom bool
+	offset      int64 // zone offset at from, in seconds east of UTC
+}
+
+func newBucketer(interval uint32, loc *time.Location, from uint32, alignToFrom bool) bucketer {
+	_, offset := time.Unix(int64(from), 0).In(loc).Zone()
+	return bucketer{
+		interval:    interval,
+		loc:         loc,
+		from:        from,
+		alignToFrom: alignToFrom,
+		offset:      int64(offset),
+	}
+}
+
+// index returns the number of the bucket the given timestamp falls into
+func (b bucketer) index(ts uint32) int64 {
+	switch {
+	case b.alignToFrom:
+		return floorDiv(int64(ts)-int64(b.from), int64(b.interval))
+	case b.interval%secondsPerDay == 0:
+		y, m, d := time.Unix(int64(ts), 0).In(b.loc).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+		return floorDiv(day, int64(b.interval/secondsPerDay))
+	}
+	return floorDiv(int64(ts)+b.offset, int64(b.interval))
+}
+
+// start returns the timestamp at which the bucket with the given number starts
+func (b bucketer) start(i int64) uint32 {
+	switch {
+	case b.alignToFrom:
+		return uint32(int64(b.from) + i*int64(b.interval))
+	case b.interval%secondsPerDay == 0:
+		days := i * int64(b.interval/secondsPerDay)
+		return uint32(time.Date(1970, 1, 1+int(days), 0, 0, 0, 0, b.loc).Unix())
+	}
+	return uint32(i*int64(b.interval) - b.offset)
+}
+
+// floorDiv divides a by b, rounding towards negative infinity
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// alignToCalendar returns the start of the day, hour or minute that ts falls into in the given location,
+// depending on whether interval spans at least a day, an hour or a minute. like graphite's hitcount does.
+func alignToCalendar(ts, interval uint32, loc *time.Location) uint32 {
+	t := time.Unix(int64(ts), 0).In(loc)
+	y, m, d := t.Date()
+	switch {
+	case interval >= secondsPerDay:
+		t = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case interval >= 60*60:
+		t = time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case interval >= 60:
+		t = time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	}
+	return uint32(t.Unix())
+}
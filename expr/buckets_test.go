@@ -0,0 +1,31 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketerDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data not available: %s", err)
+	}
+	march11 := uint32(1520744400) // 2018-03-11 00:00 EST, the day daylight saving time starts
+	march12 := uint32(1520827200) // 2018-03-12 00:00 EDT, only 23 hours later
+	b := newBucketer(24*3600, loc, march11, false)
+	cases := []struct {
+		ts  uint32
+		exp uint32
+	}{
+		{march11, march11},
+		{march11 + 12*3600, march11},
+		{march12 - 1, march11},
+		{march12, march12},
+		{march12 + 23*3600, march12},
+	}
+	for _, c := range cases {
+		if got := b.start(b.index(c.ts)); got != c.exp {
+			t.Errorf("bucket of %d: expected start %d, got %d", c.ts, c.exp, got)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package expr
 
 import (
 	"math"
+	"testing"
 
+	"github.com/grafana/metrictank/api/models"
 	"gopkg.in/raintank/schema.v1"
 )
 
@@ -139,3 +141,54 @@ func getCopy(in []schema.Point) []schema.Point {
 	copy(out, in)
 	return out
 }
+
+// getTransformTestInput returns the input for the tests of functions that transform each point of a series
+func getTransformTestInput() []models.Series {
+	return []models.Series{
+		{
+			Target:    "a",
+			QueryPatt: "a",
+			Interval:  10,
+			Datapoints: []schema.Point{
+				{Val: -4, Ts: 10},
+				{Val: 0, Ts: 20},
+				{Val: math.NaN(), Ts: 30},
+				{Val: 4, Ts: 40},
+				{Val: 16, Ts: 50},
+			},
+		},
+	}
+}
+
+// checkPoints compares the points of the given series against the expected ones
+func checkPoints(name string, got []models.Series, expTarget string, exp []schema.Point, t *testing.T) {
+	if len(got) != 1 {
+		t.Fatalf("%s: expected 1 output series, got %d", name, len(got))
+	}
+	if got[0].Target != expTarget {
+		t.Errorf("%s: expected target %q, got %q", name, expTarget, got[0].Target)
+	}
+	if len(got[0].Datapoints) != len(exp) {
+		t.Fatalf("%s: expected %d points, got %d", name, len(exp), len(got[0].Datapoints))
+	}
+	for i, p := range got[0].Datapoints {
+		bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp[i].Val)
+		if p.Ts != exp[i].Ts || (!bothNaN && p.Val != exp[i].Val) {
+			t.Errorf("%s: point %d: expected %v, got %v", name, i, exp[i], p)
+		}
+	}
+}
+
+// testTransform executes the given function, which should have the transform test input as input,
+// and compares the values of its output against the expected ones
+func testTransform(name string, f GraphiteFunc, expTarget string, exp []float64, t *testing.T) {
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("%s: err should be nil. got %q", name, err)
+	}
+	points := make([]schema.Point, 0, len(exp))
+	for i, val := range exp {
+		points = append(points, schema.Point{Val: val, Ts: uint32(i+1) * 10})
+	}
+	checkPoints(name, got, expTarget, points, t)
+}
@@ -0,0 +1,67 @@
+package expr
+
+import "github.com/grafana/metrictank/api/models"
+
+// dedup tracks the function calls planned so far, so that identical subexpressions
+// within and across the targets of a request are only computed once
+type dedup struct {
+	funcs   map[dedupKey]*sharedFunc
+	nodes   int // number of function calls and series requests planned
+	deduped int // how many of those were identical to one planned before
+	// the tag expressions of the planned seriesByTag requests, by query
+	tagQueries map[string][]string
+}
+
+// dedupKey identifies a function call: the same expression with a different context
+// (e.g. within a timeShift) needs different data, and thus is a different computation
+type dedupKey struct {
+	expr    string
+	context Context
+}
+
+func newDedup() *dedup {
+	return &dedup{
+		funcs:      make(map[dedupKey]*sharedFunc),
+		tagQueries: make(map[string][]string),
+	}
+}
+
+// sharedFunc wraps a function that may be the input of multiple functions,
+// such that it is only executed once per run of the plan
+type sharedFunc struct {
+	GraphiteFunc
+	done bool
+	out  []models.Series
+	err  error
+}
+
+func (s *sharedFunc) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	if !s.done {
+		s.out, s.err = s.GraphiteFunc.Exec(cache)
+		s.done = true
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	// functions like alias modify the series they get (though not their datapoints),
+	// so each caller gets its own copy
+	out := make([]models.Series, len(s.out))
+	copy(out, s.out)
+	return out, nil
+}
+
+// reset discards the output of a previous run
+func (s *sharedFunc) reset() {
+	s.done = false
+	s.out = nil
+	s.err = nil
+}
+
+func containsReq(reqs []Req, req Req) bool {
+	for _, r := range reqs {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/consolidation"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestPlanDedup(t *testing.T) {
+	cases := []struct {
+		targets    []string
+		expReqs    int
+		expNodes   int
+		expDeduped int
+	}{
+		{[]string{"a.*", "a.*"}, 1, 2, 1},
+		{[]string{"asPercent(sumSeries(a.*), sumSeries(a.*))"}, 1, 4, 1},
+		// keyword args and whitespace don't matter
+		{[]string{"groupByNode(a.*, 0, callback='sum')", "groupByNode( a.*,0,callback='sum' )"}, 1, 3, 1},
+		// the same expression with a different time range is a different computation
+		{[]string{"sumSeries(a.*)", "movingAverage(sumSeries(a.*), '1min')"}, 2, 5, 0},
+		{[]string{"sumSeries(a.*)", "alias(sumSeries(a.*), 'x')", "sumSeries(a.*)"}, 1, 5, 2},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany(c.targets)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		plan, err := NewPlan(exprs, 1000, 2000, 800, true, nil, nil)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if len(plan.Reqs) != c.expReqs || plan.Nodes != c.expNodes || plan.Deduped != c.expDeduped {
+			t.Fatalf("case %d: expected %d reqs, %d nodes and %d deduped, got %d reqs, %d nodes and %d deduped",
+				i, c.expReqs, c.expNodes, c.expDeduped, len(plan.Reqs), plan.Nodes, plan.Deduped)
+		}
+	}
+}
+
+// TestPlanDedupRun verifies that the output of shared subexpressions is computed once,
+// and that functions using it, as well as runtime consolidation, don't affect each other
+func TestPlanDedupRun(t *testing.T) {
+	exprs, err := ParseMany([]string{"sumSeries(a.*)", "alias(sumSeries(a.*), 'x')", "sumSeries(a.*)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(exprs, 10, 50, 2, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := func() []schema.Point {
+		return []schema.Point{{Val: 1, Ts: 10}, {Val: 2, Ts: 20}, {Val: 3, Ts: 30}, {Val: 4, Ts: 40}}
+	}
+	input := map[Req][]models.Series{
+		plan.Reqs[0]: {
+			{Target: "a.b", QueryPatt: "a.*", Interval: 10, Consolidator: consolidation.Avg, Datapoints: points()},
+			{Target: "a.c", QueryPatt: "a.*", Interval: 10, Consolidator: consolidation.Avg, Datapoints: points()},
+		},
+	}
+	out, err := plan.Run(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []schema.Point{{Val: 3, Ts: 20}, {Val: 7, Ts: 40}}
+	checkPoints("first", out[0:1], "sumSeries(a.*)", exp, t)
+	checkPoints("alias", out[1:2], "x", exp, t)
+	checkPoints("last", out[2:3], "sumSeries(a.*)", exp, t)
+}
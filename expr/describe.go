@@ -0,0 +1,242 @@
+package expr
+
+import "strings"
+
+// graphite's parameter types for string arguments that are more specific than a string
+const (
+	paramInterval = "interval"
+	paramDate     = "date"
+	paramAggFunc  = "aggFunc"
+)
+
+// the module that graphite's /functions api reports for its builtin functions, which we implement natively.
+// macros are specific to metrictank, so they are reported under their own module and group.
+const (
+	funcModule  = "graphite.render.functions"
+	macroModule = "metrictank.macros"
+	macroGroup  = "Macro"
+)
+
+// FuncDesc describes a function, in the format of graphite's /functions api
+type FuncDesc struct {
+	Name        string      `json:"name"`
+	Function    string      `json:"function"` // the call signature, e.g. "summarize(seriesList, intervalString, func, alignToFrom)"
+	Description string      `json:"description"`
+	Module      string      `json:"module"`
+	Group       string      `json:"group"` // the category of the function, like in graphite, e.g. Combine or Transform
+	Params      []ParamDesc `json:"params"`
+	Stable      bool        `json:"stable"`          // unstable functions are only executed natively if process=all is requested
+	Macro       string      `json:"macro,omitempty"` // for macros, the body they expand into
+}
+
+// ParamDesc describes a function parameter, in the format of graphite's /functions api
+type ParamDesc struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // one of graphite's parameter types, e.g. seriesList, integer, interval or aggFunc
+	Required bool   `json:"required"`
+	Multiple bool   `json:"multiple"` // whether the parameter can be repeated, like the series lists of sumSeries
+}
+
+// Describe returns the descriptions of all natively supported functions and macros, keyed by function name
+func Describe() map[string]FuncDesc {
+	macros := getMacros()
+	out := make(map[string]FuncDesc, len(funcs)+len(macros))
+	for name, fdef := range funcs {
+		out[name] = describeFunc(name, fdef)
+	}
+	for name, m := range macros {
+		out[name] = describeMacro(m)
+	}
+	return out
+}
+
+// describeMacro describes a macro. as its parameters are substituted as given, they can be of any type.
+func describeMacro(m Macro) FuncDesc {
+	desc := FuncDesc{
+		Name:        m.Name,
+		Function:    m.Name + "(" + strings.Join(m.Params, ", ") + ")",
+		Description: "Expands into " + m.Body,
+		Module:      macroModule,
+		Group:       macroGroup,
+		Params:      []ParamDesc{},
+		Stable:      true,
+		Macro:       m.Body,
+	}
+	for _, p := range m.Params {
+		desc.Params = append(desc.Params, ParamDesc{Name: p, Type: "any", Required: true})
+	}
+	return desc
+}
+
+func describeFunc(name string, fdef funcDef) FuncDesc {
+	info := funcInfos[name]
+	desc := FuncDesc{
+		Name:        name,
+		Description: info.description,
+		Module:      funcModule,
+		Group:       info.group,
+		Params:      []ParamDesc{},
+		Stable:      fdef.stable,
+	}
+	args, _ := fdef.constr().Signature()
+	params := make([]string, 0, len(args))
+	for _, arg := range args {
+		param := describeArg(arg)
+		desc.Params = append(desc.Params, param)
+		if param.Multiple {
+			params = append(params, "*"+param.Name)
+		} else {
+			params = append(params, param.Name)
+		}
+	}
+	desc.Function = name + "(" + strings.Join(params, ", ") + ")"
+	return desc
+}
+
+func describeArg(arg Arg) ParamDesc {
+	param := ParamDesc{
+		Name:     argKey(arg),
+		Required: !arg.Optional(),
+	}
+	switch a := arg.(type) {
+	case ArgSeries:
+		param.Type = "seriesList"
+	case ArgSeriesList:
+		param.Type = "seriesList"
+	case ArgSeriesLists:
+		param.Type = "seriesList"
+		param.Multiple = true
+	case ArgInt:
+		param.Type = "integer"
+	case ArgInts:
+		param.Type = "integer"
+		param.Multiple = true
+	case ArgFloat:
+		param.Type = "float"
+	case ArgString:
+		param.Type = "string"
+		if a.typ != "" {
+			param.Type = a.typ
+		}
+	case ArgStrings:
+		param.Type = "string"
+		param.Multiple = true
+	case ArgStringsOrInts:
+		param.Type = "nodeOrTag"
+		param.Multiple = true
+	case ArgRegex:
+		param.Type = "string"
+	case ArgBool:
+		param.Type = "boolean"
+	case ArgIn:
+		param.Type = "any"
+		if len(a.args) == 2 {
+			if _, ok := a.args[0].(ArgInt); ok && describeArg(a.args[1]).Type == paramInterval {
+				param.Type = "intOrInterval"
+			}
+		}
+	}
+	return param
+}
+
+// funcInfo documents a function, like graphite's /functions api does
+type funcInfo struct {
+	group       string
+	description string
+}
+
+// funcInfos documents every function in funcs, keyed by name
+var funcInfos = map[string]funcInfo{
+	"absolute":                   {"Transform", "Applies the mathematical abs function to each datapoint."},
+	"aggregate":                  {"Combine", "Aggregates the series into a single series, using the given aggregation function."},
+	"alias":                      {"Alias", "Sets the name of the series."},
+	"aliasByNode":                {"Alias", "Sets the name of the series to the given nodes of its name, joined by dots."},
+	"aliasByTags":                {"Alias", "Sets the name of the series to the given nodes of its name or values of its tags, joined by dots."},
+	"aliasSub":                   {"Alias", "Sets the name of the series by replacing the given regular expression in it."},
+	"asPercent":                  {"Combine", "Calculates each series as a percentage of the total, or of the given series."},
+	"averageAbove":               {"Filter Series", "Keeps the series whose average is above n."},
+	"averageBelow":               {"Filter Series", "Keeps the series whose average is below or equal to n."},
+	"avg":                        {"Combine", "Averages the series into a single series. Alias of averageSeries."},
+	"averageSeries":              {"Combine", "Averages the series into a single series."},
+	"consolidateBy":              {"Special", "Sets the function used to consolidate the points, when there are more than maxDataPoints."},
+	"countSeries":                {"Combine", "Counts the series, as a single series."},
+	"currentAbove":               {"Filter Series", "Keeps the series whose last value is above n."},
+	"currentBelow":               {"Filter Series", "Keeps the series whose last value is below or equal to n."},
+	"delay":                      {"Transform", "Shifts all values by the given number of steps, leaving nulls at the start."},
+	"derivative":                 {"Transform", "Calculates the difference between each value and the previous one."},
+	"diffSeries":                 {"Combine", "Subtracts the series from the first one, as a single series."},
+	"divideSeries":               {"Combine", "Divides the series by the divisor series."},
+	"divideSeriesLists":          {"Combine", "Divides each series by the series at the same position in the divisor list."},
+	"exclude":                    {"Filter Series", "Removes the series whose name matches the regular expression."},
+	"filterSeries":               {"Filter Series", "Keeps the series for which the given summary of their values matches the comparison."},
+	"grep":                       {"Filter Series", "Keeps the series whose name matches the regular expression."},
+	"groupByNode":                {"Combine", "Groups the series by the given node of their name, and aggregates each group into a single series."},
+	"groupByNodes":               {"Combine", "Groups the series by the given nodes of their name, and aggregates each group into a single series."},
+	"groupByTags":                {"Combine", "Groups the series by the given tags, and aggregates each group into a single series."},
+	"highest":                    {"Filter Series", "Keeps the n series with the highest summary of their values."},
+	"highestAverage":             {"Filter Series", "Keeps the n series with the highest average."},
+	"highestCurrent":             {"Filter Series", "Keeps the n series with the highest last value."},
+	"highestMax":                 {"Filter Series", "Keeps the n series with the highest maximum."},
+	"hitcount":                   {"Transform", "Estimates the number of hits in each interval, of series that are rates per second."},
+	"holtWintersAberration":      {"Calculate", "Calculates how far the values are outside of the Holt-Winters confidence bands."},
+	"holtWintersConfidenceBands": {"Calculate", "Calculates the upper and lower Holt-Winters confidence bands."},
+	"holtWintersForecast":        {"Calculate", "Calculates a Holt-Winters forecast, based on the previous values."},
+	"integral":                   {"Transform", "Calculates the running total of the values."},
+	"invert":                     {"Transform", "Calculates the inverse, 1/x, of each value."},
+	"keepLastValue":              {"Transform", "Replaces nulls by the last non-null value, up to limit nulls in a row."},
+	"limit":                      {"Filter Series", "Keeps the first n series."},
+	"logarithm":                  {"Transform", "Calculates the logarithm of each value, in the given base."},
+	"log":                        {"Transform", "Calculates the logarithm of each value, in the given base. Alias of logarithm."},
+	"lowest":                     {"Filter Series", "Keeps the n series with the lowest summary of their values."},
+	"lowestAverage":              {"Filter Series", "Keeps the n series with the lowest average."},
+	"lowestCurrent":              {"Filter Series", "Keeps the n series with the lowest last value."},
+	"max":                        {"Combine", "Takes the maximum of the series at each point, as a single series. Alias of maxSeries."},
+	"maxSeries":                  {"Combine", "Takes the maximum of the series at each point, as a single series."},
+	"maximumAbove":               {"Filter Series", "Keeps the series whose maximum is above n."},
+	"maximumBelow":               {"Filter Series", "Keeps the series whose maximum is below or equal to n."},
+	"medianSeries":               {"Combine", "Takes the median of the series at each point, as a single series."},
+	"min":                        {"Combine", "Takes the minimum of the series at each point, as a single series. Alias of minSeries."},
+	"minSeries":                  {"Combine", "Takes the minimum of the series at each point, as a single series."},
+	"minMax":                     {"Transform", "Normalizes the values to the range 0 to 1, based on their minimum and maximum."},
+	"minimumAbove":               {"Filter Series", "Keeps the series whose minimum is above n."},
+	"minimumBelow":               {"Filter Series", "Keeps the series whose minimum is below or equal to n."},
+	"movingAverage":              {"Calculate", "Calculates the average over a moving window of points or time."},
+	"movingMax":                  {"Calculate", "Calculates the maximum over a moving window of points or time."},
+	"movingMedian":               {"Calculate", "Calculates the median over a moving window of points or time."},
+	"movingMin":                  {"Calculate", "Calculates the minimum over a moving window of points or time."},
+	"movingSum":                  {"Calculate", "Calculates the sum over a moving window of points or time."},
+	"movingWindow":               {"Calculate", "Applies the given aggregation function over a moving window of points or time."},
+	"multiplySeries":             {"Combine", "Multiplies the series at each point, as a single series."},
+	"nPercentile":                {"Calculate", "Replaces the values by their nth percentile."},
+	"nonNegativeDerivative":      {"Transform", "Calculates the difference between each value and the previous one, ignoring decreases, like counter resets."},
+	"offset":                     {"Transform", "Adds the given constant to each value."},
+	"offsetToZero":               {"Transform", "Subtracts the minimum from each value, so that the series starts at 0."},
+	"perSecond":                  {"Transform", "Calculates the rate of change per second, ignoring decreases, like counter resets."},
+	"percentileOfSeries":         {"Combine", "Takes the nth percentile of the series at each point, as a single series."},
+	"pow":                        {"Transform", "Raises each value to the given power."},
+	"powSeries":                  {"Combine", "Raises the first series to the power of the following ones at each point, as a single series."},
+	"rangeOfSeries":              {"Combine", "Takes the range, maximum minus minimum, of the series at each point, as a single series."},
+	"rangeSeries":                {"Combine", "Takes the range, maximum minus minimum, of the series at each point, as a single series. Alias of rangeOfSeries."},
+	"removeAbovePercentile":      {"Filter Data", "Replaces the values above the nth percentile of each series by null."},
+	"removeAboveValue":           {"Filter Data", "Replaces the values above n by null."},
+	"removeBelowPercentile":      {"Filter Data", "Replaces the values below the nth percentile of each series by null."},
+	"removeBelowValue":           {"Filter Data", "Replaces the values below n by null."},
+	"removeEmptySeries":          {"Filter Series", "Removes the series that only have nulls."},
+	"scale":                      {"Transform", "Multiplies each value by the given constant."},
+	"seriesByTag":                {"Special", "Fetches the series whose tags match all of the given tag expressions."},
+	"smartSummarize":             {"Transform", "Summarizes the values into buckets of the given interval, aligned to the start of the time range."},
+	"sortBy":                     {"Sorting", "Sorts the series by the given summary of their values."},
+	"sortByMaxima":               {"Sorting", "Sorts the series by their maximum, in descending order."},
+	"sortByMinima":               {"Sorting", "Sorts the series by their minimum, in ascending order."},
+	"sortByName":                 {"Sorting", "Sorts the series by their name."},
+	"sortByTotal":                {"Sorting", "Sorts the series by their sum, in descending order."},
+	"squareRoot":                 {"Transform", "Calculates the square root of each value."},
+	"stddevSeries":               {"Combine", "Takes the standard deviation of the series at each point, as a single series."},
+	"sum":                        {"Combine", "Sums the series at each point, as a single series. Alias of sumSeries."},
+	"sumSeries":                  {"Combine", "Sums the series at each point, as a single series."},
+	"summarize":                  {"Transform", "Summarizes the values into buckets of the given interval."},
+	"timeShift":                  {"Transform", "Shows the values of the given time ago."},
+	"timeSlice":                  {"Transform", "Keeps the values between the given start and end times, replacing the others by null."},
+	"timeStack":                  {"Transform", "Shows the values of several consecutive periods ago, as a series per period."},
+	"transformNull":              {"Transform", "Replaces nulls by the given value."},
+}
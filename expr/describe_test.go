@@ -0,0 +1,68 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	descs := Describe()
+	if len(descs) != len(funcs) {
+		t.Fatalf("expected %d functions, got %d", len(funcs), len(descs))
+	}
+	cases := []FuncDesc{
+		{
+			Name:        "sumSeries",
+			Function:    "sumSeries(*seriesLists)",
+			Description: "Sums the series at each point, as a single series.",
+			Module:      "graphite.render.functions",
+			Group:       "Combine",
+			Params: []ParamDesc{
+				{Name: "seriesLists", Type: "seriesList", Required: true, Multiple: true},
+			},
+			Stable: true,
+		},
+		{
+			Name:        "summarize",
+			Function:    "summarize(seriesList, intervalString, func, alignToFrom)",
+			Description: "Summarizes the values into buckets of the given interval.",
+			Module:      "graphite.render.functions",
+			Group:       "Transform",
+			Params: []ParamDesc{
+				{Name: "seriesList", Type: "seriesList", Required: true},
+				{Name: "intervalString", Type: "interval", Required: true},
+				{Name: "func", Type: "aggFunc"},
+				{Name: "alignToFrom", Type: "boolean"},
+			},
+			Stable: true,
+		},
+		{
+			Name:        "movingWindow",
+			Function:    "movingWindow(seriesList, windowSize, func, xFilesFactor)",
+			Description: "Applies the given aggregation function over a moving window of points or time.",
+			Module:      "graphite.render.functions",
+			Group:       "Calculate",
+			Params: []ParamDesc{
+				{Name: "seriesList", Type: "seriesList", Required: true},
+				{Name: "windowSize", Type: "intOrInterval", Required: true},
+				{Name: "func", Type: "aggFunc"},
+				{Name: "xFilesFactor", Type: "float"},
+			},
+			Stable: true,
+		},
+	}
+	for _, exp := range cases {
+		got := descs[exp.Name]
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("%s: expected %+v, got %+v", exp.Name, exp, got)
+		}
+	}
+	for name, desc := range descs {
+		if desc.Group == "" || desc.Description == "" {
+			t.Fatalf("%s: expected a group and a description, got %+v", name, desc)
+		}
+	}
+	if descs["smartSummarize"].Stable {
+		t.Fatalf("smartSummarize should be described as unstable")
+	}
+}
@@ -0,0 +1,120 @@
+package expr
+
+import (
+	"sort"
+	"strings"
+)
+
+// expand returns the expression with all calls to macros and template() replaced by their expansions.
+// vars are the variables for template() that override those specified in the calls.
+func expand(e *expr, macros map[string]Macro, vars map[string]string, depth int) (*expr, error) {
+	if e.etype != etFunc {
+		return e, nil
+	}
+	if m, ok := macros[e.str]; ok {
+		if depth >= maxMacroDepth {
+			return nil, errAt{e.pos, ErrMacroDepth}
+		}
+		out, err := m.expandCall(e)
+		if err != nil {
+			return nil, atPos(e.pos, err)
+		}
+		out, err = expand(out, macros, vars, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		out.expanded = m.Name
+		return out, nil
+	}
+	if e.str == "template" {
+		out, err := expandTemplate(e, vars)
+		if err != nil {
+			return nil, atPos(e.pos, err)
+		}
+		return expand(out, macros, vars, depth)
+	}
+	var expanded bool
+	for i, arg := range e.args {
+		out, err := expand(arg, macros, vars, depth)
+		if err != nil {
+			return nil, err
+		}
+		expanded = expanded || out != arg
+		e.args[i] = out
+	}
+	for key, arg := range e.namedArgs {
+		out, err := expand(arg, macros, vars, depth)
+		if err != nil {
+			return nil, err
+		}
+		expanded = expanded || out != arg
+		e.namedArgs[key] = out
+	}
+	if expanded {
+		e.argsStr = e.argsTarget()
+	}
+	return e, nil
+}
+
+// setPos sets the position of the expression and all its arguments
+func (e *expr) setPos(pos int) {
+	e.pos = pos
+	for _, arg := range e.args {
+		arg.setPos(pos)
+	}
+	for _, arg := range e.namedArgs {
+		arg.setPos(pos)
+	}
+}
+
+// argsTarget formats the arguments of a function call, as they would appear in a graphite target
+func (e expr) argsTarget() string {
+	args := make([]string, 0, len(e.args)+len(e.namedArgs))
+	for _, arg := range e.args {
+		args = append(args, arg.target())
+	}
+	keys := make([]string, 0, len(e.namedArgs))
+	for key := range e.namedArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, key+"="+e.namedArgs[key].target())
+	}
+	return strings.Join(args, ",")
+}
+
+// ExpandedTargets formats the expressions as graphite targets, with any macros and template() calls expanded,
+// as graphite doesn't know our macros, nor the variables we used for template().
+// it returns nil if none of the expressions were expanded.
+func ExpandedTargets(exprs []*expr) []string {
+	var expanded bool
+	for _, e := range exprs {
+		expanded = expanded || e.isExpanded()
+	}
+	if !expanded {
+		return nil
+	}
+	out := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		out = append(out, e.target())
+	}
+	return out
+}
+
+func (e expr) isExpanded() bool {
+	if e.expanded != "" {
+		return true
+	}
+	for _, arg := range e.args {
+		if arg.isExpanded() {
+			return true
+		}
+	}
+	for _, arg := range e.namedArgs {
+		if arg.isExpanded() {
+			return true
+		}
+	}
+	return false
+}
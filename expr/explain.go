@@ -0,0 +1,48 @@
+package expr
+
+// ExplainNode describes a parsed expression, to explain how a request is executed
+type ExplainNode struct {
+	Type         string                 `json:"type"`  // one of func, name, bool, int, float, string, none or list
+	Value        string                 `json:"value"` // the function name, the series pattern or the literal value as specified
+	Native       bool                   `json:"native,omitempty"`
+	ExpandedFrom string                 `json:"expandedFrom,omitempty"` // the macro (or "template") the expression was expanded from, if any
+	Args         []ExplainNode          `json:"args,omitempty"`
+	NamedArgs    map[string]ExplainNode `json:"namedArgs,omitempty"`
+}
+
+// Explain describes the given expressions. for function calls, native tells whether
+// metrictank has the function (taking into account whether only stable functions may be used).
+func Explain(exprs []*expr, stable bool) []ExplainNode {
+	out := make([]ExplainNode, 0, len(exprs))
+	for _, e := range exprs {
+		out = append(out, e.explain(stable))
+	}
+	return out
+}
+
+func (e expr) explain(stable bool) ExplainNode {
+	node := ExplainNode{
+		Value:        e.str,
+		ExpandedFrom: e.expanded,
+	}
+	node.Type = e.etype.desc()
+	switch e.etype {
+	case etList:
+		for _, item := range e.args {
+			node.Args = append(node.Args, item.explain(stable))
+		}
+	case etFunc:
+		fdef, ok := funcs[e.str]
+		node.Native = ok && (fdef.stable || !stable)
+		for _, arg := range e.args {
+			node.Args = append(node.Args, arg.explain(stable))
+		}
+		if len(e.namedArgs) != 0 {
+			node.NamedArgs = make(map[string]ExplainNode, len(e.namedArgs))
+			for key, arg := range e.namedArgs {
+				node.NamedArgs[key] = arg.explain(stable)
+			}
+		}
+	}
+	return node
+}
@@ -0,0 +1,70 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	cases := []struct {
+		target string
+		stable bool
+		exp    ExplainNode
+	}{
+		{
+			"foo.*",
+			true,
+			ExplainNode{Type: "name", Value: "foo.*"},
+		},
+		{
+			"someFunc(sumSeries(foo.*), 'a', 5, key=1.5)",
+			true,
+			ExplainNode{
+				Type:  "func",
+				Value: "someFunc",
+				Args: []ExplainNode{
+					{
+						Type:   "func",
+						Value:  "sumSeries",
+						Native: true,
+						Args:   []ExplainNode{{Type: "name", Value: "foo.*"}},
+					},
+					{Type: "string", Value: "a"},
+					{Type: "int", Value: "5"},
+				},
+				NamedArgs: map[string]ExplainNode{
+					"key": {Type: "float", Value: "1.5"},
+				},
+			},
+		},
+		{
+			"smartSummarize(foo, '1h')",
+			true,
+			ExplainNode{
+				Type:  "func",
+				Value: "smartSummarize",
+				Args:  []ExplainNode{{Type: "name", Value: "foo"}, {Type: "string", Value: "1h"}},
+			},
+		},
+		{
+			"smartSummarize(foo, '1h')",
+			false,
+			ExplainNode{
+				Type:   "func",
+				Value:  "smartSummarize",
+				Native: true,
+				Args:   []ExplainNode{{Type: "name", Value: "foo"}, {Type: "string", Value: "1h"}},
+			},
+		},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		got := Explain(exprs, c.stable)
+		if len(got) != 1 || !reflect.DeepEqual(got[0], c.exp) {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.exp, got)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package expr
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -17,18 +19,46 @@ const (
 	etInt                    // any number with no decimal numbers, parsed as a float64 value
 	etFloat                  // any number with decimals, parsed as a float64 value
 	etString                 // anything that was between '' or ""
+	etNone                   // python's None, which some functions accept to mean "not specified"
+	etList                   // a list of expressions between [], such as [1, 'foo']. lists may be nested
 )
 
+// desc returns a short description of the type, as used in error messages
+func (t exprType) desc() string {
+	switch t {
+	case etName:
+		return "name"
+	case etBool:
+		return "bool"
+	case etFunc:
+		return "func"
+	case etInt:
+		return "int"
+	case etFloat:
+		return "float"
+	case etString:
+		return "string"
+	case etNone:
+		return "none"
+	case etList:
+		return "list"
+	}
+	return t.String()
+}
+
 // expr represents a parsed expression
 type expr struct {
 	etype     exprType
 	float     float64          // for etFloat
 	int       int64            // for etInt
-	str       string           // for etName, etFunc (func name), etString, etBool, etInt and etFloat (unparsed input value)
+	str       string           // for etName, etFunc (func name), etString, etBool, etInt, etFloat, etNone and etList (unparsed input value)
 	bool      bool             // for etBool
-	args      []*expr          // for etFunc: positional args which itself are expressions
+	args      []*expr          // for etFunc: positional args which itself are expressions. for etList: the items
 	namedArgs map[string]*expr // for etFunc: named args which itself are expressions
 	argsStr   string           // for etFunc: literal string of how all the args were specified
+	pos       int              // offset of the expression in its target, for error messages
+	input     string           // for top-level expressions: the target they were parsed from
+	expanded  string           // the name of the macro (or "template") this expression was expanded from, if any
 }
 
 func (e expr) Print(indent int) string {
@@ -51,10 +81,34 @@ func (e expr) Print(indent int) string {
 		return fmt.Sprintf("%sexpr-int %v", space, e.int)
 	case etString:
 		return fmt.Sprintf("%sexpr-string %q", space, e.str)
+	case etNone:
+		return fmt.Sprintf("%sexpr-none", space)
+	case etList:
+		var items string
+		for _, a := range e.args {
+			items += a.Print(indent+2) + ",\n"
+		}
+		return fmt.Sprintf("%sexpr-list [\n%s%s]", space, items, space)
 	}
 	return "HUH-SHOULD-NEVER-HAPPEN"
 }
 
+// isOrdered returns whether the expression uses any function that dictates the order of its output series
+func (e expr) isOrdered() bool {
+	if e.etype != etFunc {
+		return false
+	}
+	if _, ok := orderedFuncs[e.str]; ok {
+		return true
+	}
+	for _, a := range e.args {
+		if a.isOrdered() {
+			return true
+		}
+	}
+	return false
+}
+
 // consumeBasicArg verifies that the argument at given pos matches the expected arg
 // it's up to the caller to assure that given pos is valid before calling.
 // if arg allows for multiple arguments, pos is advanced to cover all accepted arguments.
@@ -62,55 +116,61 @@ func (e expr) Print(indent int) string {
 // appropriate value(s) will be assigned to exp.val
 // for non-basic args, see consumeSeriesArg which should be called after deducing the required from/to.
 // the returned pos is always the index where the next argument should be.
+// errors about a given argument are annotated with its position.
 func (e expr) consumeBasicArg(pos int, exp Arg) (int, error) {
 	got := e.args[pos]
+	if got.etype == etList {
+		return e.consumeList(pos, exp)
+	}
 	switch v := exp.(type) {
 	case ArgSeries, ArgSeriesList:
 		if got.etype != etName && got.etype != etFunc {
-			return 0, ErrBadArgumentStr{"func or name", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
 	case ArgSeriesLists:
 		if got.etype != etName && got.etype != etFunc {
-			return 0, ErrBadArgumentStr{"func or name", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
 		// special case! consume all subsequent args (if any) in args that will also yield a seriesList
 		for len(e.args) > pos+1 && (e.args[pos+1].etype == etName || e.args[pos+1].etype == etFunc) {
 			pos += 1
 		}
 	case ArgInt:
-		if got.etype != etInt {
-			return 0, ErrBadArgumentStr{"int", string(got.etype)}
+		n, ok := got.intValue()
+		if !ok {
+			return 0, got.badArg(exp)
 		}
-		for _, va := range v.validator {
-			if err := va(got); err != nil {
-				return 0, fmt.Errorf("%s: %s", v.key, err.Error())
-			}
+		if err := got.validate(v.key, v.validator); err != nil {
+			return 0, err
 		}
-		*v.val = got.int
+		*v.val = n
 	case ArgInts:
-		if got.etype != etInt {
-			return 0, ErrBadArgumentStr{"int", string(got.etype)}
-		}
-		*v.val = append(*v.val, got.int)
-		// special case! consume all subsequent args (if any) in args that will also yield an integer
-		for len(e.args) > pos+1 && e.args[pos+1].etype == etInt {
-			pos += 1
-			for _, va := range v.validator {
-				if err := va(e.args[pos]); err != nil {
-					return 0, fmt.Errorf("%s: %s", v.key, err.Error())
-				}
+		// consume all subsequent args (if any) that are also integers
+		for {
+			n, ok := got.intValue()
+			if !ok {
+				return 0, got.badArg(exp)
+			}
+			if err := got.validate(v.key, v.validator); err != nil {
+				return 0, err
 			}
-			*v.val = append(*v.val, e.args[pos].int)
+			*v.val = append(*v.val, n)
+			if len(e.args) <= pos+1 {
+				break
+			}
+			if _, ok := e.args[pos+1].intValue(); !ok {
+				break
+			}
+			pos += 1
+			got = e.args[pos]
 		}
 	case ArgFloat:
 		// integer is also a valid float, just happened to have no decimals
 		if got.etype != etFloat && got.etype != etInt {
-			return 0, ErrBadArgumentStr{"float", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
-		for _, va := range v.validator {
-			if err := va(got); err != nil {
-				return 0, fmt.Errorf("%s: %s", v.key, err.Error())
-			}
+		if err := got.validate(v.key, v.validator); err != nil {
+			return 0, err
 		}
 		if got.etype == etInt {
 			*v.val = float64(got.int)
@@ -119,33 +179,93 @@ func (e expr) consumeBasicArg(pos int, exp Arg) (int, error) {
 		}
 	case ArgString:
 		if got.etype != etString {
-			return 0, ErrBadArgumentStr{"string", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
-		for _, va := range v.validator {
-			if err := va(got); err != nil {
-				return 0, fmt.Errorf("%s: %s", v.key, err.Error())
-			}
+		if err := got.validate(v.key, v.validator); err != nil {
+			return 0, err
 		}
 		*v.val = got.str
+	case ArgStrings:
+		// consume all subsequent args (if any) that are also strings
+		for {
+			if got.etype != etString {
+				return 0, got.badArg(exp)
+			}
+			if err := got.validate(v.key, v.validator); err != nil {
+				return 0, err
+			}
+			*v.val = append(*v.val, got.str)
+			if len(e.args) <= pos+1 || e.args[pos+1].etype != etString {
+				break
+			}
+			pos += 1
+			got = e.args[pos]
+		}
+	case ArgStringsOrInts:
+		// consume all subsequent args (if any) that are also strings or ints
+		for {
+			if got.etype != etString && got.etype != etInt {
+				return 0, got.badArg(exp)
+			}
+			if err := got.validate(v.key, v.validator); err != nil {
+				return 0, err
+			}
+			*v.val = append(*v.val, *got)
+			if len(e.args) <= pos+1 || (e.args[pos+1].etype != etString && e.args[pos+1].etype != etInt) {
+				break
+			}
+			pos += 1
+			got = e.args[pos]
+		}
 	case ArgRegex:
 		if got.etype != etString {
-			return 0, ErrBadArgumentStr{"string (regex)", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
-		for _, va := range v.validator {
-			if err := va(got); err != nil {
-				return 0, fmt.Errorf("%s: %s", v.key, err.Error())
-			}
+		if err := got.validate(v.key, v.validator); err != nil {
+			return 0, err
 		}
 		re, err := regexp.Compile(got.str)
 		if err != nil {
-			return 0, err
+			return 0, errAt{got.pos, err}
 		}
 		*v.val = re
 	case ArgBool:
 		if got.etype != etBool {
-			return 0, ErrBadArgumentStr{"string", string(got.etype)}
+			return 0, got.badArg(exp)
 		}
 		*v.val = got.bool
+	case ArgIn:
+		if got.isNone() {
+			break
+		}
+		if got.etype == etName || got.etype == etFunc {
+			if v.seriesArg() == nil {
+				return 0, got.badArg(exp)
+			}
+			// series args are set up by consumeSeriesArg
+			break
+		}
+		// if the argument has the type of one of the args, but not a valid value, report why the value is invalid
+		var valueErr error
+		for _, a := range v.args {
+			switch a.(type) {
+			case ArgSeries, ArgSeriesList, ArgSeriesLists:
+				continue
+			}
+			_, err := e.consumeBasicArg(pos, a)
+			if err == nil {
+				return pos + 1, nil
+			}
+			if ea, ok := err.(errAt); ok && valueErr == nil {
+				if _, ok := ea.err.(ErrBadArgumentStr); !ok {
+					valueErr = err
+				}
+			}
+		}
+		if valueErr != nil {
+			return 0, valueErr
+		}
+		return 0, got.badArg(exp)
 	default:
 		return 0, fmt.Errorf("unsupported type %T for consumeBasicArg", exp)
 	}
@@ -153,6 +273,189 @@ func (e expr) consumeBasicArg(pos int, exp Arg) (int, error) {
 	return pos, nil
 }
 
+// consumeList consumes a list argument, for args that accept multiple values,
+// e.g. the nodes in groupByNodes(foo, 'sum', [1, 2]). nested lists are flattened.
+func (e expr) consumeList(pos int, exp Arg) (int, error) {
+	got := e.args[pos]
+	switch exp.(type) {
+	case ArgInts, ArgStrings, ArgStringsOrInts:
+	default:
+		return 0, got.badArg(exp)
+	}
+	items := got.flatten()
+	if len(items) == 0 {
+		return 0, errAt{got.pos, ErrMissingArg}
+	}
+	list := expr{etype: etFunc, str: e.str, args: items}
+	n, err := list.consumeBasicArg(0, exp)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(items) {
+		return 0, items[n].badArg(exp)
+	}
+	return pos + 1, nil
+}
+
+// flatten returns the items of a (nested) list
+func (e *expr) flatten() []*expr {
+	if e.etype != etList {
+		return []*expr{e}
+	}
+	var out []*expr
+	for _, item := range e.args {
+		out = append(out, item.flatten()...)
+	}
+	return out
+}
+
+// intValue returns the value of an int, or of a float in scientific notation that is a whole number, such as 1e3
+func (e expr) intValue() (int64, bool) {
+	switch e.etype {
+	case etInt:
+		return e.int, true
+	case etFloat:
+		if strings.ContainsAny(e.str, "eE") && e.float == math.Trunc(e.float) && math.Abs(e.float) < math.MaxInt64 {
+			return int64(e.float), true
+		}
+	}
+	return 0, false
+}
+
+// validate runs the given validators for the argument with the given key
+func (e expr) validate(key string, validators []Validator) error {
+	if len(validators) == 0 {
+		return nil
+	}
+	in := &e
+	if n, ok := e.intValue(); ok && e.etype == etFloat {
+		// validators of integers look at the int value
+		in = &expr{etype: etInt, int: n, str: e.str, pos: e.pos}
+	}
+	for _, va := range validators {
+		if err := va(in); err != nil {
+			return errAt{e.pos, fmt.Errorf("%s: %s", key, err.Error())}
+		}
+	}
+	return nil
+}
+
+// badArg returns the error for this expression not being valid for the expected arg
+func (e expr) badArg(exp Arg) error {
+	return errAt{e.pos, ErrBadArgumentStr{argTypeDesc(exp), e.etype.desc()}}
+}
+
+// argTypeDesc returns a short description of the type(s) of input an arg accepts, as used in error messages
+func argTypeDesc(exp Arg) string {
+	switch v := exp.(type) {
+	case ArgSeries, ArgSeriesList, ArgSeriesLists:
+		return "func or name"
+	case ArgInt, ArgInts:
+		return "int"
+	case ArgFloat:
+		return "float"
+	case ArgString, ArgStrings:
+		return "string"
+	case ArgStringsOrInts:
+		return "string or int"
+	case ArgRegex:
+		return "string (regex)"
+	case ArgBool:
+		return "bool"
+	case ArgIn:
+		descs := make([]string, 0, len(v.args))
+		for _, a := range v.args {
+			descs = append(descs, argTypeDesc(a))
+		}
+		return strings.Join(descs, " or ")
+	}
+	return fmt.Sprintf("%T", exp)
+}
+
+// isNone returns whether the expression is python's None, which some functions accept to mean "not specified"
+func (e expr) isNone() bool {
+	return e.etype == etNone
+}
+
+// target returns the expression formatted as it would be specified in a graphite target
+func (e expr) target() string {
+	switch e.etype {
+	case etFunc:
+		return e.str + "(" + e.argsStr + ")"
+	case etString:
+		return quote(e.str)
+	}
+	return e.str
+}
+
+// copy returns a deep copy of the expression
+func (e *expr) copy() *expr {
+	out := *e
+	if e.args != nil {
+		out.args = make([]*expr, len(e.args))
+		for i, arg := range e.args {
+			out.args[i] = arg.copy()
+		}
+	}
+	if e.namedArgs != nil {
+		out.namedArgs = make(map[string]*expr, len(e.namedArgs))
+		for key, arg := range e.namedArgs {
+			out.namedArgs[key] = arg.copy()
+		}
+	}
+	return &out
+}
+
+// quote returns the string as a string literal.
+// there is no escaping of quotes within strings, so it uses the quote that the string doesn't contain
+func quote(s string) string {
+	if strings.Contains(s, "'") {
+		return `"` + s + `"`
+	}
+	return "'" + s + "'"
+}
+
+// canonical returns the expression formatted such that equivalent expressions result in the same string,
+// regardless of whitespace or the order of keyword arguments
+func (e expr) canonical() string {
+	if e.etype == etList {
+		items := make([]string, 0, len(e.args))
+		for _, item := range e.args {
+			items = append(items, item.canonical())
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	if e.etype != etFunc {
+		return e.target()
+	}
+	args := make([]string, 0, len(e.args)+len(e.namedArgs))
+	for _, arg := range e.args {
+		args = append(args, arg.canonical())
+	}
+	keys := make([]string, 0, len(e.namedArgs))
+	for key := range e.namedArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, key+"="+e.namedArgs[key].canonical())
+	}
+	return e.str + "(" + strings.Join(args, ",") + ")"
+}
+
+// needsSeriesArg returns whether, for the given expected arg, the argument at the given pos
+// needs to be set up via consumeSeriesArg
+func (e expr) needsSeriesArg(pos int, exp Arg) bool {
+	switch v := exp.(type) {
+	case ArgSeries, ArgSeriesList, ArgSeriesLists:
+		return true
+	case ArgIn:
+		got := e.args[pos]
+		return !got.isNone() && (got.etype == etName || got.etype == etFunc) && v.seriesArg() != nil
+	}
+	return false
+}
+
 // consumeSeriesArg verifies that the argument at given pos matches the expected arg
 // it's up to the caller to assure that given pos is valid before calling.
 // if arg allows for multiple arguments, pos is advanced to cover all accepted arguments.
@@ -160,34 +463,34 @@ func (e expr) consumeBasicArg(pos int, exp Arg) (int, error) {
 // but for non-basic args (meaning a series, seriesList or seriesLists) the
 // appropriate value(s) will be assigned to exp.val
 // the returned pos is always the index where the next argument should be.
-func (e expr) consumeSeriesArg(pos int, exp Arg, context Context, stable bool, reqs []Req) (int, []Req, error) {
+func (e expr) consumeSeriesArg(pos int, exp Arg, context Context, stable bool, reqs []Req, dd *dedup) (int, []Req, error) {
 	got := e.args[pos]
 	var err error
 	var fn GraphiteFunc
 	switch v := exp.(type) {
 	case ArgSeries:
 		if got.etype != etName && got.etype != etFunc {
-			return 0, nil, ErrBadArgumentStr{"func or name", string(got.etype)}
+			return 0, nil, got.badArg(exp)
 		}
-		fn, reqs, err = newplan(got, context, stable, reqs)
+		fn, reqs, err = newplan(got, context, stable, reqs, dd)
 		if err != nil {
 			return 0, nil, err
 		}
 		*v.val = fn
 	case ArgSeriesList:
 		if got.etype != etName && got.etype != etFunc {
-			return 0, nil, ErrBadArgumentStr{"func or name", string(got.etype)}
+			return 0, nil, got.badArg(exp)
 		}
-		fn, reqs, err = newplan(got, context, stable, reqs)
+		fn, reqs, err = newplan(got, context, stable, reqs, dd)
 		if err != nil {
 			return 0, nil, err
 		}
 		*v.val = fn
 	case ArgSeriesLists:
 		if got.etype != etName && got.etype != etFunc {
-			return 0, nil, ErrBadArgumentStr{"func or name", string(got.etype)}
+			return 0, nil, got.badArg(exp)
 		}
-		fn, reqs, err = newplan(got, context, stable, reqs)
+		fn, reqs, err = newplan(got, context, stable, reqs, dd)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -195,63 +498,17 @@ func (e expr) consumeSeriesArg(pos int, exp Arg, context Context, stable bool, r
 		// special case! consume all subsequent args (if any) in args that will also yield a seriesList
 		for len(e.args) > pos+1 && (e.args[pos+1].etype == etName || e.args[pos+1].etype == etFunc) {
 			pos += 1
-			fn, reqs, err = newplan(e.args[pos], context, stable, reqs)
+			fn, reqs, err = newplan(e.args[pos], context, stable, reqs, dd)
 			if err != nil {
 				return 0, nil, err
 			}
 			*v.val = append(*v.val, fn)
 		}
+	case ArgIn:
+		return e.consumeSeriesArg(pos, v.seriesArg(), context, stable, reqs, dd)
 	default:
 		return 0, nil, fmt.Errorf("unsupported type %T for consumeSeriesArg", exp)
 	}
 	pos += 1
 	return pos, reqs, nil
 }
-
-// consumeKwarg consumes the kwarg (by key k) and verifies it
-// if the specified argument is valid, it is saved in exp.val
-// where exp is the arg specified by the function that has the given key
-func (e expr) consumeKwarg(key string, optArgs []Arg) error {
-	var found bool
-	var exp Arg
-	for _, exp = range optArgs {
-		if exp.Key() == key {
-			found = true
-			break
-		}
-	}
-	if !found {
-		return ErrUnknownKwarg{key}
-	}
-	got := e.namedArgs[key]
-	switch v := exp.(type) {
-	case ArgInt:
-		if got.etype != etInt {
-			return ErrBadKwarg{key, exp, got.etype}
-		}
-		*v.val = got.int
-	case ArgFloat:
-		switch got.etype {
-		case etInt:
-			// integer is also a valid float, just happened to have no decimals
-			*v.val = float64(got.int)
-		case etFloat:
-			*v.val = got.float
-		default:
-			return ErrBadKwarg{key, exp, got.etype}
-		}
-	case ArgString:
-		if got.etype != etString {
-			return ErrBadKwarg{key, exp, got.etype}
-		}
-		*v.val = got.str
-	case ArgBool:
-		if got.etype != etBool {
-			return ErrBadKwarg{key, exp, got.etype}
-		}
-		*v.val = got.bool
-	default:
-		return fmt.Errorf("unsupported type %T for consumeKwarg", exp)
-	}
-	return nil
-}
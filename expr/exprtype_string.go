@@ -4,9 +4,9 @@ package expr
 
 import "fmt"
 
-const _exprType_name = "etNameetBooletFuncetIntetFloatetString"
+const _exprType_name = "etNameetBooletFuncetIntetFloatetStringetNoneetList"
 
-var _exprType_index = [...]uint8{0, 6, 12, 18, 23, 30, 38}
+var _exprType_index = [...]uint8{0, 6, 12, 18, 23, 30, 38, 44, 50}
 
 func (i exprType) String() string {
 	if i < 0 || i >= exprType(len(_exprType_index)-1) {
@@ -0,0 +1,44 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncAbsolute struct {
+	in GraphiteFunc
+}
+
+func NewAbsolute() GraphiteFunc {
+	return &FuncAbsolute{}
+}
+
+func (s *FuncAbsolute) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncAbsolute) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncAbsolute) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		for i, p := range serie.Datapoints {
+			out[i] = schema.Point{Val: math.Abs(p.Val), Ts: p.Ts}
+		}
+		name := fmt.Sprintf("absolute(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
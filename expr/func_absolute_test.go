@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAbsolute(t *testing.T) {
+	nan := math.NaN()
+	testTransform("absolute", &FuncAbsolute{in: NewMock(getTransformTestInput())}, "absolute(a)", []float64{4, 0, nan, 4, 16}, t)
+}
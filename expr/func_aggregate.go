@@ -1,6 +1,7 @@
 package expr
 
 import (
+	"math"
 	"strings"
 
 	"github.com/grafana/metrictank/api/models"
@@ -8,8 +9,10 @@ import (
 )
 
 type FuncAggregate struct {
-	in  []GraphiteFunc
-	agg seriesAggregator
+	in           []GraphiteFunc
+	agg          seriesAggregator
+	xFilesFactor float64
+	generic      bool // whether the aggregation function can be specified, as opposed to being fixed by the function name
 }
 
 // NewAggregateConstructor takes an agg string and returns a constructor function
@@ -19,13 +22,29 @@ func NewAggregateConstructor(aggDescription string, aggFunc crossSeriesAggFunc)
 	}
 }
 
+// NewAggregate returns the generic aggregate function, which takes the aggregation function as argument
+func NewAggregate() GraphiteFunc {
+	return &FuncAggregate{generic: true}
+}
+
 func (s *FuncAggregate) Signature() ([]Arg, []Arg) {
+	if s.generic {
+		return []Arg{
+			ArgSeriesLists{val: &s.in},
+			ArgString{key: "func", typ: paramAggFunc, validator: []Validator{IsAggFunc}, val: &s.agg.name},
+			ArgFloat{key: "xFilesFactor", opt: true, val: &s.xFilesFactor},
+		}, []Arg{ArgSeries{}}
+	}
 	return []Arg{
 		ArgSeriesLists{val: &s.in},
 	}, []Arg{ArgSeries{}}
 }
 
 func (s *FuncAggregate) Context(context Context) Context {
+	// the validator assures the function is valid
+	if s.generic {
+		s.agg.function = getCrossSeriesAggFunc(s.agg.name)
+	}
 	return context
 }
 
@@ -34,19 +53,25 @@ func (s *FuncAggregate) Exec(cache map[Req][]models.Series) ([]models.Series, er
 	if err != nil {
 		return nil, err
 	}
-
 	if len(series) == 0 {
 		return series, nil
 	}
 
-	if len(series) == 1 {
+	// aggregating a single series may result in the same points, which we can then use as is.
+	// unless an xFilesFactor is set, as applying it requires a slice of our own.
+	if len(series) == 1 && s.agg.isIdentity() && s.xFilesFactor == 0 {
 		name := s.agg.name + "Series(" + series[0].QueryPatt + ")"
-		series[0].Target = name
-		series[0].QueryPatt = name
-		return series, nil
+		output := series[0]
+		output.Target = name
+		output.QueryPatt = name
+		output.Tags = output.CopyTags()
+		return []models.Series{output}, nil
 	}
 	out := pointSlicePool.Get().([]schema.Point)
 	s.agg.function(series, &out)
+	if s.xFilesFactor > 0 {
+		applyXFilesFactor(series, out, s.xFilesFactor)
+	}
 
 	cons, queryCons := summarizeCons(series)
 	name := s.agg.name + "Series(" + strings.Join(queryPatts, ",") + ")"
@@ -62,3 +87,18 @@ func (s *FuncAggregate) Exec(cache map[Req][]models.Series) ([]models.Series, er
 
 	return []models.Series{output}, nil
 }
+
+// applyXFilesFactor nulls the aggregated points for which the ratio of non-null input values is less than xFilesFactor
+func applyXFilesFactor(in []models.Series, out []schema.Point, xFilesFactor float64) {
+	for i := range out {
+		nonNull := 0
+		for j := 0; j < len(in); j++ {
+			if !math.IsNaN(in[j].Datapoints[i].Val) {
+				nonNull++
+			}
+		}
+		if float64(nonNull)/float64(len(in)) < xFilesFactor {
+			out[i].Val = math.NaN()
+		}
+	}
+}
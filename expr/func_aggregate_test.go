@@ -240,12 +240,112 @@ func TestAggregateMultipleTimesSameInput(t *testing.T) {
 	)
 }
 
+func TestAggregateSingleNonIdentity(t *testing.T) {
+	f := NewAggregateConstructor("count", crossSeriesLen)()
+	f.(*FuncAggregate).in = []GraphiteFunc{NewMock([]models.Series{{QueryPatt: "single", Datapoints: getCopy(a)}})}
+	checkAggregate("countSeries-single", f, models.Series{
+		Target: "countSeries(single)",
+		Datapoints: []schema.Point{
+			{Val: 1, Ts: 10},
+			{Val: 1, Ts: 20},
+			{Val: 1, Ts: 30},
+			{Val: 1, Ts: 40},
+			{Val: 1, Ts: 50},
+			{Val: 1, Ts: 60},
+		},
+	}, t)
+
+	f = NewAggregateConstructor("stddev", crossSeriesStddev)()
+	f.(*FuncAggregate).in = []GraphiteFunc{NewMock([]models.Series{{QueryPatt: "single", Datapoints: getCopy(a)}})}
+	checkAggregate("stddevSeries-single", f, models.Series{
+		Target: "stddevSeries(single)",
+		Datapoints: []schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 0, Ts: 30},
+			{Val: math.NaN(), Ts: 40},
+			{Val: math.NaN(), Ts: 50},
+			{Val: 0, Ts: 60},
+		},
+	}, t)
+}
+
+// TestAggregateSingleIdentityInput tests that the input is not modified when the aggregation of a single series is skipped
+func TestAggregateSingleIdentityInput(t *testing.T) {
+	input := []models.Series{{Target: "single", QueryPatt: "single", Datapoints: getCopy(a)}}
+	f := NewAggregateConstructor("sum", crossSeriesSum)()
+	f.(*FuncAggregate).in = []GraphiteFunc{NewMock(input)}
+	checkAggregate("sumSeries-single", f, models.Series{
+		Target:     "sumSeries(single)",
+		Datapoints: getCopy(a),
+	}, t)
+	if input[0].Target != "single" || input[0].QueryPatt != "single" {
+		t.Fatalf("expected the input to remain unchanged, got target %q and query pattern %q", input[0].Target, input[0].QueryPatt)
+	}
+
+	// with an xFilesFactor, the aggregation is not skipped
+	f = NewAggregateConstructor("sum", crossSeriesSum)()
+	f.(*FuncAggregate).in = []GraphiteFunc{NewMock(input)}
+	f.(*FuncAggregate).xFilesFactor = 0.5
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	if &got[0].Datapoints[0] == &input[0].Datapoints[0] {
+		t.Fatalf("expected the output to have its own points, on which the xFilesFactor is applied")
+	}
+}
+
+func TestAggregateGeneric(t *testing.T) {
+	input := []models.Series{
+		{
+			QueryPatt:  "foo.*",
+			Datapoints: getCopy(a),
+		},
+		{
+			QueryPatt:  "foo.*",
+			Datapoints: getCopy(b),
+		},
+	}
+	f := NewAggregate()
+	agg := f.(*FuncAggregate)
+	agg.in = []GraphiteFunc{NewMock(input)}
+	agg.agg.name = "sum"
+	f.Context(Context{})
+	checkAggregate("aggregate-sum", f, models.Series{
+		Target:     "sumSeries(foo.*)",
+		Datapoints: getCopy(sumab),
+	}, t)
+
+	f = NewAggregate()
+	agg = f.(*FuncAggregate)
+	agg.in = []GraphiteFunc{NewMock(input)}
+	agg.agg.name = "max"
+	agg.xFilesFactor = 1
+	f.Context(Context{})
+	checkAggregate("aggregate-max-xff", f, models.Series{
+		Target: "maxSeries(foo.*)",
+		Datapoints: []schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: math.MaxFloat64, Ts: 20},
+			{Val: math.MaxFloat64 - 20, Ts: 30},
+			{Val: math.NaN(), Ts: 40},
+			{Val: math.NaN(), Ts: 50},
+			{Val: math.NaN(), Ts: 60},
+		},
+	}, t)
+}
+
 func testAggregate(name, agg string, in [][]models.Series, out models.Series, t *testing.T) {
 	f := NewAggregateConstructor(agg, getCrossSeriesAggFunc(agg))()
 	avg := f.(*FuncAggregate)
 	for _, i := range in {
 		avg.in = append(avg.in, NewMock(i))
 	}
+	checkAggregate(name, f, out, t)
+}
+
+func checkAggregate(name string, f GraphiteFunc, out models.Series, t *testing.T) {
 	got, err := f.Exec(make(map[Req][]models.Series))
 	if err != nil {
 		t.Fatalf("case %q: err should be nil. got %q", name, err)
@@ -309,6 +409,7 @@ func BenchmarkAggregate10k_1000AllSeriesHalfNulls(b *testing.B) {
 }
 
 func benchmarkAggregate(b *testing.B, numSeries int, fn0, fn1 func() []schema.Point) {
+	b.ReportAllocs()
 	var input []models.Series
 	for i := 0; i < numSeries; i++ {
 		series := models.Series{
@@ -1,8 +1,6 @@
 package expr
 
 import (
-	"strings"
-
 	"github.com/grafana/metrictank/api/models"
 )
 
@@ -32,20 +30,7 @@ func (s *FuncAliasByNode) Exec(cache map[Req][]models.Series) ([]models.Series,
 		return nil, err
 	}
 	for i, serie := range series {
-		metric := extractMetric(serie.Target)
-		parts := strings.Split(metric, ".")
-		var name []string
-		for _, n64 := range s.nodes {
-			n := int(n64)
-			if n < 0 {
-				n += len(parts)
-			}
-			if n >= len(parts) || n < 0 {
-				continue
-			}
-			name = append(name, parts[n])
-		}
-		n := strings.Join(name, ".")
+		n := nodesKey(extractMetric(serie.Target), s.nodes)
 		series[i].Target = n
 		series[i].QueryPatt = n
 	}
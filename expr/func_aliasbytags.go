@@ -0,0 +1,59 @@
+package expr
+
+import (
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncAliasByTags struct {
+	in   GraphiteFunc
+	tags []expr
+}
+
+func NewAliasByTags() GraphiteFunc {
+	return &FuncAliasByTags{}
+}
+
+func (s *FuncAliasByTags) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgStringsOrInts{key: "tags", val: &s.tags},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncAliasByTags) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncAliasByTags) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	for i, serie := range series {
+		name := aliasByTags(serie, s.tags)
+		series[i].Target = name
+		series[i].QueryPatt = name
+	}
+	return series, nil
+}
+
+// aliasByTags returns the values of the given tags of the series, joined by '.'
+// int tags are interpreted as nodes of the metric name, like aliasByNode does.
+// tags that the series doesn't have yield an empty string
+func aliasByTags(serie models.Series, tags []expr) string {
+	metric, ok := serie.Tags["name"]
+	if !ok {
+		metric = extractMetric(serie.Target)
+	}
+	parts := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag.etype == etInt {
+			parts = append(parts, nodesKey(metric, []int64{tag.int}))
+			continue
+		}
+		parts = append(parts, serie.Tags[tag.str])
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,59 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func getTaggedTestInput() []models.Series {
+	series := []models.Series{
+		{Target: "disk.used;dc=dc1;rack=a1", QueryPatt: "seriesByTag('name=disk.used')", Datapoints: getCopy(c)},
+		{Target: "disk.used;dc=dc1;rack=a2", QueryPatt: "seriesByTag('name=disk.used')", Datapoints: getCopy(d)},
+		{Target: "disk.used;dc=dc2;rack=a1", QueryPatt: "seriesByTag('name=disk.used')", Datapoints: getCopy(a)},
+	}
+	for i := range series {
+		series[i].SetTags()
+	}
+	return series
+}
+
+func TestAliasByTags(t *testing.T) {
+	cases := []struct {
+		tags []expr
+		out  []string
+	}{
+		{
+			[]expr{{etype: etString, str: "dc"}},
+			[]string{"dc1", "dc1", "dc2"},
+		},
+		{
+			[]expr{{etype: etString, str: "rack"}, {etype: etString, str: "dc"}},
+			[]string{"a1.dc1", "a2.dc1", "a1.dc2"},
+		},
+		{
+			[]expr{{etype: etInt, int: 1}, {etype: etString, str: "dc"}, {etype: etString, str: "missing"}},
+			[]string{"used.dc1.", "used.dc1.", "used.dc2."},
+		},
+		{
+			[]expr{{etype: etString, str: "name"}},
+			[]string{"disk.used", "disk.used", "disk.used"},
+		},
+	}
+	for i, c := range cases {
+		f := NewAliasByTags()
+		alias := f.(*FuncAliasByTags)
+		alias.in = NewMock(getTaggedTestInput())
+		alias.tags = c.tags
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %d: err should be nil. got %q", i, err)
+		}
+		for _, serie := range got {
+			if serie.Target != serie.QueryPatt {
+				t.Fatalf("case %d: expected target and querypatt to match, got %q and %q", i, serie.Target, serie.QueryPatt)
+			}
+		}
+		checkTargets("aliasByTags", got, c.out, t)
+	}
+}
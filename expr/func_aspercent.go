@@ -0,0 +1,249 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+var errAsPercentTotalLen = errors.New("asPercent second argument must be missing, a single digit, reference exactly 1 series or reference the same number of series as the first argument")
+
+type FuncAsPercent struct {
+	in          GraphiteFunc
+	totalFloat  float64
+	totalSeries GraphiteFunc
+	nodes       []int64
+}
+
+func NewAsPercent() GraphiteFunc {
+	return &FuncAsPercent{totalFloat: math.NaN()}
+}
+
+func (s *FuncAsPercent) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgIn{
+			key: "total",
+			opt: true,
+			args: []Arg{
+				ArgFloat{key: "total", val: &s.totalFloat},
+				ArgSeriesList{key: "total", val: &s.totalSeries},
+			},
+		},
+		ArgInts{key: "nodes", opt: true, val: &s.nodes},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncAsPercent) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncAsPercent) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var totals []models.Series
+	if s.totalSeries != nil {
+		totals, err = s.totalSeries.Exec(cache)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.nodes) > 0 {
+		return s.execWithNodes(series, totals, cache)
+	}
+	return s.execWithoutNodes(series, totals, cache)
+}
+
+func (s *FuncAsPercent) execWithoutNodes(series, totals []models.Series, cache map[Req][]models.Series) ([]models.Series, error) {
+	if len(series) == 0 {
+		return nil, nil
+	}
+	var outputs []models.Series
+
+	switch {
+	case s.totalSeries == nil && math.IsNaN(s.totalFloat):
+		total, err := sumSeries(series, cache)
+		if err != nil {
+			return nil, err
+		}
+		totalText := "sumSeries(" + formatPathExpressions(series) + ")"
+		for _, serie := range series {
+			output, err := asPercent(serie, total, serie.Target, totalText, cache)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+	case s.totalSeries == nil:
+		totalText := strconv.FormatFloat(s.totalFloat, 'f', -1, 64)
+		for _, serie := range series {
+			out := pointSlicePool.Get().([]schema.Point)
+			for _, p := range serie.Datapoints {
+				out = append(out, schema.Point{Ts: p.Ts, Val: computeAsPercent(p.Val, s.totalFloat)})
+			}
+			outputs = append(outputs, newAsPercentSeries(serie, out, serie.Target, totalText, cache))
+		}
+	case len(totals) == 1:
+		for _, serie := range series {
+			output, err := asPercent(serie, totals[0], serie.Target, totals[0].Target, cache)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+	case len(totals) == len(series):
+		// like graphite, we match series and totals up by their name
+		series = sortedCopy(series)
+		totals = sortedCopy(totals)
+		for i, serie := range series {
+			output, err := asPercent(serie, totals[i], serie.Target, totals[i].Target, cache)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+	default:
+		return nil, errAsPercentTotalLen
+	}
+	return outputs, nil
+}
+
+// execWithNodes groups series and totals by the given nodes, and computes the percentage of each series
+// against the total of the group it belongs to.
+func (s *FuncAsPercent) execWithNodes(series, totals []models.Series, cache map[Req][]models.Series) ([]models.Series, error) {
+	var keys []string
+	seriesByKey := make(map[string][]models.Series)
+	for _, serie := range series {
+		key := nodesKey(extractMetric(serie.Target), s.nodes)
+		if _, ok := seriesByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		seriesByKey[key] = append(seriesByKey[key], serie)
+	}
+
+	totalsByKey := make(map[string][]models.Series)
+	if s.totalSeries == nil {
+		for _, key := range keys {
+			totalsByKey[key] = seriesByKey[key]
+		}
+	} else {
+		for _, total := range totals {
+			key := nodesKey(extractMetric(total.Target), s.nodes)
+			if _, ok := seriesByKey[key]; !ok {
+				if _, ok := totalsByKey[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			totalsByKey[key] = append(totalsByKey[key], total)
+		}
+	}
+
+	var outputs []models.Series
+	for _, key := range keys {
+		var total models.Series
+		totalGroup, haveTotal := totalsByKey[key]
+		if haveTotal {
+			total = totalGroup[0]
+			if len(totalGroup) > 1 {
+				var err error
+				total, err = sumSeries(totalGroup, cache)
+				if err != nil {
+					return nil, err
+				}
+				total.Target = "sumSeries(" + formatPathExpressions(totalGroup) + ")"
+			}
+		}
+		group, ok := seriesByKey[key]
+		if !ok {
+			outputs = append(outputs, newAsPercentSeries(total, nanPoints(total.Datapoints), "MISSING", total.Target, cache))
+			continue
+		}
+		for _, serie := range group {
+			if !haveTotal {
+				outputs = append(outputs, newAsPercentSeries(serie, nanPoints(serie.Datapoints), serie.Target, "MISSING", cache))
+				continue
+			}
+			output, err := asPercent(serie, total, serie.Target, total.Target, cache)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+	}
+	return outputs, nil
+}
+
+// asPercent computes the percentage of each point of serie against the corresponding point of total
+func asPercent(serie, total models.Series, name, totalName string, cache map[Req][]models.Series) (models.Series, error) {
+	if err := checkPointCounts(serie, total); err != nil {
+		return models.Series{}, err
+	}
+	out := pointSlicePool.Get().([]schema.Point)
+	for i, p := range serie.Datapoints {
+		out = append(out, schema.Point{Ts: p.Ts, Val: computeAsPercent(p.Val, total.Datapoints[i].Val)})
+	}
+	return newAsPercentSeries(serie, out, name, totalName, cache), nil
+}
+
+func newAsPercentSeries(in models.Series, points []schema.Point, name, totalName string, cache map[Req][]models.Series) models.Series {
+	return deriveSeries(cache, in, fmt.Sprintf("asPercent(%s,%s)", name, totalName), points)
+}
+
+func computeAsPercent(val, total float64) float64 {
+	return safeDiv(val, total) * 100
+}
+
+// sumSeries returns a new series that is the sum of the given ones
+func sumSeries(series []models.Series, cache map[Req][]models.Series) (models.Series, error) {
+	for _, serie := range series[1:] {
+		if err := checkPointCounts(series[0], serie); err != nil {
+			return models.Series{}, err
+		}
+	}
+	out := pointSlicePool.Get().([]schema.Point)
+	crossSeriesSum(series, &out)
+	sum := models.Series{
+		Datapoints: out,
+		Interval:   series[0].Interval,
+	}
+	cache[Req{}] = append(cache[Req{}], sum)
+	return sum, nil
+}
+
+// nanPoints returns a slice of null points with the same timestamps as the input
+func nanPoints(in []schema.Point) []schema.Point {
+	out := pointSlicePool.Get().([]schema.Point)
+	for _, p := range in {
+		out = append(out, schema.Point{Ts: p.Ts, Val: math.NaN()})
+	}
+	return out
+}
+
+// formatPathExpressions returns the unique query patterns of the given series, joined by commas
+func formatPathExpressions(series []models.Series) string {
+	var patts []string
+	seen := make(map[string]struct{})
+	for _, serie := range series {
+		if _, ok := seen[serie.QueryPatt]; !ok {
+			patts = append(patts, serie.QueryPatt)
+			seen[serie.QueryPatt] = struct{}{}
+		}
+	}
+	return strings.Join(patts, ",")
+}
+
+// sortedCopy returns a copy of the series, sorted by target
+func sortedCopy(series []models.Series) []models.Series {
+	out := make([]models.Series, len(series))
+	copy(out, series)
+	sort.Sort(models.SeriesByTarget(out))
+	return out
+}
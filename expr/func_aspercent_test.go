@@ -0,0 +1,189 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+var cAsPercentOfSumcd = []schema.Point{
+	{Val: math.NaN(), Ts: 10}, // 0 / 0
+	{Val: 0, Ts: 20},
+	{Val: 0.5, Ts: 30},
+	{Val: float64(200) / 31, Ts: 40},
+	{Val: float64(300) / 83, Ts: 50},
+	{Val: float64(400) / 254, Ts: 60},
+}
+
+var dAsPercentOfSumcd = []schema.Point{
+	{Val: math.NaN(), Ts: 10},
+	{Val: 100, Ts: 20},
+	{Val: 99.5, Ts: 30},
+	{Val: float64(2900) / 31, Ts: 40},
+	{Val: float64(8000) / 83, Ts: 50},
+	{Val: float64(25000) / 254, Ts: 60},
+}
+
+var cAsPercentOf50 = []schema.Point{
+	{Val: 0, Ts: 10},
+	{Val: 0, Ts: 20},
+	{Val: 2, Ts: 30},
+	{Val: 4, Ts: 40},
+	{Val: 6, Ts: 50},
+	{Val: 8, Ts: 60},
+}
+
+var dAsPercentOfc = []schema.Point{
+	{Val: math.NaN(), Ts: 10},
+	{Val: math.NaN(), Ts: 20},
+	{Val: 19900, Ts: 30},
+	{Val: 1450, Ts: 40},
+	{Val: float64(8000) / 3, Ts: 50},
+	{Val: 6250, Ts: 60},
+}
+
+func getAsPercentTestInput() []models.Series {
+	return []models.Series{
+		{Target: "dc1.c", QueryPatt: "dc1.*", Datapoints: getCopy(c)},
+		{Target: "dc1.d", QueryPatt: "dc1.*", Datapoints: getCopy(d)},
+	}
+}
+
+func TestAsPercentNoTotal(t *testing.T) {
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(getAsPercentTestInput())
+	testAsPercent("no-total", f, []models.Series{
+		{Target: "asPercent(dc1.c,sumSeries(dc1.*))", Datapoints: cAsPercentOfSumcd},
+		{Target: "asPercent(dc1.d,sumSeries(dc1.*))", Datapoints: dAsPercentOfSumcd},
+	}, t)
+}
+
+func TestAsPercentTotalNumber(t *testing.T) {
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(getAsPercentTestInput()[:1])
+	f.(*FuncAsPercent).totalFloat = 50
+	testAsPercent("total-number", f, []models.Series{
+		{Target: "asPercent(dc1.c,50)", Datapoints: cAsPercentOf50},
+	}, t)
+}
+
+func TestAsPercentTotalSeries(t *testing.T) {
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(getAsPercentTestInput()[1:])
+	f.(*FuncAsPercent).totalSeries = NewMock(getAsPercentTestInput()[:1])
+	testAsPercent("total-series", f, []models.Series{
+		{Target: "asPercent(dc1.d,dc1.c)", Datapoints: dAsPercentOfc},
+	}, t)
+}
+
+func TestAsPercentTotalSeriesListPairwise(t *testing.T) {
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock([]models.Series{
+		{Target: "b.d", QueryPatt: "b.*", Datapoints: getCopy(d)},
+		{Target: "b.c", QueryPatt: "b.*", Datapoints: getCopy(c)},
+	})
+	f.(*FuncAsPercent).totalSeries = NewMock([]models.Series{
+		{Target: "a.2", QueryPatt: "a.*", Datapoints: getCopy(c)},
+		{Target: "a.1", QueryPatt: "a.*", Datapoints: getCopy(c)},
+	})
+	testAsPercent("total-serieslist", f, []models.Series{
+		{Target: "asPercent(b.c,a.1)", Datapoints: []schema.Point{
+			{Val: math.NaN(), Ts: 10},
+			{Val: math.NaN(), Ts: 20},
+			{Val: 100, Ts: 30},
+			{Val: 100, Ts: 40},
+			{Val: 100, Ts: 50},
+			{Val: 100, Ts: 60},
+		}},
+		{Target: "asPercent(b.d,a.2)", Datapoints: dAsPercentOfc},
+	}, t)
+
+	f = NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(getAsPercentTestInput())
+	f.(*FuncAsPercent).totalSeries = NewMock(getSummaryTestInput())
+	_, err := f.Exec(make(map[Req][]models.Series))
+	if err != errAsPercentTotalLen {
+		t.Fatalf("expected error %q, got %q", errAsPercentTotalLen, err)
+	}
+}
+
+func TestAsPercentNodes(t *testing.T) {
+	in := []models.Series{
+		{Target: "dc1.c", QueryPatt: "*.*", Datapoints: getCopy(c)},
+		{Target: "dc1.d", QueryPatt: "*.*", Datapoints: getCopy(d)},
+		{Target: "dc2.c", QueryPatt: "*.*", Datapoints: getCopy(c)},
+	}
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(in)
+	f.(*FuncAsPercent).nodes = []int64{0}
+	testAsPercent("nodes-no-total", f, []models.Series{
+		{Target: "asPercent(dc1.c,sumSeries(*.*))", Datapoints: cAsPercentOfSumcd},
+		{Target: "asPercent(dc1.d,sumSeries(*.*))", Datapoints: dAsPercentOfSumcd},
+		{Target: "asPercent(dc2.c,dc2.c)", Datapoints: []schema.Point{
+			{Val: math.NaN(), Ts: 10},
+			{Val: math.NaN(), Ts: 20},
+			{Val: 100, Ts: 30},
+			{Val: 100, Ts: 40},
+			{Val: 100, Ts: 50},
+			{Val: 100, Ts: 60},
+		}},
+	}, t)
+
+	f = NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(in[1:])
+	f.(*FuncAsPercent).totalSeries = NewMock([]models.Series{
+		{Target: "dc1.total", QueryPatt: "*.total", Datapoints: getCopy(c)},
+		{Target: "dc3.total", QueryPatt: "*.total", Datapoints: getCopy(c)},
+	})
+	f.(*FuncAsPercent).nodes = []int64{0}
+	testAsPercent("nodes-total", f, []models.Series{
+		{Target: "asPercent(dc1.d,dc1.total)", Datapoints: dAsPercentOfc},
+		{Target: "asPercent(dc2.c,MISSING)", Datapoints: getCopy(allNaN)},
+		{Target: "asPercent(MISSING,dc3.total)", Datapoints: getCopy(allNaN)},
+	}, t)
+}
+
+func testAsPercent(name string, f GraphiteFunc, out []models.Series, t *testing.T) {
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("case %q: err should be nil. got %q", name, err)
+	}
+	if len(got) != len(out) {
+		t.Fatalf("case %q: expected %d output series, got %d", name, len(out), len(got))
+	}
+	for i, exp := range out {
+		g := got[i]
+		if g.Target != exp.Target {
+			t.Fatalf("case %q: expected target %q, got %q", name, exp.Target, g.Target)
+		}
+		if len(g.Datapoints) != len(exp.Datapoints) {
+			t.Fatalf("case %q: len output expected %d, got %d", name, len(exp.Datapoints), len(g.Datapoints))
+		}
+		for j, p := range g.Datapoints {
+			bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp.Datapoints[j].Val)
+			if (bothNaN || math.Abs(p.Val-exp.Datapoints[j].Val) < 1e-9) && p.Ts == exp.Datapoints[j].Ts {
+				continue
+			}
+			t.Fatalf("case %q: output point %d - expected %v got %v", name, j, exp.Datapoints[j], p)
+		}
+	}
+}
+
+func TestAsPercentPointCountMismatch(t *testing.T) {
+	short := []models.Series{{Target: "short", QueryPatt: "short", Datapoints: getCopy(c)[:3]}}
+
+	f := NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(getAsPercentTestInput())
+	f.(*FuncAsPercent).totalSeries = NewMock(short)
+	if _, err := f.Exec(make(map[Req][]models.Series)); err == nil {
+		t.Fatalf("asPercent: expected error for total with a different number of points")
+	}
+
+	f = NewAsPercent()
+	f.(*FuncAsPercent).in = NewMock(append(getAsPercentTestInput(), short...))
+	if _, err := f.Exec(make(map[Req][]models.Series)); err == nil {
+		t.Fatalf("asPercent: expected error for series with a different number of points")
+	}
+}
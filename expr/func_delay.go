@@ -0,0 +1,48 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncDelay struct {
+	in    GraphiteFunc
+	steps int64
+}
+
+func NewDelay() GraphiteFunc {
+	return &FuncDelay{}
+}
+
+func (s *FuncDelay) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgInt{key: "steps", validator: []Validator{IntPositive}, val: &s.steps},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests the extra points before from that will be shifted into the requested range
+func (s *FuncDelay) Context(context Context) Context {
+	context.prePoints += uint32(s.steps)
+	return context
+}
+
+func (s *FuncDelay) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	steps := int(s.steps)
+	var outputs []models.Series
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		for i := steps; i < len(serie.Datapoints); i++ {
+			out = append(out, schema.Point{Val: serie.Datapoints[i-steps].Val, Ts: serie.Datapoints[i].Ts})
+		}
+		name := fmt.Sprintf("delay(%s,%d)", serie.Target, s.steps)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
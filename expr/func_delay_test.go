@@ -0,0 +1,27 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestDelay(t *testing.T) {
+	f := NewDelay()
+	f.(*FuncDelay).in = NewMock(getCounterTestInput())
+	f.(*FuncDelay).steps = 2
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// the first 2 points were fetched before the requested range, and are shifted into it
+	checkPoints("delay", got, "delay(a,2)", []schema.Point{
+		{Val: 10, Ts: 30},
+		{Val: 15, Ts: 40},
+		{Val: math.NaN(), Ts: 50},
+		{Val: 20, Ts: 60},
+		{Val: 22, Ts: 70},
+	}, t)
+}
@@ -0,0 +1,56 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncDerivative struct {
+	in GraphiteFunc
+}
+
+func NewDerivative() GraphiteFunc {
+	return &FuncDerivative{}
+}
+
+func (s *FuncDerivative) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests one extra point before from, so that the first point in the requested range has a predecessor
+func (s *FuncDerivative) Context(context Context) Context {
+	context.consol = 0
+	context.prePoints++
+	return context
+}
+
+func (s *FuncDerivative) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		for i := 1; i < len(serie.Datapoints); i++ {
+			p := serie.Datapoints[i]
+			// a null on either side results in null
+			out = append(out, schema.Point{Val: p.Val - serie.Datapoints[i-1].Val, Ts: p.Ts})
+		}
+		name := fmt.Sprintf("derivative(%s)", serie.Target)
+		output := models.Series{
+			Target:     name,
+			Tags:       serie.CopyTags(),
+			QueryPatt:  name,
+			Datapoints: out,
+			Interval:   serie.Interval,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
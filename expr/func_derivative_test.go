@@ -0,0 +1,46 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func getCounterTestInput() []models.Series {
+	return []models.Series{
+		{
+			Target:    "a",
+			QueryPatt: "a",
+			Interval:  10,
+			Datapoints: []schema.Point{
+				{Val: 10, Ts: 10},
+				{Val: 15, Ts: 20},
+				{Val: math.NaN(), Ts: 30},
+				{Val: 20, Ts: 40},
+				{Val: 22, Ts: 50},
+				{Val: 5, Ts: 60},
+				{Val: 30, Ts: 70},
+			},
+		},
+	}
+}
+
+func TestDerivative(t *testing.T) {
+	f := NewDerivative()
+	f.(*FuncDerivative).in = NewMock(getCounterTestInput())
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// the first point is only used as the base for the next
+	checkPoints("derivative", got, "derivative(a)", []schema.Point{
+		{Val: 5, Ts: 20},
+		{Val: math.NaN(), Ts: 30},
+		{Val: math.NaN(), Ts: 40},
+		{Val: 2, Ts: 50},
+		{Val: -17, Ts: 60},
+		{Val: 25, Ts: 70},
+	}, t)
+}
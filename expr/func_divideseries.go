@@ -3,7 +3,6 @@ package expr
 import (
 	"errors"
 	"fmt"
-	"math"
 
 	"github.com/grafana/metrictank/api/models"
 	"gopkg.in/raintank/schema.v1"
@@ -47,15 +46,10 @@ func (s *FuncDivideSeries) Exec(cache map[Req][]models.Series) ([]models.Series,
 	for _, dividend := range dividends {
 		out := pointSlicePool.Get().([]schema.Point)
 		for i := 0; i < len(dividend.Datapoints); i++ {
-			p := schema.Point{
-				Ts: dividend.Datapoints[i].Ts,
-			}
-			if divisor.Datapoints[i].Val == 0 {
-				p.Val = math.NaN()
-			} else {
-				p.Val = dividend.Datapoints[i].Val / divisor.Datapoints[i].Val
-			}
-			out = append(out, p)
+			out = append(out, schema.Point{
+				Ts:  dividend.Datapoints[i].Ts,
+				Val: safeDiv(dividend.Datapoints[i].Val, divisor.Datapoints[i].Val),
+			})
 		}
 		name := fmt.Sprintf("divideSeries(%s,%s)", dividend.QueryPatt, divisor.QueryPatt)
 		output := models.Series{
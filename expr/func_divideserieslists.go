@@ -0,0 +1,88 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncDivideSeriesLists struct {
+	dividends GraphiteFunc
+	divisors  GraphiteFunc
+}
+
+func NewDivideSeriesLists() GraphiteFunc {
+	return &FuncDivideSeriesLists{}
+}
+
+func (s *FuncDivideSeriesLists) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{key: "dividendSeriesList", val: &s.dividends},
+		ArgSeriesList{key: "divisorSeriesList", val: &s.divisors},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncDivideSeriesLists) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncDivideSeriesLists) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	dividends, err := s.dividends.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	divisors, err := s.divisors.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	if len(dividends) != len(divisors) {
+		return nil, errors.New("dividendSeriesList and divisorSeriesList argument must have equal length")
+	}
+
+	var series []models.Series
+	for i := range dividends {
+		dividend, divisor := dividends[i], divisors[i]
+		if err := checkPointCounts(dividend, divisor); err != nil {
+			return nil, err
+		}
+		out := pointSlicePool.Get().([]schema.Point)
+		for j := 0; j < len(dividend.Datapoints); j++ {
+			out = append(out, schema.Point{
+				Ts:  dividend.Datapoints[j].Ts,
+				Val: safeDiv(dividend.Datapoints[j].Val, divisor.Datapoints[j].Val),
+			})
+		}
+		name := fmt.Sprintf("divideSeries(%s,%s)", dividend.Target, divisor.Target)
+		output := models.Series{
+			Target:       name,
+			QueryPatt:    name,
+			Datapoints:   out,
+			Interval:     divisor.Interval,
+			Consolidator: dividend.Consolidator,
+			QueryCons:    dividend.QueryCons,
+		}
+		cache[Req{}] = append(cache[Req{}], output)
+		series = append(series, output)
+	}
+	return series, nil
+}
+
+// checkPointCounts returns an error if the series, which are combined point by point, don't have the same number of points.
+// this happens when they have different intervals, e.g. because they were consolidated differently.
+func checkPointCounts(a, b models.Series) error {
+	if len(a.Datapoints) != len(b.Datapoints) {
+		return fmt.Errorf("can't combine %s and %s, they have a different number of points: %d and %d", a.Target, b.Target, len(a.Datapoints), len(b.Datapoints))
+	}
+	return nil
+}
+
+// safeDiv divides a by b like graphite does: dividing by zero results in null.
+func safeDiv(a, b float64) float64 {
+	if b == 0 {
+		return math.NaN()
+	}
+	return a / b
+}
@@ -0,0 +1,45 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestDivideSeriesLists(t *testing.T) {
+	f := NewDivideSeriesLists()
+	f.(*FuncDivideSeriesLists).dividends = NewMock(getAsPercentTestInput())
+	f.(*FuncDivideSeriesLists).divisors = NewMock([]models.Series{
+		{Target: "x", Datapoints: getCopy(c)},
+		{Target: "y", Datapoints: getCopy(c)},
+	})
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkTargets("divideSeriesLists", got, []string{"divideSeries(dc1.c,x)", "divideSeries(dc1.d,y)"}, t)
+	for i, p := range got[1].Datapoints {
+		exp := dAsPercentOfc[i].Val / 100
+		if !(math.IsNaN(exp) && math.IsNaN(p.Val)) && math.Abs(exp-p.Val) > 1e-9 {
+			t.Fatalf("output point %d - expected %v got %v", i, exp, p.Val)
+		}
+	}
+
+	f = NewDivideSeriesLists()
+	f.(*FuncDivideSeriesLists).dividends = NewMock(getAsPercentTestInput())
+	f.(*FuncDivideSeriesLists).divisors = NewMock(getAsPercentTestInput()[:1])
+	_, err = f.Exec(make(map[Req][]models.Series))
+	if err == nil {
+		t.Fatalf("expected error for series lists of different length")
+	}
+}
+
+func TestDivideSeriesListsPointCountMismatch(t *testing.T) {
+	f := NewDivideSeriesLists()
+	f.(*FuncDivideSeriesLists).dividends = NewMock(getAsPercentTestInput()[:1])
+	f.(*FuncDivideSeriesLists).divisors = NewMock([]models.Series{{Target: "short", QueryPatt: "short", Datapoints: getCopy(c)[:3]}})
+	if _, err := f.Exec(make(map[Req][]models.Series)); err == nil {
+		t.Fatalf("expected error for divisor with a different number of points")
+	}
+}
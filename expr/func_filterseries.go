@@ -0,0 +1,82 @@
+package expr
+
+import (
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncFilterSeries struct {
+	in        GraphiteFunc
+	fn        string
+	operator  string
+	threshold float64
+}
+
+func NewFilterSeries() GraphiteFunc {
+	return &FuncFilterSeries{}
+}
+
+// NewFilterSeriesConstructor returns a constructor for a function such as currentAbove
+// that works like filterSeries with a fixed summary function and operator
+func NewFilterSeriesConstructor(fn, operator string) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncFilterSeries{fn: fn, operator: operator}
+	}
+}
+
+func (s *FuncFilterSeries) Signature() ([]Arg, []Arg) {
+	if s.fn != "" {
+		return []Arg{
+			ArgSeriesList{val: &s.in},
+			ArgFloat{key: "n", val: &s.threshold},
+		}, []Arg{ArgSeriesList{}}
+	}
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "func", typ: paramAggFunc, validator: []Validator{IsSeriesSummaryFunc}, val: &s.fn},
+		ArgString{key: "operator", validator: []Validator{IsOperator}, val: &s.operator},
+		ArgFloat{key: "threshold", val: &s.threshold},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncFilterSeries) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncFilterSeries) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	compare := getOperatorFunc(s.operator)
+	var out []models.Series
+	for _, summarized := range summarizeSeries(series, getSeriesSummaryFunc(s.fn)) {
+		// like graphite, series that summarize to null are never returned
+		if math.IsNaN(summarized.val) {
+			continue
+		}
+		if compare(summarized.val, s.threshold) {
+			out = append(out, summarized.serie)
+		}
+	}
+	return out, nil
+}
+
+func getOperatorFunc(operator string) func(float64, float64) bool {
+	switch operator {
+	case "=":
+		return func(val, threshold float64) bool { return val == threshold }
+	case "!=":
+		return func(val, threshold float64) bool { return val != threshold }
+	case ">":
+		return func(val, threshold float64) bool { return val > threshold }
+	case ">=":
+		return func(val, threshold float64) bool { return val >= threshold }
+	case "<":
+		return func(val, threshold float64) bool { return val < threshold }
+	case "<=":
+		return func(val, threshold float64) bool { return val <= threshold }
+	}
+	return nil
+}
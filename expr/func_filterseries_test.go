@@ -0,0 +1,38 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestFilterSeries(t *testing.T) {
+	cases := []struct {
+		name      string
+		fn        string
+		operator  string
+		threshold float64
+		exp       []string
+	}{
+		{"currentAbove-100", "last", ">", 100, []string{"a", "b", "d"}},
+		{"currentBelow-250", "last", "<=", 250, []string{"c", "d"}},
+		{"averageBelow-100", "average", "<=", 100, []string{"c", "d"}},
+		{"maximumAbove-250", "max", ">", 250, []string{"a", "b"}},
+		{"minimumBelow-0", "min", "<=", 0, []string{"a", "b", "c", "d"}},
+		{"minimumAbove-0", "min", ">", 0, nil},
+		{"max-equal", "max", "=", 250, []string{"d"}},
+		{"max-not-equal", "max", "!=", 250, []string{"a", "b", "c"}},
+		{"sum-gte", "sum", ">=", 10, []string{"a", "b", "c", "d"}},
+		{"avg-lt", "avg", "<", 2, []string{"c"}},
+	}
+	for _, c := range cases {
+		f := NewFilterSeriesConstructor(c.fn, c.operator)()
+		f.(*FuncFilterSeries).in = NewMock(getSummaryTestInput())
+		f.(*FuncFilterSeries).threshold = c.threshold
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %q: err should be nil. got %q", c.name, err)
+		}
+		checkTargets(c.name, got, c.exp, t)
+	}
+}
@@ -20,5 +20,10 @@ func (s FuncGet) Context(context Context) Context {
 }
 
 func (s FuncGet) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
-	return cache[s.req], nil
+	// requests may be shared by several targets, and functions like alias modify
+	// the series they get (though not their datapoints), so each caller gets its own copy
+	in := cache[s.req]
+	out := make([]models.Series, len(in))
+	copy(out, in)
+	return out, nil
 }
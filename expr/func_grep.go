@@ -0,0 +1,45 @@
+package expr
+
+import (
+	"regexp"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncGrep struct {
+	in      GraphiteFunc
+	pattern *regexp.Regexp
+	exclude bool
+}
+
+// NewGrepConstructor returns a constructor for grep, or for exclude if exclude is set
+func NewGrepConstructor(exclude bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncGrep{exclude: exclude}
+	}
+}
+
+func (s *FuncGrep) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgRegex{key: "pattern", val: &s.pattern},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncGrep) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncGrep) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Series
+	for _, serie := range series {
+		if s.pattern.MatchString(serie.Target) != s.exclude {
+			out = append(out, serie)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,37 @@
+package expr
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestGrepExclude(t *testing.T) {
+	in := []models.Series{
+		{Target: "foo.bar.baz"},
+		{Target: "foo.baz.bar"},
+		{Target: "bar.foo"},
+	}
+	cases := []struct {
+		name    string
+		pattern string
+		exclude bool
+		exp     []string
+	}{
+		{"grep-prefix", "^foo", false, []string{"foo.bar.baz", "foo.baz.bar"}},
+		{"grep-none", "qux", false, nil},
+		{"exclude-prefix", "^foo", true, []string{"bar.foo"}},
+		{"exclude-suffix", `bar$`, true, []string{"foo.bar.baz", "bar.foo"}},
+	}
+	for _, c := range cases {
+		f := NewGrepConstructor(c.exclude)()
+		f.(*FuncGrep).in = NewMock(in)
+		f.(*FuncGrep).pattern = regexp.MustCompile(c.pattern)
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %q: err should be nil. got %q", c.name, err)
+		}
+		checkTargets(c.name, got, c.exp, t)
+	}
+}
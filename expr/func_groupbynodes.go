@@ -0,0 +1,102 @@
+package expr
+
+import (
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncGroupByNodes struct {
+	in         GraphiteFunc
+	aggregator string
+	nodes      []int64
+	node       int64 // for groupByNode, which takes a single node
+	single     bool
+}
+
+// NewGroupByNodesConstructor returns a constructor for groupByNodes, or for groupByNode if single is set
+func NewGroupByNodesConstructor(single bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncGroupByNodes{aggregator: "average", single: single}
+	}
+}
+
+func (s *FuncGroupByNodes) Signature() ([]Arg, []Arg) {
+	if s.single {
+		return []Arg{
+			ArgSeriesList{val: &s.in},
+			ArgInt{key: "nodeNum", val: &s.node},
+			ArgString{key: "callback", opt: true, typ: paramAggFunc, validator: []Validator{IsAggFunc}, val: &s.aggregator},
+		}, []Arg{ArgSeriesList{}}
+	}
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "callback", typ: paramAggFunc, validator: []Validator{IsAggFunc}, val: &s.aggregator},
+		ArgInts{key: "nodes", val: &s.nodes},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncGroupByNodes) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncGroupByNodes) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	nodes := s.nodes
+	if s.single {
+		nodes = []int64{s.node}
+	}
+
+	// keys tracks the order in which we first see each group
+	var keys []string
+	groups := make(map[string][]models.Series)
+	for _, serie := range series {
+		key := nodesKey(extractMetric(serie.Target), nodes)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], serie)
+	}
+
+	aggFunc := getCrossSeriesAggFunc(s.aggregator)
+	outputs := make([]models.Series, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		out := pointSlicePool.Get().([]schema.Point)
+		aggFunc(group, &out)
+		cons, queryCons := summarizeCons(group)
+		output := models.Series{
+			Target:       key,
+			QueryPatt:    key,
+			Datapoints:   out,
+			Interval:     group[0].Interval,
+			Consolidator: cons,
+			QueryCons:    queryCons,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
+
+// nodesKey returns the given nodes of the metric name, joined by '.'
+// negative nodes count from the end, and nodes out of range are ignored
+func nodesKey(metric string, nodes []int64) string {
+	parts := strings.Split(metric, ".")
+	var key []string
+	for _, n64 := range nodes {
+		n := int(n64)
+		if n < 0 {
+			n += len(parts)
+		}
+		if n >= len(parts) || n < 0 {
+			continue
+		}
+		key = append(key, parts[n])
+	}
+	return strings.Join(key, ".")
+}
@@ -0,0 +1,113 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func getGroupByNodesTestInput() []models.Series {
+	return []models.Series{
+		{Target: "dc1.host1.cpu", QueryPatt: "*.*.cpu", Datapoints: getCopy(c)},
+		{Target: "dc1.host2.cpu", QueryPatt: "*.*.cpu", Datapoints: getCopy(d)},
+		{Target: "dc2.host1.cpu", QueryPatt: "*.*.cpu", Datapoints: getCopy(a)},
+	}
+}
+
+var sumcd = []schema.Point{
+	{Val: 0, Ts: 10},
+	{Val: 33, Ts: 20},
+	{Val: 200, Ts: 30},
+	{Val: 31, Ts: 40},
+	{Val: 83, Ts: 50},
+	{Val: 254, Ts: 60},
+}
+
+func TestGroupByNode(t *testing.T) {
+	f := NewGroupByNodesConstructor(true)()
+	g := f.(*FuncGroupByNodes)
+	g.in = NewMock(getGroupByNodesTestInput())
+	g.node = 0
+	g.aggregator = "sum"
+	testGroupByNodes("groupByNode-sum", f, []models.Series{
+		{Target: "dc1", Datapoints: sumcd},
+		{Target: "dc2", Datapoints: getCopy(a)},
+	}, t)
+
+	f = NewGroupByNodesConstructor(true)()
+	g = f.(*FuncGroupByNodes)
+	g.in = NewMock(getGroupByNodesTestInput())
+	g.node = -2
+	testGroupByNodes("groupByNode-negative-default-avg", f, []models.Series{
+		{Target: "host1", Datapoints: getCopy(avgac)},
+		{Target: "host2", Datapoints: getCopy(d)},
+	}, t)
+}
+
+func TestGroupByNodes(t *testing.T) {
+	f := NewGroupByNodesConstructor(false)()
+	g := f.(*FuncGroupByNodes)
+	g.in = NewMock(getGroupByNodesTestInput())
+	g.nodes = []int64{0, 2}
+	g.aggregator = "sum"
+	testGroupByNodes("groupByNodes-sum", f, []models.Series{
+		{Target: "dc1.cpu", Datapoints: sumcd},
+		{Target: "dc2.cpu", Datapoints: getCopy(a)},
+	}, t)
+
+	f = NewGroupByNodesConstructor(false)()
+	g = f.(*FuncGroupByNodes)
+	g.in = NewMock(getGroupByNodesTestInput())
+	g.nodes = []int64{1, 2}
+	g.aggregator = "max"
+	testGroupByNodes("groupByNodes-max", f, []models.Series{
+		{Target: "host1.cpu", Datapoints: getCopy(maxac)},
+		{Target: "host2.cpu", Datapoints: getCopy(d)},
+	}, t)
+}
+
+var avgac = []schema.Point{
+	{Val: 0, Ts: 10},
+	{Val: 0, Ts: 20},
+	{Val: 3.25, Ts: 30},
+	{Val: 2, Ts: 40},
+	{Val: 3, Ts: 50},
+	{Val: 617283947, Ts: 60},
+}
+
+var maxac = []schema.Point{
+	{Val: 0, Ts: 10},
+	{Val: 0, Ts: 20},
+	{Val: 5.5, Ts: 30},
+	{Val: 2, Ts: 40},
+	{Val: 3, Ts: 50},
+	{Val: 1234567890, Ts: 60},
+}
+
+func testGroupByNodes(name string, f GraphiteFunc, out []models.Series, t *testing.T) {
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("case %q: err should be nil. got %q", name, err)
+	}
+	if len(got) != len(out) {
+		t.Fatalf("case %q: expected %d output series, got %d", name, len(out), len(got))
+	}
+	for i, exp := range out {
+		g := got[i]
+		if g.Target != exp.Target || g.QueryPatt != exp.Target {
+			t.Fatalf("case %q: expected target %q, got %q (querypatt %q)", name, exp.Target, g.Target, g.QueryPatt)
+		}
+		if len(g.Datapoints) != len(exp.Datapoints) {
+			t.Fatalf("case %q: len output expected %d, got %d", name, len(exp.Datapoints), len(g.Datapoints))
+		}
+		for j, p := range g.Datapoints {
+			bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp.Datapoints[j].Val)
+			if (bothNaN || p.Val == exp.Datapoints[j].Val) && p.Ts == exp.Datapoints[j].Ts {
+				continue
+			}
+			t.Fatalf("case %q: output point %d - expected %v got %v", name, j, exp.Datapoints[j], p)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package expr
+
+import (
+	"sort"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncGroupByTags struct {
+	in         GraphiteFunc
+	aggregator string
+	tags       []string
+}
+
+func NewGroupByTags() GraphiteFunc {
+	return &FuncGroupByTags{}
+}
+
+func (s *FuncGroupByTags) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "callback", typ: paramAggFunc, validator: []Validator{IsAggFunc}, val: &s.aggregator},
+		ArgStrings{key: "tags", val: &s.tags},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncGroupByTags) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncGroupByTags) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// like graphite, the groups are named after the name tag if it is requested, or after the callback otherwise,
+	// followed by the other requested tags in sorted order. e.g. sum;dc=east;host=a
+	tags := make([]string, 0, len(s.tags))
+	useName := false
+	for _, tag := range s.tags {
+		if tag == "name" {
+			useName = true
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// keys tracks the order in which we first see each group
+	var keys []string
+	groups := make(map[string][]models.Series)
+	groupTags := make(map[string]map[string]string)
+	for _, serie := range series {
+		name := s.aggregator
+		if useName {
+			name = serie.Tags["name"]
+		}
+		values := map[string]string{"name": name}
+		key := name
+		for _, tag := range tags {
+			values[tag] = serie.Tags[tag]
+			key += ";" + tag + "=" + values[tag]
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			groupTags[key] = values
+		}
+		groups[key] = append(groups[key], serie)
+	}
+
+	aggFunc := getCrossSeriesAggFunc(s.aggregator)
+	outputs := make([]models.Series, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		out := pointSlicePool.Get().([]schema.Point)
+		aggFunc(group, &out)
+		cons, queryCons := summarizeCons(group)
+		output := models.Series{
+			Target:       key,
+			Tags:         groupTags[key],
+			QueryPatt:    key,
+			Datapoints:   out,
+			Interval:     group[0].Interval,
+			Consolidator: cons,
+			QueryCons:    queryCons,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
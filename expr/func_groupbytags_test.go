@@ -0,0 +1,39 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestGroupByTags(t *testing.T) {
+	f := NewGroupByTags()
+	g := f.(*FuncGroupByTags)
+	g.in = NewMock(getTaggedTestInput())
+	g.aggregator = "sum"
+	g.tags = []string{"dc"}
+	testGroupByNodes("groupByTags-sum", f, []models.Series{
+		{Target: "sum;dc=dc1", Datapoints: sumcd},
+		{Target: "sum;dc=dc2", Datapoints: getCopy(a)},
+	}, t)
+
+	f = NewGroupByTags()
+	g = f.(*FuncGroupByTags)
+	g.in = NewMock(getTaggedTestInput())
+	g.aggregator = "max"
+	g.tags = []string{"rack", "name"}
+	testGroupByNodes("groupByTags-max-name", f, []models.Series{
+		{Target: "disk.used;rack=a1", Datapoints: getCopy(maxac)},
+		{Target: "disk.used;rack=a2", Datapoints: getCopy(d)},
+	}, t)
+
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	exp := map[string]string{"name": "disk.used", "rack": "a1"}
+	if !reflect.DeepEqual(got[0].Tags, exp) {
+		t.Fatalf("expected tags %v, got %v", exp, got[0].Tags)
+	}
+}
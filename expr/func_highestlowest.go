@@ -0,0 +1,73 @@
+package expr
+
+import (
+	"math"
+	"sort"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncHighestLowest struct {
+	in      GraphiteFunc
+	n       int64
+	fn      string
+	highest bool
+	generic bool // whether the summary function can be specified, as opposed to being fixed by the function name
+}
+
+// NewHighestLowestConstructor returns a constructor for highest/lowest style functions.
+// pass an empty fn for the generic highest() and lowest() which take the summary function as argument
+func NewHighestLowestConstructor(fn string, highest bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		if fn == "" {
+			return &FuncHighestLowest{n: 1, fn: "average", highest: highest, generic: true}
+		}
+		return &FuncHighestLowest{n: 1, fn: fn, highest: highest}
+	}
+}
+
+func (s *FuncHighestLowest) Signature() ([]Arg, []Arg) {
+	args := []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgInt{key: "n", opt: true, validator: []Validator{IntPositive}, val: &s.n},
+	}
+	if s.generic {
+		args = append(args, ArgString{key: "func", opt: true, typ: paramAggFunc, validator: []Validator{IsSeriesSummaryFunc}, val: &s.fn})
+	}
+	return args, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncHighestLowest) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncHighestLowest) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	summarized := summarizeSeries(series, getSeriesSummaryFunc(s.fn))
+
+	// like graphite, series that summarize to null always sort last
+	sort.SliceStable(summarized, func(i, j int) bool {
+		if math.IsNaN(summarized[i].val) {
+			return false
+		}
+		if math.IsNaN(summarized[j].val) {
+			return true
+		}
+		if s.highest {
+			return summarized[i].val > summarized[j].val
+		}
+		return summarized[i].val < summarized[j].val
+	})
+
+	if int(s.n) < len(summarized) {
+		summarized = summarized[:s.n]
+	}
+	out := make([]models.Series, 0, len(summarized))
+	for _, sum := range summarized {
+		out = append(out, sum.serie)
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+var allNaN = []schema.Point{
+	{Val: math.NaN(), Ts: 10},
+	{Val: math.NaN(), Ts: 20},
+	{Val: math.NaN(), Ts: 30},
+	{Val: math.NaN(), Ts: 40},
+	{Val: math.NaN(), Ts: 50},
+	{Val: math.NaN(), Ts: 60},
+}
+
+func getSummaryTestInput() []models.Series {
+	return []models.Series{
+		{Target: "a", QueryPatt: "*", Datapoints: getCopy(a)},
+		{Target: "nan", QueryPatt: "*", Datapoints: getCopy(allNaN)},
+		{Target: "b", QueryPatt: "*", Datapoints: getCopy(b)},
+		{Target: "c", QueryPatt: "*", Datapoints: getCopy(c)},
+		{Target: "d", QueryPatt: "*", Datapoints: getCopy(d)},
+	}
+}
+
+func TestHighestLowest(t *testing.T) {
+	cases := []struct {
+		name    string
+		fn      string
+		highest bool
+		n       int64
+		fnArg   string
+		exp     []string
+	}{
+		{"highestCurrent-2", "current", true, 2, "", []string{"a", "b"}},
+		{"highestCurrent-all", "current", true, 10, "", []string{"a", "b", "d", "c", "nan"}},
+		{"lowestCurrent-2", "current", false, 2, "", []string{"c", "d"}},
+		{"lowestCurrent-all", "current", false, 10, "", []string{"c", "d", "a", "b", "nan"}},
+		{"highestMax-1", "max", true, 1, "", []string{"b"}},
+		{"highestAverage-1", "average", true, 1, "", []string{"b"}},
+		{"lowestAverage-1", "average", false, 1, "", []string{"c"}},
+		{"highest-default", "", true, 1, "", []string{"b"}},
+		{"highest-sum", "", true, 2, "sum", []string{"b", "a"}},
+		{"lowest-max", "", false, 1, "max", []string{"c"}},
+	}
+	for _, c := range cases {
+		f := NewHighestLowestConstructor(c.fn, c.highest)()
+		hl := f.(*FuncHighestLowest)
+		hl.in = NewMock(getSummaryTestInput())
+		hl.n = c.n
+		if c.fnArg != "" {
+			hl.fn = c.fnArg
+		}
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %q: err should be nil. got %q", c.name, err)
+		}
+		checkTargets(c.name, got, c.exp, t)
+	}
+}
+
+func checkTargets(name string, got []models.Series, exp []string, t *testing.T) {
+	if len(got) != len(exp) {
+		t.Fatalf("case %q: expected %d output series, got %d", name, len(exp), len(got))
+	}
+	for i, g := range got {
+		if g.Target != exp[i] {
+			t.Fatalf("case %q: output series %d: expected target %q, got %q", name, i, exp[i], g.Target)
+		}
+	}
+}
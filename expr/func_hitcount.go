@@ -0,0 +1,127 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/raintank/dur"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncHitcount struct {
+	in              GraphiteFunc
+	intervalStr     string
+	alignToInterval bool
+
+	from     uint32
+	interval uint32
+}
+
+func NewHitcount() GraphiteFunc {
+	return &FuncHitcount{}
+}
+
+func (s *FuncHitcount) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "intervalString", typ: paramInterval, validator: []Validator{IsInterval}, val: &s.intervalStr},
+		ArgBool{key: "alignToInterval", opt: true, val: &s.alignToInterval},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context aligns the start of the range to the start of the day, hour or minute (in the timezone of the request)
+// if alignToInterval is set, like graphite does.
+func (s *FuncHitcount) Context(context Context) Context {
+	// the validator assures the interval is valid
+	s.interval, _ = dur.ParseNDuration(s.intervalStr)
+	// the points needed before from are buckets of our interval
+	context = context.prePointsToRange(s.interval)
+	if s.alignToInterval {
+		context.from = alignToCalendar(context.from, s.interval, context.loc)
+	}
+	s.from = context.from
+	context.consol = 0
+	return context
+}
+
+// Exec estimates the number of hits in each bucket, by multiplying the per-second rates of the input by
+// the time they cover. like graphite, points that span multiple buckets are spread out over them.
+// buckets are aligned to the end of the series, or to the start of the range if alignToInterval is set.
+func (s *FuncHitcount) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	interval := int64(s.interval)
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		if len(serie.Datapoints) != 0 {
+			step := int64(serie.Interval)
+			seriesStart := int64(serie.Datapoints[0].Ts)
+			seriesEnd := int64(serie.Datapoints[len(serie.Datapoints)-1].Ts) + step
+			if s.alignToInterval {
+				seriesStart = int64(s.from)
+			}
+			bucketCount := (seriesEnd - seriesStart + interval - 1) / interval
+			start := seriesEnd - bucketCount*interval
+			if s.alignToInterval {
+				start = seriesStart
+			}
+			for i := int64(0); i < bucketCount; i++ {
+				out = append(out, schema.Point{Val: math.NaN(), Ts: uint32(start + i*interval)})
+			}
+			add := func(bucket int64, hits float64) {
+				if math.IsNaN(out[bucket].Val) {
+					out[bucket].Val = 0
+				}
+				out[bucket].Val += hits
+			}
+			for _, p := range serie.Datapoints {
+				if math.IsNaN(p.Val) || int64(p.Ts) < start {
+					continue
+				}
+				startBucket, startMod := floorDiv(int64(p.Ts)-start, interval), (int64(p.Ts)-start)%interval
+				endBucket, endMod := floorDiv(int64(p.Ts)+step-start, interval), (int64(p.Ts)+step-start)%interval
+				if endBucket >= bucketCount {
+					endBucket = bucketCount - 1
+					endMod = interval
+				}
+				if startBucket >= bucketCount {
+					continue
+				}
+				if startBucket == endBucket {
+					add(startBucket, p.Val*float64(endMod-startMod))
+					continue
+				}
+				add(startBucket, p.Val*float64(interval-startMod))
+				for j := startBucket + 1; j < endBucket; j++ {
+					add(j, p.Val*float64(interval))
+				}
+				if endMod > 0 {
+					add(endBucket, p.Val*float64(endMod))
+				}
+			}
+		}
+
+		var name string
+		if s.alignToInterval {
+			name = fmt.Sprintf("hitcount(%s, \"%s\", true)", serie.Target, s.intervalStr)
+		} else {
+			name = fmt.Sprintf("hitcount(%s, \"%s\")", serie.Target, s.intervalStr)
+		}
+		output := models.Series{
+			Target:       name,
+			Tags:         serie.CopyTags(),
+			QueryPatt:    name,
+			Datapoints:   out,
+			Interval:     s.interval,
+			Consolidator: serie.Consolidator,
+			QueryCons:    serie.QueryCons,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,53 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestHitcount(t *testing.T) {
+	in := func() []models.Series {
+		points := getCopy(c)
+		for i := range points {
+			points[i].Ts += 1000
+		}
+		return []models.Series{{Target: "a", QueryPatt: "a", Interval: 10, Datapoints: points}}
+	}
+
+	f := NewHitcount()
+	h := f.(*FuncHitcount)
+	h.in = NewMock(in())
+	h.intervalStr = "25s"
+	f.Context(Context{from: 1010, to: 1070, loc: time.UTC})
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// points that span 2 buckets are spread over them, and buckets are aligned to the end
+	checkPoints("hitcount", got, `hitcount(a, "25s")`, []schema.Point{
+		{Val: 0, Ts: 995},
+		{Val: 20, Ts: 1020},
+		{Val: 80, Ts: 1045},
+	}, t)
+
+	f = NewHitcount()
+	h = f.(*FuncHitcount)
+	h.in = NewMock(in())
+	h.intervalStr = "1min"
+	h.alignToInterval = true
+	ctx := f.Context(Context{from: 1010, to: 1070, loc: time.UTC})
+	if ctx.from != 960 {
+		t.Fatalf("expected from to be aligned to 960, got %d", ctx.from)
+	}
+	got, err = f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("hitcount-alignToInterval", got, `hitcount(a, "1min", true)`, []schema.Point{
+		{Val: 0, Ts: 960},
+		{Val: 100, Ts: 1020},
+	}, t)
+}
@@ -0,0 +1,66 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncHoltWintersAberration struct {
+	in                GraphiteFunc
+	delta             float64
+	bootstrapInterval string
+	seasonality       string
+}
+
+func NewHoltWintersAberration() GraphiteFunc {
+	return &FuncHoltWintersAberration{delta: 3, bootstrapInterval: "7d", seasonality: "1d"}
+}
+
+func (s *FuncHoltWintersAberration) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "delta", opt: true, val: &s.delta},
+		ArgString{key: "bootstrapInterval", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.bootstrapInterval},
+		ArgString{key: "seasonality", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.seasonality},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests the bootstrap period before from, which is used to train the model
+func (s *FuncHoltWintersAberration) Context(context Context) Context {
+	return context.extendFrom(absTimeOffset(s.bootstrapInterval))
+}
+
+// Exec returns, for each point, how far it lies outside of the confidence bands, or 0 if it doesn't
+func (s *FuncHoltWintersAberration) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		bootstrapPoints, seasonLength := holtWintersParams(s.bootstrapInterval, s.seasonality, serie.Interval, len(serie.Datapoints))
+		predictions, deviations := holtWintersAnalysis(serie.Datapoints, seasonLength)
+
+		out := pointSlicePool.Get().([]schema.Point)
+		for i := bootstrapPoints; i < len(serie.Datapoints); i++ {
+			actual := serie.Datapoints[i].Val
+			lower, upper := holtWintersBands(predictions[i], deviations[i], s.delta)
+			aberration := 0.0
+			if !math.IsNaN(actual) {
+				// comparisons against NaN bands are always false
+				if actual > upper {
+					aberration = actual - upper
+				} else if actual < lower {
+					aberration = actual - lower
+				}
+			}
+			out = append(out, schema.Point{Val: aberration, Ts: serie.Datapoints[i].Ts})
+		}
+		name := fmt.Sprintf("holtWintersAberration(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,22 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestHoltWintersAberration(t *testing.T) {
+	f := NewHoltWintersAberration()
+	f.(*FuncHoltWintersAberration).in = NewMock(getHoltWintersTestInput())
+	f.(*FuncHoltWintersAberration).bootstrapInterval = "40s"
+	f.(*FuncHoltWintersAberration).seasonality = "20s"
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 output series, got %d", len(got))
+	}
+	checkHoltWinters(got[0], "holtWintersAberration(a)", []float64{0, 0, -1.3713080699515974, 0, 0, 7.941346896628033}, t)
+}
@@ -0,0 +1,65 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncHoltWintersConfidenceBands struct {
+	in                GraphiteFunc
+	delta             float64
+	bootstrapInterval string
+	seasonality       string
+}
+
+func NewHoltWintersConfidenceBands() GraphiteFunc {
+	return &FuncHoltWintersConfidenceBands{delta: 3, bootstrapInterval: "7d", seasonality: "1d"}
+}
+
+func (s *FuncHoltWintersConfidenceBands) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "delta", opt: true, val: &s.delta},
+		ArgString{key: "bootstrapInterval", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.bootstrapInterval},
+		ArgString{key: "seasonality", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.seasonality},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests the bootstrap period before from, which is used to train the model
+func (s *FuncHoltWintersConfidenceBands) Context(context Context) Context {
+	return context.extendFrom(absTimeOffset(s.bootstrapInterval))
+}
+
+// Exec returns a lower and an upper band for each input series, in that order
+func (s *FuncHoltWintersConfidenceBands) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		bootstrapPoints, seasonLength := holtWintersParams(s.bootstrapInterval, s.seasonality, serie.Interval, len(serie.Datapoints))
+		predictions, deviations := holtWintersAnalysis(serie.Datapoints, seasonLength)
+
+		lower := pointSlicePool.Get().([]schema.Point)
+		upper := pointSlicePool.Get().([]schema.Point)
+		for i := bootstrapPoints; i < len(serie.Datapoints); i++ {
+			ts := serie.Datapoints[i].Ts
+			lowerVal, upperVal := holtWintersBands(predictions[i], deviations[i], s.delta)
+			lower = append(lower, schema.Point{Val: lowerVal, Ts: ts})
+			upper = append(upper, schema.Point{Val: upperVal, Ts: ts})
+		}
+		for _, band := range []struct {
+			name   string
+			points []schema.Point
+		}{
+			{fmt.Sprintf("holtWintersConfidenceLower(%s)", serie.Target), lower},
+			{fmt.Sprintf("holtWintersConfidenceUpper(%s)", serie.Target), upper},
+		} {
+			outputs = append(outputs, deriveSeries(cache, serie, band.name, band.points))
+		}
+	}
+	return outputs, nil
+}
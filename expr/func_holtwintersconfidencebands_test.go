@@ -0,0 +1,24 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestHoltWintersConfidenceBands(t *testing.T) {
+	f := NewHoltWintersConfidenceBands()
+	f.(*FuncHoltWintersConfidenceBands).in = NewMock(getHoltWintersTestInput())
+	f.(*FuncHoltWintersConfidenceBands).bootstrapInterval = "40s"
+	f.(*FuncHoltWintersConfidenceBands).seasonality = "20s"
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 output series, got %d", len(got))
+	}
+	checkHoltWinters(got[0], "holtWintersConfidenceLower(a)", []float64{1.60925397108575, math.NaN(), 4.371308069951597, 2.469939870871819, 3.9415002265678867, -1.5985940859270302}, t)
+	checkHoltWinters(got[1], "holtWintersConfidenceUpper(a)", []float64{1.60925397108575, math.NaN(), 5.546714987052967, 7.798011975907903, 5.402595028470693, 12.058653103371967}, t)
+}
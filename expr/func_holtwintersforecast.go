@@ -0,0 +1,51 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncHoltWintersForecast struct {
+	in                GraphiteFunc
+	bootstrapInterval string
+	seasonality       string
+}
+
+func NewHoltWintersForecast() GraphiteFunc {
+	return &FuncHoltWintersForecast{bootstrapInterval: "7d", seasonality: "1d"}
+}
+
+func (s *FuncHoltWintersForecast) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "bootstrapInterval", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.bootstrapInterval},
+		ArgString{key: "seasonality", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.seasonality},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests the bootstrap period before from, which is used to train the model
+func (s *FuncHoltWintersForecast) Context(context Context) Context {
+	return context.extendFrom(absTimeOffset(s.bootstrapInterval))
+}
+
+func (s *FuncHoltWintersForecast) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		bootstrapPoints, seasonLength := holtWintersParams(s.bootstrapInterval, s.seasonality, serie.Interval, len(serie.Datapoints))
+		predictions, _ := holtWintersAnalysis(serie.Datapoints, seasonLength)
+
+		out := pointSlicePool.Get().([]schema.Point)
+		for i := bootstrapPoints; i < len(serie.Datapoints); i++ {
+			out = append(out, schema.Point{Val: predictions[i], Ts: serie.Datapoints[i].Ts})
+		}
+		name := fmt.Sprintf("holtWintersForecast(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,23 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestHoltWintersForecast(t *testing.T) {
+	f := NewHoltWintersForecast()
+	f.(*FuncHoltWintersForecast).in = NewMock(getHoltWintersTestInput())
+	f.(*FuncHoltWintersForecast).bootstrapInterval = "40s"
+	f.(*FuncHoltWintersForecast).seasonality = "20s"
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 output series, got %d", len(got))
+	}
+	checkHoltWinters(got[0], "holtWintersForecast(a)", []float64{1.60925397108575, math.NaN(), 4.959011528502282, 5.133975923389861, 4.67204762751929, 5.230029508722468}, t)
+}
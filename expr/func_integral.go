@@ -0,0 +1,59 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncIntegral struct {
+	in GraphiteFunc
+}
+
+func NewIntegral() GraphiteFunc {
+	return &FuncIntegral{}
+}
+
+func (s *FuncIntegral) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncIntegral) Context(context Context) Context {
+	context.consol = 0
+	return context
+}
+
+func (s *FuncIntegral) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		current := 0.0
+		for _, p := range serie.Datapoints {
+			// nulls stay null, and don't affect the running total
+			if !math.IsNaN(p.Val) {
+				current += p.Val
+				p.Val = current
+			}
+			out = append(out, p)
+		}
+		name := fmt.Sprintf("integral(%s)", serie.Target)
+		output := models.Series{
+			Target:     name,
+			Tags:       serie.CopyTags(),
+			QueryPatt:  name,
+			Datapoints: out,
+			Interval:   serie.Interval,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,27 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestIntegral(t *testing.T) {
+	f := NewIntegral()
+	f.(*FuncIntegral).in = NewMock(getCounterTestInput())
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("integral", got, "integral(a)", []schema.Point{
+		{Val: 10, Ts: 10},
+		{Val: 25, Ts: 20},
+		{Val: math.NaN(), Ts: 30},
+		{Val: 45, Ts: 40},
+		{Val: 67, Ts: 50},
+		{Val: 72, Ts: 60},
+		{Val: 102, Ts: 70},
+	}, t)
+}
@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncInvert struct {
+	in GraphiteFunc
+}
+
+func NewInvert() GraphiteFunc {
+	return &FuncInvert{}
+}
+
+func (s *FuncInvert) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncInvert) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncInvert) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		for i, p := range serie.Datapoints {
+			out[i] = schema.Point{Val: safePow(p.Val, -1), Ts: p.Ts}
+		}
+		name := fmt.Sprintf("invert(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInvert(t *testing.T) {
+	nan := math.NaN()
+	testTransform("invert", &FuncInvert{in: NewMock(getTransformTestInput())}, "invert(a)", []float64{-0.25, nan, nan, 0.25, 0.0625}, t)
+}
@@ -0,0 +1,68 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncKeepLastValue struct {
+	in    GraphiteFunc
+	limit int64
+}
+
+func NewKeepLastValue() GraphiteFunc {
+	return &FuncKeepLastValue{limit: math.MaxInt64}
+}
+
+func (s *FuncKeepLastValue) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgInt{key: "limit", opt: true, val: &s.limit},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncKeepLastValue) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncKeepLastValue) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		copy(out, serie.Datapoints)
+
+		// like graphite, runs of nulls are only filled in if they're not longer than the limit.
+		// the first point can never be filled in as we don't know what came before it.
+		var consecutiveNaNs int64
+		for i := 1; i < len(out); i++ {
+			if math.IsNaN(out[i].Val) {
+				consecutiveNaNs++
+				continue
+			}
+			if consecutiveNaNs > 0 && consecutiveNaNs <= s.limit {
+				fillNaNs(out[i-int(consecutiveNaNs):i], out[i-int(consecutiveNaNs)-1].Val)
+			}
+			consecutiveNaNs = 0
+		}
+		if consecutiveNaNs > 0 && consecutiveNaNs <= s.limit {
+			fillNaNs(out[len(out)-int(consecutiveNaNs):], out[len(out)-int(consecutiveNaNs)-1].Val)
+		}
+
+		name := fmt.Sprintf("keepLastValue(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
+
+func fillNaNs(points []schema.Point, val float64) {
+	for i := range points {
+		points[i].Val = val
+	}
+}
@@ -0,0 +1,38 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestKeepLastValue(t *testing.T) {
+	nan := math.NaN()
+	in := []float64{nan, 1, nan, 2, nan, nan, nan, 3, nan, nan}
+	cases := []struct {
+		limit int64
+		exp   []float64
+	}{
+		{math.MaxInt64, []float64{nan, 1, 1, 2, 2, 2, 2, 3, 3, 3}},
+		{2, []float64{nan, 1, 1, 2, nan, nan, nan, 3, 3, 3}},
+		{1, []float64{nan, 1, 1, 2, nan, nan, nan, 3, nan, nan}},
+		{0, in},
+	}
+	for _, c := range cases {
+		var points, exp []schema.Point
+		for i := range in {
+			points = append(points, schema.Point{Val: in[i], Ts: uint32(10 * (i + 1))})
+			exp = append(exp, schema.Point{Val: c.exp[i], Ts: uint32(10 * (i + 1))})
+		}
+		f := NewKeepLastValue()
+		f.(*FuncKeepLastValue).in = NewMock([]models.Series{{Target: "a", QueryPatt: "a", Interval: 10, Datapoints: points}})
+		f.(*FuncKeepLastValue).limit = c.limit
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("limit %d: err should be nil. got %q", c.limit, err)
+		}
+		checkPoints("keepLastValue", got, "keepLastValue(a)", exp, t)
+	}
+}
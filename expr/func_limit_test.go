@@ -0,0 +1,18 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestLimit(t *testing.T) {
+	f := NewLimit()
+	f.(*FuncLimit).in = NewMock(getSummaryTestInput())
+	f.(*FuncLimit).n = 2
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkTargets("limit", got, []string{"a", "nan"}, t)
+}
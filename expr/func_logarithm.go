@@ -0,0 +1,55 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncLogarithm struct {
+	in   GraphiteFunc
+	base float64
+}
+
+func NewLogarithm() GraphiteFunc {
+	return &FuncLogarithm{base: 10}
+}
+
+func (s *FuncLogarithm) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "base", opt: true, val: &s.base},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncLogarithm) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncLogarithm) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		for i, p := range serie.Datapoints {
+			out[i] = schema.Point{Val: safeLog(p.Val, s.base), Ts: p.Ts}
+		}
+		name := fmt.Sprintf("log(%s, %g)", serie.Target, s.base)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
+
+// safeLog returns the logarithm of val in the given base.
+// like graphite, the logarithm of values that are not positive, or in a base that is not positive or 1, is null
+func safeLog(val, base float64) float64 {
+	if val <= 0 || base <= 0 || base == 1 {
+		return math.NaN()
+	}
+	return math.Log(val) / math.Log(base)
+}
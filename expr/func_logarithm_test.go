@@ -0,0 +1,25 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLogarithm(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		base      float64
+		expTarget string
+		exp       []float64
+	}{
+		{2, "log(a, 2)", []float64{nan, nan, nan, 2, 4}},
+		{0.5, "log(a, 0.5)", []float64{nan, nan, nan, -2, -4}},
+		// there is no logarithm in a base that is not positive or 1
+		{1, "log(a, 1)", []float64{nan, nan, nan, nan, nan}},
+		{0, "log(a, 0)", []float64{nan, nan, nan, nan, nan}},
+		{-2, "log(a, -2)", []float64{nan, nan, nan, nan, nan}},
+	}
+	for _, c := range cases {
+		testTransform(c.expTarget, &FuncLogarithm{in: NewMock(getTransformTestInput()), base: c.base}, c.expTarget, c.exp, t)
+	}
+}
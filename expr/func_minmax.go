@@ -0,0 +1,59 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncMinMax struct {
+	in GraphiteFunc
+}
+
+func NewMinMax() GraphiteFunc {
+	return &FuncMinMax{}
+}
+
+func (s *FuncMinMax) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncMinMax) Context(context Context) Context {
+	return context
+}
+
+// Exec normalizes each series to the range [0, 1], based on its minimum and maximum value.
+// like graphite, series with a single distinct value are normalized to 0.
+func (s *FuncMinMax) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		var min, max float64
+		if len(serie.Datapoints) != 0 {
+			min = batch.Min(serie.Datapoints)
+			max = batch.Max(serie.Datapoints)
+		}
+		out := pointSlicePool.Get().([]schema.Point)
+		for _, p := range serie.Datapoints {
+			if !math.IsNaN(p.Val) {
+				if max == min {
+					p.Val = 0
+				} else {
+					p.Val = (p.Val - min) / (max - min)
+				}
+			}
+			out = append(out, p)
+		}
+		name := fmt.Sprintf("minMax(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,31 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestMinMax(t *testing.T) {
+	nan := math.NaN()
+	testTransform("minMax", &FuncMinMax{in: NewMock(getTransformTestInput())}, "minMax(a)", []float64{0, 0.2, nan, 0.4, 1}, t)
+}
+
+func TestMinMaxConstant(t *testing.T) {
+	f := NewMinMax()
+	f.(*FuncMinMax).in = NewMock([]models.Series{
+		{
+			Target:     "c",
+			QueryPatt:  "c",
+			Datapoints: []schema.Point{{Val: 5, Ts: 10}, {Val: math.NaN(), Ts: 20}, {Val: 5, Ts: 30}},
+		},
+	})
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// like graphite, a series with a single distinct value is normalized to 0
+	checkPoints("minMax-constant", got, "minMax(c)", []schema.Point{{Val: 0, Ts: 10}, {Val: math.NaN(), Ts: 20}, {Val: 0, Ts: 30}}, t)
+}
@@ -0,0 +1,127 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncMovingWindow struct {
+	in             GraphiteFunc
+	windowPoints   int64
+	windowDuration string
+	fn             string
+	xFilesFactor   float64
+	generic        bool // whether the aggregation function can be specified, as opposed to being fixed by the function name
+}
+
+func NewMovingWindow() GraphiteFunc {
+	return &FuncMovingWindow{fn: "average", generic: true}
+}
+
+// NewMovingWindowConstructor returns a constructor for a function such as movingAverage
+// that works like movingWindow with a fixed aggregation function
+func NewMovingWindowConstructor(fn string) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncMovingWindow{fn: fn}
+	}
+}
+
+func (s *FuncMovingWindow) Signature() ([]Arg, []Arg) {
+	args := []Arg{
+		ArgSeriesList{val: &s.in},
+		// the window can be a number of points, or a duration string
+		ArgIn{
+			key: "windowSize",
+			args: []Arg{
+				ArgInt{key: "windowSize", validator: []Validator{IntPositive}, val: &s.windowPoints},
+				ArgString{key: "windowSize", typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.windowDuration},
+			},
+		},
+	}
+	if s.generic {
+		args = append(args, ArgString{key: "func", opt: true, typ: paramAggFunc, validator: []Validator{IsWindowAggFunc}, val: &s.fn})
+	}
+	args = append(args, ArgFloat{key: "xFilesFactor", opt: true, val: &s.xFilesFactor})
+	return args, []Arg{ArgSeriesList{}}
+}
+
+// Context extends the requested time range with the window, so that the first output points can be computed
+// with a full window worth of data
+func (s *FuncMovingWindow) Context(context Context) Context {
+	if s.windowDuration != "" {
+		context = context.extendFrom(s.windowSeconds())
+	} else {
+		context.prePoints += uint32(s.windowPoints)
+	}
+	return context
+}
+
+// windowSeconds returns the length of a window specified as duration.
+// like graphite, it ignores the sign.
+func (s *FuncMovingWindow) windowSeconds() int64 {
+	// the validator assures the offset is valid
+	return absTimeOffset(s.windowDuration)
+}
+
+func (s *FuncMovingWindow) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	aggFunc := getWindowAggFunc(s.fn)
+	funcName := "moving" + strings.ToUpper(s.fn[:1]) + s.fn[1:]
+
+	var outputs []models.Series
+	for _, serie := range series {
+		var name string
+		windowPoints := int(s.windowPoints)
+		if s.windowDuration != "" {
+			name = fmt.Sprintf("%s(%s,\"%s\")", funcName, serie.Target, s.windowDuration)
+			if serie.Interval > 0 {
+				windowPoints = int(s.windowSeconds() / int64(serie.Interval))
+			}
+		} else {
+			name = fmt.Sprintf("%s(%s,%s)", funcName, serie.Target, strconv.FormatInt(s.windowPoints, 10))
+		}
+
+		// the input has (at least) a window worth of extra points before the requested range.
+		// like graphite, each output point is the aggregate of the window of points preceding it.
+		var out []schema.Point
+		if len(serie.Datapoints) > windowPoints {
+			out = getPoints(len(serie.Datapoints) - windowPoints)
+		} else {
+			out = getPoints(0)
+		}
+		for i := range out {
+			window := serie.Datapoints[i : i+windowPoints]
+			val := math.NaN()
+			if windowPoints > 0 && xff(window, s.xFilesFactor) {
+				val = aggFunc(window)
+			}
+			out[i] = schema.Point{Val: val, Ts: serie.Datapoints[i+windowPoints].Ts}
+		}
+
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
+
+// xff returns whether the ratio of non-null points in the window is at least the given xFilesFactor.
+// windows with only nulls never pass.
+func xff(window []schema.Point, xFilesFactor float64) bool {
+	nonNull := 0
+	for _, p := range window {
+		if !math.IsNaN(p.Val) {
+			nonNull++
+		}
+	}
+	if nonNull == 0 {
+		return false
+	}
+	return float64(nonNull)/float64(len(window)) >= xFilesFactor
+}
@@ -0,0 +1,82 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func getMovingWindowTestInput() []models.Series {
+	return []models.Series{
+		{
+			Target:    "a",
+			QueryPatt: "a",
+			Interval:  10,
+			Datapoints: []schema.Point{
+				{Val: 1, Ts: 10},
+				{Val: 2, Ts: 20},
+				{Val: math.NaN(), Ts: 30},
+				{Val: 6, Ts: 40},
+				{Val: math.NaN(), Ts: 50},
+				{Val: math.NaN(), Ts: 60},
+				{Val: 3, Ts: 70},
+			},
+		},
+	}
+}
+
+func TestMovingWindow(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		fn             string
+		windowPoints   int64
+		windowDuration string
+		xFilesFactor   float64
+		expName        string
+		expVals        []float64
+	}{
+		{"average", 2, "", 0, "movingAverage(a,2)", []float64{1.5, 2, 6, 6, nan}},
+		{"average", 0, "20s", 0, `movingAverage(a,"20s")`, []float64{1.5, 2, 6, 6, nan}},
+		{"average", 0, "-20s", 0, `movingAverage(a,"-20s")`, []float64{1.5, 2, 6, 6, nan}},
+		{"average", 2, "", 0.6, "movingAverage(a,2)", []float64{1.5, nan, nan, nan, nan}},
+		{"sum", 3, "", 0, "movingSum(a,3)", []float64{3, 8, 6, 6}},
+		{"min", 3, "", 0, "movingMin(a,3)", []float64{1, 2, 6, 6}},
+		{"max", 3, "", 0, "movingMax(a,3)", []float64{2, 6, 6, 6}},
+		{"median", 3, "", 0, "movingMedian(a,3)", []float64{1.5, 4, 6, 6}},
+		{"diff", 3, "", 0, "movingDiff(a,3)", []float64{-1, -4, 6, 6}},
+		{"range", 3, "", 0, "movingRange(a,3)", []float64{1, 4, 0, 0}},
+		{"count", 3, "", 0, "movingCount(a,3)", []float64{2, 2, 1, 1}},
+		{"average", 10, "", 0, "movingAverage(a,10)", nil},
+	}
+	for _, c := range cases {
+		f := NewMovingWindow()
+		f.(*FuncMovingWindow).in = NewMock(getMovingWindowTestInput())
+		f.(*FuncMovingWindow).fn = c.fn
+		f.(*FuncMovingWindow).windowPoints = c.windowPoints
+		f.(*FuncMovingWindow).windowDuration = c.windowDuration
+		f.(*FuncMovingWindow).xFilesFactor = c.xFilesFactor
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("%s: err should be nil. got %q", c.expName, err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("%s: expected 1 output series, got %d", c.expName, len(got))
+		}
+		if got[0].Target != c.expName {
+			t.Errorf("expected name %q, got %q", c.expName, got[0].Target)
+		}
+		if len(got[0].Datapoints) != len(c.expVals) {
+			t.Fatalf("%s: expected %d points, got %d", c.expName, len(c.expVals), len(got[0].Datapoints))
+		}
+		offset := len(getMovingWindowTestInput()[0].Datapoints) - len(c.expVals)
+		for i, p := range got[0].Datapoints {
+			expTs := uint32(10 * (i + offset + 1))
+			bothNaN := math.IsNaN(p.Val) && math.IsNaN(c.expVals[i])
+			if p.Ts != expTs || (!bothNaN && p.Val != c.expVals[i]) {
+				t.Errorf("%s: point %d: expected ts %d val %f, got ts %d val %f", c.expName, i, expTs, c.expVals[i], p.Ts, p.Val)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncNonNegativeDerivative struct {
+	in       GraphiteFunc
+	maxValue float64
+	minValue float64
+}
+
+func NewNonNegativeDerivative() GraphiteFunc {
+	return &FuncNonNegativeDerivative{maxValue: math.NaN(), minValue: math.NaN()}
+}
+
+func (s *FuncNonNegativeDerivative) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "maxValue", opt: true, val: &s.maxValue},
+		ArgFloat{key: "minValue", opt: true, val: &s.minValue},
+	}, []Arg{ArgSeriesList{}}
+}
+
+// Context requests one extra point before from, so that the first point in the requested range has a predecessor
+func (s *FuncNonNegativeDerivative) Context(context Context) Context {
+	context.consol = 0
+	context.prePoints++
+	return context
+}
+
+func (s *FuncNonNegativeDerivative) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		prev := math.NaN()
+		for i, p := range serie.Datapoints {
+			var delta float64
+			delta, prev = nonNegativeDelta(p.Val, prev, s.maxValue, s.minValue)
+			// the first point is only used as the base for the next
+			if i > 0 {
+				out = append(out, schema.Point{Val: delta, Ts: p.Ts})
+			}
+		}
+		name := fmt.Sprintf("nonNegativeDerivative(%s)", serie.Target)
+		output := models.Series{
+			Target:     name,
+			Tags:       serie.CopyTags(),
+			QueryPatt:  name,
+			Datapoints: out,
+			Interval:   serie.Interval,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
+
+// nonNegativeDelta returns the increase of a counter from prev to val, and the value to use as prev for the next point, like graphite does:
+// * values outside of [minValue, maxValue] are ignored, and the next point has no predecessor
+// * if the counter decreased and maxValue is set, the counter is assumed to have wrapped around at maxValue
+// * if the counter decreased and minValue is set, the counter is assumed to have reset to minValue
+// * otherwise, the increase can't be known and NaN is returned
+// pass NaN for maxValue and/or minValue to leave them unset.
+func nonNegativeDelta(val, prev, maxValue, minValue float64) (float64, float64) {
+	if val > maxValue || val < minValue {
+		return math.NaN(), math.NaN()
+	}
+	if math.IsNaN(prev) || math.IsNaN(val) {
+		return math.NaN(), val
+	}
+	if val >= prev {
+		return val - prev, val
+	}
+	if !math.IsNaN(maxValue) {
+		return maxValue + 1 + val - prev, val
+	}
+	if !math.IsNaN(minValue) {
+		return val - minValue, val
+	}
+	return math.NaN(), val
+}
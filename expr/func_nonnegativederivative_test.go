@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestNonNegativeDerivative(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		name     string
+		maxValue float64
+		minValue float64
+		exp      []float64
+	}{
+		{"no-max-min", nan, nan, []float64{5, nan, nan, 2, nan, 25}},
+		{"max", 30, nan, []float64{5, nan, nan, 2, 14, 25}},
+		{"max-exceeded", 25, nan, []float64{5, nan, nan, 2, 9, nan}},
+		// points above the maximum are ignored, so the next point has no predecessor
+		{"max-exceeded-mid", 21, nan, []float64{5, nan, nan, nan, nan, nan}},
+		{"min", nan, 0, []float64{5, nan, nan, 2, 5, 25}},
+		// points below the minimum are ignored, so the next point has no predecessor
+		{"min-exceeded", nan, 12, []float64{nan, nan, nan, 2, nan, nan}},
+	}
+	for _, c := range cases {
+		f := NewNonNegativeDerivative()
+		f.(*FuncNonNegativeDerivative).in = NewMock(getCounterTestInput())
+		f.(*FuncNonNegativeDerivative).maxValue = c.maxValue
+		f.(*FuncNonNegativeDerivative).minValue = c.minValue
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("%s: err should be nil. got %q", c.name, err)
+		}
+		var exp []schema.Point
+		for i, v := range c.exp {
+			exp = append(exp, schema.Point{Val: v, Ts: uint32(20 + 10*i)})
+		}
+		checkPoints(c.name, got, "nonNegativeDerivative(a)", exp, t)
+	}
+}
@@ -0,0 +1,62 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncNPercentile struct {
+	in GraphiteFunc
+	n  float64
+}
+
+func NewNPercentile() GraphiteFunc {
+	return &FuncNPercentile{}
+}
+
+func (s *FuncNPercentile) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "n", validator: []Validator{IsPercent}, val: &s.n},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncNPercentile) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncNPercentile) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		// like graphite, series without any non-null values are dropped
+		val, ok := seriesPercentile(serie, s.n)
+		if !ok {
+			continue
+		}
+		out := pointSlicePool.Get().([]schema.Point)
+		for _, p := range serie.Datapoints {
+			out = append(out, schema.Point{Val: val, Ts: p.Ts})
+		}
+		name := fmt.Sprintf("nPercentile(%s, %g)", serie.Target, s.n)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
+
+// seriesPercentile returns the n-th percentile of the non-null values of the series (without interpolation),
+// and false if the series doesn't have any non-null values
+func seriesPercentile(serie models.Series, n float64) (float64, bool) {
+	col := getFloats(len(serie.Datapoints), 0)
+	defer putFloats(col)
+	vals := sortedValues(serie.Datapoints, col)
+	if len(vals) == 0 {
+		return 0, false
+	}
+	return percentile(vals, n, false), true
+}
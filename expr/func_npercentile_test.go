@@ -0,0 +1,28 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestNPercentile(t *testing.T) {
+	in := append(getRemoveTestInput(), models.Series{
+		Target:     "b",
+		QueryPatt:  "b",
+		Datapoints: []schema.Point{{Val: math.NaN(), Ts: 10}},
+	})
+	f := NewNPercentile()
+	f.(*FuncNPercentile).in = NewMock(in)
+	f.(*FuncNPercentile).n = 80
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// the series without non-null values is dropped, like graphite does
+	checkPoints("nPercentile", got, "nPercentile(a, 80)", []schema.Point{
+		{Val: 5, Ts: 10}, {Val: 5, Ts: 20}, {Val: 5, Ts: 30}, {Val: 5, Ts: 40}, {Val: 5, Ts: 50}, {Val: 5, Ts: 60},
+	}, t)
+}
@@ -0,0 +1,45 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncOffset struct {
+	in     GraphiteFunc
+	factor float64
+}
+
+func NewOffset() GraphiteFunc {
+	return &FuncOffset{}
+}
+
+func (s *FuncOffset) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "factor", val: &s.factor},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncOffset) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncOffset) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		for i, p := range serie.Datapoints {
+			out[i] = schema.Point{Val: p.Val + s.factor, Ts: p.Ts}
+		}
+		name := fmt.Sprintf("offset(%s,%g)", serie.Target, s.factor)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOffset(t *testing.T) {
+	nan := math.NaN()
+	testTransform("offset", &FuncOffset{in: NewMock(getTransformTestInput()), factor: 1.5}, "offset(a,1.5)", []float64{-2.5, 1.5, nan, 5.5, 17.5}, t)
+}
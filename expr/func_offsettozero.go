@@ -0,0 +1,52 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncOffsetToZero struct {
+	in GraphiteFunc
+}
+
+func NewOffsetToZero() GraphiteFunc {
+	return &FuncOffsetToZero{}
+}
+
+func (s *FuncOffsetToZero) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncOffsetToZero) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncOffsetToZero) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		var min float64
+		if len(serie.Datapoints) != 0 {
+			min = batch.Min(serie.Datapoints)
+		}
+		out := pointSlicePool.Get().([]schema.Point)
+		for _, p := range serie.Datapoints {
+			if !math.IsNaN(p.Val) {
+				p.Val -= min
+			}
+			out = append(out, p)
+		}
+		name := fmt.Sprintf("offsetToZero(%s)", serie.Target)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOffsetToZero(t *testing.T) {
+	nan := math.NaN()
+	testTransform("offsetToZero", &FuncOffsetToZero{in: NewMock(getTransformTestInput())}, "offsetToZero(a)", []float64{0, 4, nan, 8, 20}, t)
+}
@@ -0,0 +1,58 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncPercentileOfSeries struct {
+	in          GraphiteFunc
+	n           float64
+	interpolate bool
+}
+
+func NewPercentileOfSeries() GraphiteFunc {
+	return &FuncPercentileOfSeries{}
+}
+
+func (s *FuncPercentileOfSeries) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "n", validator: []Validator{IsPercent}, val: &s.n},
+		ArgBool{key: "interpolate", opt: true, val: &s.interpolate},
+	}, []Arg{ArgSeries{}}
+}
+
+func (s *FuncPercentileOfSeries) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncPercentileOfSeries) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return series, nil
+	}
+
+	out := pointSlicePool.Get().([]schema.Point)
+	getCrossSeriesPercentileFunc(s.n, s.interpolate)(series, &out)
+
+	cons, queryCons := summarizeCons(series)
+	// like graphite, the name is based on the path expression of the first series
+	name := fmt.Sprintf("percentileOfSeries(%s,%g)", series[0].QueryPatt, s.n)
+	output := models.Series{
+		Target:       name,
+		QueryPatt:    name,
+		Datapoints:   out,
+		Interval:     series[0].Interval,
+		Consolidator: cons,
+		QueryCons:    queryCons,
+	}
+	cache[Req{}] = append(cache[Req{}], output)
+
+	return []models.Series{output}, nil
+}
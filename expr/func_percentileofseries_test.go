@@ -0,0 +1,27 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestPercentileOfSeries(t *testing.T) {
+	f := NewPercentileOfSeries()
+	p := f.(*FuncPercentileOfSeries)
+	p.in = NewMock([]models.Series{
+		{
+			QueryPatt:  "foo.*",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "foo.*",
+			Datapoints: getCopy(d),
+		},
+	})
+	p.n = 99.5
+	checkAggregate("percentileOfSeries", f, models.Series{
+		Target:     "percentileOfSeries(foo.*,99.5)",
+		Datapoints: getCopy(d),
+	}, t)
+}
@@ -60,6 +60,7 @@ func (s *FuncPerSecond) Exec(cache map[Req][]models.Series) ([]models.Series, er
 		}
 		s := models.Series{
 			Target:     fmt.Sprintf("perSecond(%s)", serie.Target),
+			Tags:       serie.CopyTags(),
 			QueryPatt:  fmt.Sprintf("perSecond(%s)", serie.QueryPatt),
 			Datapoints: out,
 			Interval:   serie.Interval,
@@ -0,0 +1,60 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncPow struct {
+	in     GraphiteFunc
+	factor float64
+}
+
+func NewPow() GraphiteFunc {
+	return &FuncPow{}
+}
+
+func (s *FuncPow) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "factor", val: &s.factor},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncPow) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncPow) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := getPoints(len(serie.Datapoints))
+		for i, p := range serie.Datapoints {
+			out[i] = schema.Point{Val: safePow(p.Val, s.factor), Ts: p.Ts}
+		}
+		name := fmt.Sprintf("pow(%s,%g)", serie.Target, s.factor)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
+
+// safePow returns base to the power of exp.
+// like graphite, results that are not a real number (e.g. dividing by zero or the root of a negative number) are null,
+// and so are results involving null (math.Pow returns 1 for a null base with exponent 0)
+func safePow(base, exp float64) float64 {
+	if math.IsNaN(base) || math.IsNaN(exp) {
+		return math.NaN()
+	}
+	val := math.Pow(base, exp)
+	if math.IsInf(val, 0) {
+		return math.NaN()
+	}
+	return val
+}
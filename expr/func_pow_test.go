@@ -0,0 +1,25 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPow(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		factor    float64
+		expTarget string
+		exp       []float64
+	}{
+		{2, "pow(a,2)", []float64{16, 0, nan, 16, 256}},
+		{0, "pow(a,0)", []float64{1, 1, nan, 1, 1}},
+		// a fractional exponent of a negative base is not a real number
+		{0.5, "pow(a,0.5)", []float64{nan, 0, nan, 2, 4}},
+		// a negative exponent of 0 is a division by zero
+		{-1, "pow(a,-1)", []float64{-0.25, nan, nan, 0.25, 0.0625}},
+	}
+	for _, c := range cases {
+		testTransform(c.expTarget, &FuncPow{in: NewMock(getTransformTestInput()), factor: c.factor}, c.expTarget, c.exp, t)
+	}
+}
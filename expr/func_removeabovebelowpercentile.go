@@ -0,0 +1,54 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncRemoveAboveBelowPercentile struct {
+	in    GraphiteFunc
+	n     float64
+	above bool
+}
+
+// NewRemoveAboveBelowPercentileConstructor returns a constructor for removeAbovePercentile, or removeBelowPercentile if above is false
+func NewRemoveAboveBelowPercentileConstructor(above bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncRemoveAboveBelowPercentile{above: above}
+	}
+}
+
+func (s *FuncRemoveAboveBelowPercentile) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "n", validator: []Validator{IsPercent}, val: &s.n},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncRemoveAboveBelowPercentile) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncRemoveAboveBelowPercentile) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	format := "removeBelowPercentile(%s, %g)"
+	if s.above {
+		format = "removeAbovePercentile(%s, %g)"
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		// like graphite, series without any non-null values are returned as-is (but renamed)
+		threshold, ok := seriesPercentile(serie, s.n)
+		if !ok {
+			threshold = math.NaN()
+		}
+		name := fmt.Sprintf(format, serie.Target, s.n)
+		outputs = append(outputs, removeAboveBelow(serie, threshold, s.above, name, cache))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,35 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestRemoveAboveBelowPercentile(t *testing.T) {
+	nan := math.NaN()
+	// the 50th percentile of 1,2,3,4,5 is 3
+	f := NewRemoveAboveBelowPercentileConstructor(true)()
+	f.(*FuncRemoveAboveBelowPercentile).in = NewMock(getRemoveTestInput())
+	f.(*FuncRemoveAboveBelowPercentile).n = 50
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("removeAbovePercentile", got, "removeAbovePercentile(a, 50)", []schema.Point{
+		{Val: 1, Ts: 10}, {Val: nan, Ts: 20}, {Val: nan, Ts: 30}, {Val: 2, Ts: 40}, {Val: nan, Ts: 50}, {Val: 3, Ts: 60},
+	}, t)
+
+	f = NewRemoveAboveBelowPercentileConstructor(false)()
+	f.(*FuncRemoveAboveBelowPercentile).in = NewMock(getRemoveTestInput())
+	f.(*FuncRemoveAboveBelowPercentile).n = 50
+	got, err = f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("removeBelowPercentile", got, "removeBelowPercentile(a, 50)", []schema.Point{
+		{Val: nan, Ts: 10}, {Val: 5, Ts: 20}, {Val: nan, Ts: 30}, {Val: nan, Ts: 40}, {Val: 4, Ts: 50}, {Val: 3, Ts: 60},
+	}, t)
+}
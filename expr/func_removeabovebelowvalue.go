@@ -0,0 +1,62 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncRemoveAboveBelowValue struct {
+	in    GraphiteFunc
+	n     float64
+	above bool
+}
+
+// NewRemoveAboveBelowValueConstructor returns a constructor for removeAboveValue, or removeBelowValue if above is false
+func NewRemoveAboveBelowValueConstructor(above bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		return &FuncRemoveAboveBelowValue{above: above}
+	}
+}
+
+func (s *FuncRemoveAboveBelowValue) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "n", val: &s.n},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncRemoveAboveBelowValue) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncRemoveAboveBelowValue) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	format := "removeBelowValue(%s, %g)"
+	if s.above {
+		format = "removeAboveValue(%s, %g)"
+	}
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		name := fmt.Sprintf(format, serie.Target, s.n)
+		outputs = append(outputs, removeAboveBelow(serie, s.n, s.above, name, cache))
+	}
+	return outputs, nil
+}
+
+// removeAboveBelow returns a copy of the series in which the values above (or below) the threshold are null
+func removeAboveBelow(serie models.Series, threshold float64, above bool, name string, cache map[Req][]models.Series) models.Series {
+	out := pointSlicePool.Get().([]schema.Point)
+	for _, p := range serie.Datapoints {
+		if (above && p.Val > threshold) || (!above && p.Val < threshold) {
+			p.Val = math.NaN()
+		}
+		out = append(out, p)
+	}
+	return deriveSeries(cache, serie, name, out)
+}
@@ -0,0 +1,52 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func getRemoveTestInput() []models.Series {
+	return []models.Series{
+		{
+			Target:    "a",
+			QueryPatt: "a",
+			Interval:  10,
+			Datapoints: []schema.Point{
+				{Val: 1, Ts: 10},
+				{Val: 5, Ts: 20},
+				{Val: math.NaN(), Ts: 30},
+				{Val: 2, Ts: 40},
+				{Val: 4, Ts: 50},
+				{Val: 3, Ts: 60},
+			},
+		},
+	}
+}
+
+func TestRemoveAboveBelowValue(t *testing.T) {
+	nan := math.NaN()
+	f := NewRemoveAboveBelowValueConstructor(true)()
+	f.(*FuncRemoveAboveBelowValue).in = NewMock(getRemoveTestInput())
+	f.(*FuncRemoveAboveBelowValue).n = 3
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("removeAboveValue", got, "removeAboveValue(a, 3)", []schema.Point{
+		{Val: 1, Ts: 10}, {Val: nan, Ts: 20}, {Val: nan, Ts: 30}, {Val: 2, Ts: 40}, {Val: nan, Ts: 50}, {Val: 3, Ts: 60},
+	}, t)
+
+	f = NewRemoveAboveBelowValueConstructor(false)()
+	f.(*FuncRemoveAboveBelowValue).in = NewMock(getRemoveTestInput())
+	f.(*FuncRemoveAboveBelowValue).n = 3
+	got, err = f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("removeBelowValue", got, "removeBelowValue(a, 3)", []schema.Point{
+		{Val: nan, Ts: 10}, {Val: 5, Ts: 20}, {Val: nan, Ts: 30}, {Val: nan, Ts: 40}, {Val: 4, Ts: 50}, {Val: 3, Ts: 60},
+	}, t)
+}
@@ -0,0 +1,42 @@
+package expr
+
+import (
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncRemoveEmptySeries struct {
+	in GraphiteFunc
+}
+
+func NewRemoveEmptySeries() GraphiteFunc {
+	return &FuncRemoveEmptySeries{}
+}
+
+func (s *FuncRemoveEmptySeries) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncRemoveEmptySeries) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncRemoveEmptySeries) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Series
+	for _, serie := range series {
+		for _, p := range serie.Datapoints {
+			if !math.IsNaN(p.Val) {
+				out = append(out, serie)
+				break
+			}
+		}
+	}
+	return out, nil
+}
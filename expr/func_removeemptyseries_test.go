@@ -0,0 +1,17 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestRemoveEmptySeries(t *testing.T) {
+	f := NewRemoveEmptySeries()
+	f.(*FuncRemoveEmptySeries).in = NewMock(getSummaryTestInput())
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkTargets("removeEmptySeries", got, []string{"a", "b", "c", "d"}, t)
+}
@@ -36,12 +36,13 @@ func (s *FuncScale) Exec(cache map[Req][]models.Series) ([]models.Series, error)
 	}
 	var outputs []models.Series
 	for _, serie := range series {
-		out := pointSlicePool.Get().([]schema.Point)
-		for _, v := range serie.Datapoints {
-			out = append(out, schema.Point{Val: v.Val * s.factor, Ts: v.Ts})
+		out := getPoints(len(serie.Datapoints))
+		for i, v := range serie.Datapoints {
+			out[i] = schema.Point{Val: v.Val * s.factor, Ts: v.Ts}
 		}
 		s := models.Series{
 			Target:       fmt.Sprintf("scale(%s,%f)", serie.Target, s.factor),
+			Tags:         serie.CopyTags(),
 			QueryPatt:    fmt.Sprintf("scale(%s,%f)", serie.QueryPatt, s.factor),
 			Datapoints:   out,
 			Interval:     serie.Interval,
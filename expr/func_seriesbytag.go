@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncSeriesByTag struct {
+	expressions []string
+	req         Req // set up by the planner
+}
+
+func NewSeriesByTag() GraphiteFunc {
+	return &FuncSeriesByTag{}
+}
+
+func (s *FuncSeriesByTag) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgStrings{key: "tagExpressions", validator: []Validator{IsTagExpression}, val: &s.expressions},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSeriesByTag) Context(context Context) Context {
+	return context
+}
+
+// Exec returns the series that were fetched for the tag query.
+// like a metric pattern, seriesByTag has no series inputs but results in a request for data
+func (s *FuncSeriesByTag) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	return cache[s.req], nil
+}
+
+// Query returns the query to fetch the series, which is also the path expression of the returned series.
+// e.g. seriesByTag('name=foo','dc=~us-.*')
+// the planner keeps track of the expressions of the query, see Plan.TagExpressions
+func (s *FuncSeriesByTag) Query() string {
+	quoted := make([]string, len(s.expressions))
+	for i, expression := range s.expressions {
+		quoted[i] = quote(expression)
+	}
+	return "seriesByTag(" + strings.Join(quoted, ",") + ")"
+}
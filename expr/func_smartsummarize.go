@@ -1,6 +1,9 @@
 package expr
 
-import "github.com/grafana/metrictank/api/models"
+import (
+	"github.com/grafana/metrictank/api/models"
+	"github.com/raintank/dur"
+)
 
 type FuncSmartSummarize struct {
 	in          GraphiteFunc
@@ -16,13 +19,17 @@ func NewSmartSummarize() GraphiteFunc {
 func (s *FuncSmartSummarize) Signature() ([]Arg, []Arg) {
 	return []Arg{
 		ArgSeriesList{val: &s.in},
-		ArgString{key: "interval", val: &s.interval},
+		ArgString{key: "interval", typ: paramInterval, validator: []Validator{IsInterval}, val: &s.interval},
 		ArgString{key: "func", opt: true, val: &s.fn},
 		ArgBool{key: "alignToFrom", opt: true, val: &s.alignToFrom},
 	}, []Arg{ArgSeries{}}
 }
 
 func (s *FuncSmartSummarize) Context(context Context) Context {
+	// the validator assures the interval is valid
+	interval, _ := dur.ParseNDuration(s.interval)
+	// the points needed before from are buckets of our interval
+	context = context.prePointsToRange(interval)
 	context.consol = 0
 	return context
 }
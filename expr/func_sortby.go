@@ -0,0 +1,76 @@
+package expr
+
+import (
+	"math"
+	"sort"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncSortBy struct {
+	in      GraphiteFunc
+	fn      string
+	reverse bool
+	generic bool // whether the summary function can be specified, as opposed to being fixed by the function name
+}
+
+// NewSortByConstructor returns a constructor for sortBy style functions.
+// pass an empty fn for the generic sortBy() which takes the summary function as argument
+func NewSortByConstructor(fn string, reverse bool) func() GraphiteFunc {
+	return func() GraphiteFunc {
+		if fn == "" {
+			return &FuncSortBy{fn: "average", reverse: reverse, generic: true}
+		}
+		return &FuncSortBy{fn: fn, reverse: reverse}
+	}
+}
+
+func (s *FuncSortBy) Signature() ([]Arg, []Arg) {
+	if s.generic {
+		return []Arg{
+			ArgSeriesList{val: &s.in},
+			ArgString{key: "func", opt: true, typ: paramAggFunc, validator: []Validator{IsSeriesSummaryFunc}, val: &s.fn},
+			ArgBool{key: "reverse", opt: true, val: &s.reverse},
+		}, []Arg{ArgSeriesList{}}
+	}
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSortBy) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncSortBy) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	summarized := summarizeSeries(series, getSeriesSummaryFunc(s.fn))
+	sortSummarizedSeries(summarized, s.reverse)
+
+	out := make([]models.Series, 0, len(summarized))
+	for _, sum := range summarized {
+		out = append(out, sum.serie)
+	}
+	return out, nil
+}
+
+// sortSummarizedSeries sorts the series by their summary value, in ascending order unless reverse is set.
+// like graphite, series that summarize to null are considered to have the lowest possible value.
+func sortSummarizedSeries(summarized []summarizedSeries, reverse bool) {
+	sort.SliceStable(summarized, func(i, j int) bool {
+		vi, vj := summarized[i].val, summarized[j].val
+		if math.IsNaN(vi) {
+			vi = math.Inf(-1)
+		}
+		if math.IsNaN(vj) {
+			vj = math.Inf(-1)
+		}
+		if reverse {
+			return vi > vj
+		}
+		return vi < vj
+	})
+}
@@ -0,0 +1,31 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestSortBy(t *testing.T) {
+	cases := []struct {
+		name    string
+		fn      string
+		reverse bool
+		exp     []string
+	}{
+		{"sortByMaxima", "max", true, []string{"b", "a", "d", "c", "nan"}},
+		{"sortByTotal", "sum", true, []string{"b", "a", "d", "c", "nan"}},
+		{"sortBy-average", "average", false, []string{"nan", "c", "d", "a", "b"}},
+		{"sortBy-average-reverse", "average", true, []string{"b", "a", "d", "c", "nan"}},
+		{"sortBy-last", "last", false, []string{"nan", "c", "d", "a", "b"}},
+	}
+	for _, c := range cases {
+		f := NewSortByConstructor(c.fn, c.reverse)()
+		f.(*FuncSortBy).in = NewMock(getSummaryTestInput())
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %q: err should be nil. got %q", c.name, err)
+		}
+		checkTargets(c.name, got, c.exp, t)
+	}
+}
@@ -0,0 +1,46 @@
+package expr
+
+import (
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+)
+
+type FuncSortByMinima struct {
+	in GraphiteFunc
+}
+
+func NewSortByMinima() GraphiteFunc {
+	return &FuncSortByMinima{}
+}
+
+func (s *FuncSortByMinima) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSortByMinima) Context(context Context) Context {
+	return context
+}
+
+// Exec sorts the series by their minimum, in ascending order.
+// like graphite, only series that have a maximum value greater than 0 are included.
+func (s *FuncSortByMinima) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var summarized []summarizedSeries
+	for _, sum := range summarizeSeries(series, batch.Max) {
+		if sum.val > 0 {
+			summarized = append(summarized, summarizedSeries{sum.serie, batch.Min(sum.serie.Datapoints)})
+		}
+	}
+	sortSummarizedSeries(summarized, false)
+
+	out := make([]models.Series, 0, len(summarized))
+	for _, sum := range summarized {
+		out = append(out, sum.serie)
+	}
+	return out, nil
+}
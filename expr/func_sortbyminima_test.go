@@ -0,0 +1,18 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestSortByMinima(t *testing.T) {
+	f := NewSortByMinima()
+	f.(*FuncSortByMinima).in = NewMock(getSummaryTestInput())
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	// the all-null series has no maximum above 0 so it is removed
+	checkTargets("sortByMinima", got, []string{"a", "b", "c", "d"}, t)
+}
@@ -0,0 +1,81 @@
+package expr
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncSortByName struct {
+	in      GraphiteFunc
+	natural bool
+	reverse bool
+}
+
+func NewSortByName() GraphiteFunc {
+	return &FuncSortByName{}
+}
+
+func (s *FuncSortByName) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgBool{key: "natural", opt: true, val: &s.natural},
+		ArgBool{key: "reverse", opt: true, val: &s.reverse},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSortByName) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncSortByName) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.Series, len(series))
+	copy(out, series)
+
+	less := func(a, b string) bool { return a < b }
+	if s.natural {
+		less = naturalLess
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if s.reverse {
+			return less(out[j].Target, out[i].Target)
+		}
+		return less(out[i].Target, out[j].Target)
+	})
+	return out, nil
+}
+
+// naturalLess compares strings such that embedded numbers are compared by their numeric value
+// e.g. "server2" sorts before "server10"
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		var chunkA, chunkB string
+		chunkA, a = nextNaturalChunk(a)
+		chunkB, b = nextNaturalChunk(b)
+		if chunkA == chunkB {
+			continue
+		}
+		intA, errA := strconv.ParseUint(chunkA, 10, 64)
+		intB, errB := strconv.ParseUint(chunkB, 10, 64)
+		if errA == nil && errB == nil && intA != intB {
+			return intA < intB
+		}
+		return chunkA < chunkB
+	}
+	return len(a) < len(b)
+}
+
+// nextNaturalChunk returns the leading run of either digits or non-digits in s, and the remainder
+func nextNaturalChunk(s string) (string, string) {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,40 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestSortByName(t *testing.T) {
+	in := []models.Series{
+		{Target: "server10.cpu"},
+		{Target: "server2.cpu"},
+		{Target: "server1.cpu"},
+		{Target: "server2.cpu01"},
+		{Target: "server2.cpu1"},
+	}
+	cases := []struct {
+		name    string
+		natural bool
+		reverse bool
+		exp     []string
+	}{
+		{"default", false, false, []string{"server1.cpu", "server10.cpu", "server2.cpu", "server2.cpu01", "server2.cpu1"}},
+		{"reverse", false, true, []string{"server2.cpu1", "server2.cpu01", "server2.cpu", "server10.cpu", "server1.cpu"}},
+		{"natural", true, false, []string{"server1.cpu", "server2.cpu", "server2.cpu01", "server2.cpu1", "server10.cpu"}},
+		{"natural-reverse", true, true, []string{"server10.cpu", "server2.cpu1", "server2.cpu01", "server2.cpu", "server1.cpu"}},
+	}
+	for _, c := range cases {
+		f := NewSortByName()
+		sbn := f.(*FuncSortByName)
+		sbn.in = NewMock(in)
+		sbn.natural = c.natural
+		sbn.reverse = c.reverse
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("case %q: err should be nil. got %q", c.name, err)
+		}
+		checkTargets(c.name, got, c.exp, t)
+	}
+}
@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSquareRoot(t *testing.T) {
+	nan := math.NaN()
+	testTransform("squareRoot", &FuncSquareRoot{in: NewMock(getTransformTestInput())}, "squareRoot(a)", []float64{nan, 0, nan, 2, 4}, t)
+}
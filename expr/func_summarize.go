@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/raintank/dur"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncSummarize struct {
+	in          GraphiteFunc
+	intervalStr string
+	fn          string
+	alignToFrom bool
+
+	from     uint32
+	to       uint32
+	loc      *time.Location
+	interval uint32
+}
+
+func NewSummarize() GraphiteFunc {
+	return &FuncSummarize{fn: "sum"}
+}
+
+func (s *FuncSummarize) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "intervalString", typ: paramInterval, validator: []Validator{IsInterval}, val: &s.intervalStr},
+		ArgString{key: "func", opt: true, typ: paramAggFunc, validator: []Validator{IsWindowAggFunc}, val: &s.fn},
+		ArgBool{key: "alignToFrom", opt: true, val: &s.alignToFrom},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSummarize) Context(context Context) Context {
+	// the validator assures the interval is valid
+	s.interval, _ = dur.ParseNDuration(s.intervalStr)
+	// the points needed before from are buckets of our interval
+	context = context.prePointsToRange(s.interval)
+	s.from = context.from
+	s.to = context.to
+	s.loc = context.loc
+	context.consol = 0
+	return context
+}
+
+func (s *FuncSummarize) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	aggFunc := getWindowAggFunc(s.fn)
+	buckets := newBucketer(s.interval, s.loc, s.from, s.alignToFrom)
+	first, last := buckets.index(s.from), buckets.index(s.to-1)
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		points := serie.Datapoints
+		for i := first; i <= last; i++ {
+			// points are sorted, so the points of each bucket are consecutive
+			start := 0
+			for start < len(points) && buckets.index(points[start].Ts) < i {
+				start++
+			}
+			end := start
+			for end < len(points) && buckets.index(points[end].Ts) == i {
+				end++
+			}
+			val := math.NaN()
+			if xff(points[start:end], 0) {
+				val = aggFunc(points[start:end])
+			}
+			out = append(out, schema.Point{Val: val, Ts: buckets.start(i)})
+			points = points[end:]
+		}
+
+		var name string
+		if s.alignToFrom {
+			name = fmt.Sprintf("summarize(%s, \"%s\", \"%s\", true)", serie.Target, s.intervalStr, s.fn)
+		} else {
+			name = fmt.Sprintf("summarize(%s, \"%s\", \"%s\")", serie.Target, s.intervalStr, s.fn)
+		}
+		output := models.Series{
+			Target:       name,
+			Tags:         serie.CopyTags(),
+			QueryPatt:    name,
+			Datapoints:   out,
+			Interval:     s.interval,
+			Consolidator: serie.Consolidator,
+			QueryCons:    serie.QueryCons,
+		}
+		outputs = append(outputs, output)
+		cache[Req{}] = append(cache[Req{}], output)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,98 @@
+package expr
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestSummarize(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		name        string
+		in          []schema.Point
+		interval    string
+		fn          string
+		alignToFrom bool
+		expTarget   string
+		exp         []schema.Point
+	}{
+		{
+			"sum",
+			getCopy(c),
+			"30s",
+			"sum",
+			false,
+			`summarize(a, "30s", "sum")`,
+			[]schema.Point{{Val: 0, Ts: 0}, {Val: 6, Ts: 30}, {Val: 4, Ts: 60}},
+		},
+		{
+			"sum-alignToFrom",
+			getCopy(c),
+			"30s",
+			"sum",
+			true,
+			`summarize(a, "30s", "sum", true)`,
+			[]schema.Point{{Val: 1, Ts: 10}, {Val: 9, Ts: 40}},
+		},
+		{
+			"avg-nulls",
+			getCopy(a),
+			"30s",
+			"avg",
+			false,
+			`summarize(a, "30s", "avg")`,
+			[]schema.Point{{Val: 0, Ts: 0}, {Val: 5.5, Ts: 30}, {Val: 1234567890, Ts: 60}},
+		},
+		{
+			"max-all-null-bucket",
+			[]schema.Point{{Val: 1, Ts: 10}, {Val: 2, Ts: 20}, {Val: nan, Ts: 30}, {Val: nan, Ts: 40}, {Val: nan, Ts: 50}, {Val: 3, Ts: 60}},
+			"30s",
+			"max",
+			false,
+			`summarize(a, "30s", "max")`,
+			[]schema.Point{{Val: 2, Ts: 0}, {Val: nan, Ts: 30}, {Val: 3, Ts: 60}},
+		},
+	}
+	for _, c := range cases {
+		f := NewSummarize()
+		s := f.(*FuncSummarize)
+		s.in = NewMock([]models.Series{{Target: "a", QueryPatt: "a", Interval: 10, Datapoints: c.in}})
+		s.intervalStr = c.interval
+		s.fn = c.fn
+		s.alignToFrom = c.alignToFrom
+		f.Context(Context{from: 10, to: 70, loc: time.UTC})
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("%s: err should be nil. got %q", c.name, err)
+		}
+		checkPoints(c.name, got, c.expTarget, c.exp, t)
+	}
+}
+
+// daily buckets should start at midnight in the timezone of the request
+func TestSummarizeTimezone(t *testing.T) {
+	from := uint32(1514764800) // 2018-01-01 00:00:00 UTC
+	to := from + 2*24*3600
+	var points []schema.Point
+	for ts := from; ts < to; ts += 3600 {
+		points = append(points, schema.Point{Val: 1, Ts: ts})
+	}
+	f := NewSummarize()
+	s := f.(*FuncSummarize)
+	s.in = NewMock([]models.Series{{Target: "a", QueryPatt: "a", Interval: 3600, Datapoints: points}})
+	s.intervalStr = "1d"
+	f.Context(Context{from: from, to: to, loc: time.FixedZone("UTC-5", -5*3600)})
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkPoints("summarize-1d-tz", got, `summarize(a, "1d", "sum")`, []schema.Point{
+		{Val: 5, Ts: from - 19*3600},
+		{Val: 24, Ts: from + 5*3600},
+		{Val: 19, Ts: from + 29*3600},
+	}, t)
+}
@@ -0,0 +1,112 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/raintank/dur"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncTimeShift struct {
+	in        GraphiteFunc
+	timeShift string
+	resetEnd  bool
+	alignDST  bool
+}
+
+func NewTimeShift() GraphiteFunc {
+	return &FuncTimeShift{resetEnd: true}
+}
+
+func (s *FuncTimeShift) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "timeShift", typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.timeShift},
+		// both of these only affect the start and end of graphite's timeseries objects.
+		// we don't have those, so we simply accept and ignore them.
+		ArgBool{key: "resetEnd", opt: true, val: &s.resetEnd},
+		ArgBool{key: "alignDST", opt: true, val: &s.alignDST},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncTimeShift) Context(context Context) Context {
+	// the validator assures the offset is valid
+	offset, _ := parseTimeOffset(s.timeShift)
+	return context.shift(offset)
+}
+
+func (s *FuncTimeShift) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	offset, _ := parseTimeOffset(s.timeShift)
+	timeShift := normalizeTimeOffset(s.timeShift)
+	var outputs []models.Series
+	for _, serie := range series {
+		name := fmt.Sprintf("timeShift(%s, \"%s\")", serie.Target, timeShift)
+		output := shiftSeries(serie, offset, name, cache)
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// shiftSeries returns a copy of the series of which the points are moved back in time by the given offset.
+// I.e. it undoes the given offset as applied to the context.
+func shiftSeries(serie models.Series, offset int64, name string, cache map[Req][]models.Series) models.Series {
+	out := pointSlicePool.Get().([]schema.Point)
+	for _, p := range serie.Datapoints {
+		out = append(out, schema.Point{Val: p.Val, Ts: uint32(int64(p.Ts) - offset)})
+	}
+	output := models.Series{
+		Target:       name,
+		Tags:         serie.CopyTags(),
+		QueryPatt:    name,
+		Datapoints:   out,
+		Interval:     serie.Interval,
+		QueryFrom:    uint32(int64(serie.QueryFrom) - offset),
+		QueryTo:      uint32(int64(serie.QueryTo) - offset),
+		Consolidator: serie.Consolidator,
+		QueryCons:    serie.QueryCons,
+	}
+	cache[Req{}] = append(cache[Req{}], output)
+	return output
+}
+
+// normalizeTimeOffset returns the offset with the sign explicitly specified.
+// like graphite, offsets without a sign are considered negative.
+func normalizeTimeOffset(s string) string {
+	if s != "" && s[0] != '-' && s[0] != '+' {
+		return "-" + s
+	}
+	return s
+}
+
+// parseTimeOffset parses a graphite time offset like "1d", "-1h" or "+5min" into a number of seconds.
+// like graphite, offsets without a sign are considered negative.
+func parseTimeOffset(s string) (int64, error) {
+	s = normalizeTimeOffset(s)
+	if s == "" {
+		return 0, ErrInvalidTimeOffset
+	}
+	sign := int64(1)
+	if s[0] == '-' {
+		sign = -1
+	}
+	offset, err := dur.ParseDuration(s[1:])
+	if err != nil {
+		return 0, err
+	}
+	return sign * int64(offset), nil
+}
+
+// absTimeOffset returns the length of a time offset, such as "7d" or "-1h", in seconds, ignoring the sign.
+// it is meant for offsets that have been validated already, and returns 0 for invalid ones.
+func absTimeOffset(s string) int64 {
+	offset, _ := parseTimeOffset(s)
+	if offset < 0 {
+		return -offset
+	}
+	return offset
+}
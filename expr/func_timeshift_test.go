@@ -0,0 +1,99 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestParseTimeOffset(t *testing.T) {
+	cases := []struct {
+		in     string
+		exp    int64
+		expErr bool
+	}{
+		{"1d", -86400, false},
+		{"-1d", -86400, false},
+		{"+1h", 3600, false},
+		{"5min", -300, false},
+		{"", 0, true},
+		{"+", 0, true},
+		{"foo", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseTimeOffset(c.in)
+		if (err != nil) != c.expErr {
+			t.Fatalf("%q: expected error %t, got %v", c.in, c.expErr, err)
+		}
+		if got != c.exp {
+			t.Errorf("%q: expected %d, got %d", c.in, c.exp, got)
+		}
+	}
+}
+
+func TestTimeShift(t *testing.T) {
+	in := []models.Series{
+		{
+			Target:     "a",
+			QueryPatt:  "a",
+			QueryFrom:  0,
+			QueryTo:    60,
+			Interval:   10,
+			Datapoints: getCopy(a),
+		},
+	}
+	cases := []struct {
+		shift   string
+		expName string
+		expDiff int64
+	}{
+		{"10s", `timeShift(a, "-10s")`, 10},
+		{"-10s", `timeShift(a, "-10s")`, 10},
+		{"+10s", `timeShift(a, "+10s")`, -10},
+	}
+	for _, c := range cases {
+		f := NewTimeShift()
+		f.(*FuncTimeShift).in = NewMock(in)
+		f.(*FuncTimeShift).timeShift = c.shift
+		got, err := f.Exec(make(map[Req][]models.Series))
+		if err != nil {
+			t.Fatalf("%q: err should be nil. got %q", c.shift, err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("%q: expected 1 output series, got %d", c.shift, len(got))
+		}
+		if got[0].Target != c.expName {
+			t.Errorf("%q: expected target %q, got %q", c.shift, c.expName, got[0].Target)
+		}
+		for i, p := range got[0].Datapoints {
+			if int64(p.Ts) != int64(a[i].Ts)+c.expDiff {
+				t.Errorf("%q: point %d: expected ts %d, got %d", c.shift, i, int64(a[i].Ts)+c.expDiff, p.Ts)
+			}
+			bothNaN := math.IsNaN(p.Val) && math.IsNaN(a[i].Val)
+			if !bothNaN && p.Val != a[i].Val {
+				t.Errorf("%q: point %d: expected val %f, got %f", c.shift, i, a[i].Val, p.Val)
+			}
+		}
+	}
+}
+
+func TestContextShiftClamps(t *testing.T) {
+	c := Context{from: 100, to: 200}
+	cases := []struct {
+		offset   int64
+		from, to uint32
+	}{
+		{-50, 50, 150},
+		{-150, 0, 50},
+		{-1000, 0, 0},
+		{math.MaxUint32 - 150, math.MaxUint32 - 50, math.MaxUint32},
+		{math.MaxUint32 * 2, math.MaxUint32, math.MaxUint32},
+	}
+	for _, cas := range cases {
+		got := c.shift(cas.offset)
+		if got.from != cas.from || got.to != cas.to {
+			t.Errorf("offset %d: expected %d - %d, got %d - %d", cas.offset, cas.from, cas.to, got.from, got.to)
+		}
+	}
+}
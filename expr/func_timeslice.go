@@ -0,0 +1,60 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/raintank/dur"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type FuncTimeSlice struct {
+	in           GraphiteFunc
+	startSliceAt string
+	endSliceAt   string
+	start        uint32
+	end          uint32
+}
+
+func NewTimeSlice() GraphiteFunc {
+	return &FuncTimeSlice{endSliceAt: "now"}
+}
+
+func (s *FuncTimeSlice) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "startSliceAt", typ: paramDate, validator: []Validator{IsDateTime}, val: &s.startSliceAt},
+		ArgString{key: "endSliceAt", opt: true, typ: paramDate, validator: []Validator{IsDateTime}, val: &s.endSliceAt},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncTimeSlice) Context(context Context) Context {
+	// the validators assure the times are valid.
+	// we resolve them now such that relative times are relative to the time of the request
+	now := time.Now()
+	s.start, _ = dur.ParseDateTime(s.startSliceAt, context.loc, now, 0)
+	s.end, _ = dur.ParseDateTime(s.endSliceAt, context.loc, now, 0)
+	return context
+}
+
+func (s *FuncTimeSlice) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	series, err := s.in.Exec(cache)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []models.Series
+	for _, serie := range series {
+		out := pointSlicePool.Get().([]schema.Point)
+		for _, p := range serie.Datapoints {
+			if p.Ts < s.start || p.Ts > s.end {
+				p.Val = math.NaN()
+			}
+			out = append(out, p)
+		}
+		name := fmt.Sprintf("timeSlice(%s, %d, %d)", serie.Target, s.start, s.end)
+		outputs = append(outputs, deriveSeries(cache, serie, name, out))
+	}
+	return outputs, nil
+}
@@ -0,0 +1,44 @@
+package expr
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestTimeSlice(t *testing.T) {
+	f := NewTimeSlice()
+	f.(*FuncTimeSlice).in = NewMock([]models.Series{
+		{
+			Target:     "a",
+			QueryPatt:  "a",
+			Interval:   10,
+			Datapoints: getCopy(a),
+		},
+	})
+	f.(*FuncTimeSlice).startSliceAt = "20"
+	f.(*FuncTimeSlice).endSliceAt = "40"
+	f.Context(Context{loc: time.UTC})
+	got, err := f.Exec(make(map[Req][]models.Series))
+	if err != nil {
+		t.Fatalf("err should be nil. got %q", err)
+	}
+	checkTargets("timeSlice", got, []string{"timeSlice(a, 20, 40)"}, t)
+	exp := []schema.Point{
+		{Val: math.NaN(), Ts: 10},
+		{Val: 0, Ts: 20},
+		{Val: 5.5, Ts: 30},
+		{Val: math.NaN(), Ts: 40},
+		{Val: math.NaN(), Ts: 50},
+		{Val: math.NaN(), Ts: 60},
+	}
+	for i, p := range got[0].Datapoints {
+		bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp[i].Val)
+		if p.Ts != exp[i].Ts || (!bothNaN && p.Val != exp[i].Val) {
+			t.Errorf("point %d: expected %v, got %v", i, exp[i], p)
+		}
+	}
+}
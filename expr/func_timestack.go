@@ -0,0 +1,78 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncTimeStack struct {
+	in             []GraphiteFunc
+	timeShiftUnit  string
+	timeShiftStart int64
+	timeShiftEnd   int64
+}
+
+func NewTimeStack() GraphiteFunc {
+	return &FuncTimeStack{timeShiftUnit: "1d", timeShiftEnd: 7}
+}
+
+func (s *FuncTimeStack) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesLists{val: &s.in},
+		ArgString{key: "timeShiftUnit", opt: true, typ: paramInterval, validator: []Validator{IsTimeOffset}, val: &s.timeShiftUnit},
+		ArgInt{key: "timeShiftStart", opt: true, val: &s.timeShiftStart},
+		ArgInt{key: "timeShiftEnd", opt: true, val: &s.timeShiftEnd},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncTimeStack) Context(context Context) Context {
+	return context
+}
+
+// Contexts returns a context for each shift, as we need our input for each of them
+func (s *FuncTimeStack) Contexts(context Context) []Context {
+	var contexts []Context
+	for _, offset := range s.offsets() {
+		contexts = append(contexts, context.shift(offset))
+	}
+	return contexts
+}
+
+func (s *FuncTimeStack) offsets() []int64 {
+	// the validator assures the unit is valid
+	unit, _ := parseTimeOffset(s.timeShiftUnit)
+	var offsets []int64
+	for shift := s.timeShiftStart; shift < s.timeShiftEnd; shift++ {
+		offsets = append(offsets, unit*shift)
+	}
+	return offsets
+}
+
+func (s *FuncTimeStack) Exec(cache map[Req][]models.Series) ([]models.Series, error) {
+	offsets := s.offsets()
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	// the planner set up our inputs for each context in turn
+	if len(s.in)%len(offsets) != 0 {
+		return nil, errors.New("timeStack: inputs don't correspond to the requested shifts")
+	}
+	perShift := len(s.in) / len(offsets)
+	timeShiftUnit := normalizeTimeOffset(s.timeShiftUnit)
+
+	var outputs []models.Series
+	for i, offset := range offsets {
+		series, _, err := consumeFuncs(cache, s.in[i*perShift:(i+1)*perShift])
+		if err != nil {
+			return nil, err
+		}
+		shift := s.timeShiftStart + int64(i)
+		for _, serie := range series {
+			name := fmt.Sprintf("timeShift(%s, %s, %d)", serie.Target, timeShiftUnit, shift)
+			outputs = append(outputs, shiftSeries(serie, offset, name, cache))
+		}
+	}
+	return outputs, nil
+}
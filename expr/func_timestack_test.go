@@ -0,0 +1,56 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// TestTimeStack tests timeStack end to end, as it relies on the planner to set up its inputs for each shift
+func TestTimeStack(t *testing.T) {
+	from := uint32(100000)
+	to := uint32(100060)
+	exprs, err := ParseMany([]string{`timeStack(a, '10s', 0, 2)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expReqs := []Req{
+		NewReq("a", from, to, 0),
+		NewReq("a", from-10, to-10, 0),
+	}
+	if !reflect.DeepEqual(plan.Reqs, expReqs) {
+		t.Fatalf("expected reqs %v, got %v", expReqs, plan.Reqs)
+	}
+	input := make(map[Req][]models.Series)
+	for _, req := range plan.Reqs {
+		points := []schema.Point{
+			{Val: float64(req.From), Ts: req.From + 10},
+			{Val: float64(req.From), Ts: req.From + 20},
+		}
+		input[req] = []models.Series{{Target: "a", QueryPatt: "a", QueryFrom: req.From, QueryTo: req.To, Interval: 10, Datapoints: points}}
+	}
+	out, err := plan.Run(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTargets("timeStack", out, []string{"timeShift(a, -10s, 0)", "timeShift(a, -10s, 1)"}, t)
+	// both shifts should have been aligned back to the requested time range,
+	// with the data from their respective time range
+	for i, serie := range out {
+		expVal := float64(from - 10*uint32(i))
+		for j, p := range serie.Datapoints {
+			if p.Ts != from+10*uint32(j+1) {
+				t.Errorf("series %d point %d: expected ts %d, got %d", i, j, from+10*uint32(j+1), p.Ts)
+			}
+			if p.Val != expVal {
+				t.Errorf("series %d point %d: expected val %f, got %f", i, j, expVal, p.Val)
+			}
+		}
+	}
+}
@@ -49,6 +49,7 @@ func (s *FuncTransformNull) Exec(cache map[Req][]models.Series) ([]models.Series
 		}
 		transformed := models.Series{
 			Target:       target,
+			Tags:         serie.CopyTags(),
 			QueryPatt:    target,
 			Datapoints:   pointSlicePool.Get().([]schema.Point),
 			Interval:     serie.Interval,
@@ -1,14 +1,57 @@
 package expr
 
 import (
+	"math"
+	"time"
+
 	"github.com/grafana/metrictank/api/models"
 	"github.com/grafana/metrictank/consolidation"
+	"gopkg.in/raintank/schema.v1"
 )
 
 type Context struct {
 	from   uint32
 	to     uint32
 	consol consolidation.Consolidator // can be 0 to mean undefined
+	// number of points needed before from, for functions whose window is expressed in points.
+	// (for windows expressed as durations, from is simply adjusted)
+	prePoints uint32
+	loc       *time.Location // timezone of the request, for functions that align to calendar boundaries such as local midnight
+}
+
+// shift returns a copy of the context with the time range moved by offset seconds.
+// a negative offset moves the range into the past. the range is clamped to the range of uint32 timestamps.
+func (c Context) shift(offset int64) Context {
+	c.from = clampTs(int64(c.from) + offset)
+	c.to = clampTs(int64(c.to) + offset)
+	return c
+}
+
+// extendFrom returns a copy of the context with from moved back by the given number of seconds,
+// for functions that need data from before the requested time range. from is clamped at 0.
+func (c Context) extendFrom(seconds int64) Context {
+	c.from = clampTs(int64(c.from) - seconds)
+	return c
+}
+
+// prePointsToRange returns a copy of the context in which the points needed before from are turned into a time range,
+// given the interval of the output, for functions whose output interval is not that of their input, such as summarize.
+// from is clamped at 0.
+func (c Context) prePointsToRange(interval uint32) Context {
+	c.from = clampTs(int64(c.from) - int64(c.prePoints)*int64(interval))
+	c.prePoints = 0
+	return c
+}
+
+// clampTs returns the timestamp as uint32, clamped to [0, MaxUint32]
+func clampTs(ts int64) uint32 {
+	if ts < 0 {
+		return 0
+	}
+	if ts > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ts)
 }
 
 type GraphiteFunc interface {
@@ -34,6 +77,14 @@ type GraphiteFunc interface {
 	Exec(map[Req][]models.Series) ([]models.Series, error)
 }
 
+// MultiContextFunc is an optional interface for functions that need their series inputs
+// under several different contexts, such as timeStack which needs the same series for several time ranges.
+// the planner calls Contexts (instead of Context) and sets up the series inputs once per returned context, in order.
+// for this to be useful, the series inputs should be of type ArgSeriesLists, so that they can accumulate.
+type MultiContextFunc interface {
+	Contexts(c Context) []Context
+}
+
 type funcConstructor func() GraphiteFunc
 
 type funcDef struct {
@@ -46,27 +97,118 @@ var funcs map[string]funcDef
 func init() {
 	// keys must be sorted alphabetically. but functions with aliases can go together, in which case they are sorted by the first of their aliases
 	funcs = map[string]funcDef{
-		"alias":          {NewAlias, true},
-		"aliasByNode":    {NewAliasByNode, true},
-		"aliasSub":       {NewAliasSub, true},
-		"avg":            {NewAggregateConstructor("average", crossSeriesAvg), true},
-		"averageSeries":  {NewAggregateConstructor("average", crossSeriesAvg), true},
-		"consolidateBy":  {NewConsolidateBy, true},
-		"divideSeries":   {NewDivideSeries, true},
-		"max":            {NewAggregateConstructor("max", crossSeriesMax), true},
-		"maxSeries":      {NewAggregateConstructor("max", crossSeriesMax), true},
-		"min":            {NewAggregateConstructor("min", crossSeriesMin), true},
-		"minSeries":      {NewAggregateConstructor("min", crossSeriesMin), true},
-		"movingAverage":  {NewMovingAverage, false},
-		"perSecond":      {NewPerSecond, true},
-		"scale":          {NewScale, true},
-		"smartSummarize": {NewSmartSummarize, false},
-		"sum":            {NewAggregateConstructor("sum", crossSeriesSum), true},
-		"sumSeries":      {NewAggregateConstructor("sum", crossSeriesSum), true},
-		"transformNull":  {NewTransformNull, true},
+		"absolute":                   {NewAbsolute, true},
+		"aggregate":                  {NewAggregate, true},
+		"alias":                      {NewAlias, true},
+		"aliasByNode":                {NewAliasByNode, true},
+		"aliasByTags":                {NewAliasByTags, true},
+		"aliasSub":                   {NewAliasSub, true},
+		"asPercent":                  {NewAsPercent, true},
+		"averageAbove":               {NewFilterSeriesConstructor("average", ">"), true},
+		"averageBelow":               {NewFilterSeriesConstructor("average", "<="), true},
+		"avg":                        {NewAggregateConstructor("average", crossSeriesAvg), true},
+		"averageSeries":              {NewAggregateConstructor("average", crossSeriesAvg), true},
+		"consolidateBy":              {NewConsolidateBy, true},
+		"countSeries":                {NewAggregateConstructor("count", crossSeriesLen), true},
+		"currentAbove":               {NewFilterSeriesConstructor("last", ">"), true},
+		"currentBelow":               {NewFilterSeriesConstructor("last", "<="), true},
+		"delay":                      {NewDelay, true},
+		"derivative":                 {NewDerivative, true},
+		"diffSeries":                 {NewAggregateConstructor("diff", crossSeriesDiff), true},
+		"divideSeries":               {NewDivideSeries, true},
+		"divideSeriesLists":          {NewDivideSeriesLists, true},
+		"exclude":                    {NewGrepConstructor(true), true},
+		"filterSeries":               {NewFilterSeries, true},
+		"grep":                       {NewGrepConstructor(false), true},
+		"groupByNode":                {NewGroupByNodesConstructor(true), true},
+		"groupByNodes":               {NewGroupByNodesConstructor(false), true},
+		"groupByTags":                {NewGroupByTags, true},
+		"highest":                    {NewHighestLowestConstructor("", true), true},
+		"highestAverage":             {NewHighestLowestConstructor("average", true), true},
+		"highestCurrent":             {NewHighestLowestConstructor("current", true), true},
+		"highestMax":                 {NewHighestLowestConstructor("max", true), true},
+		"hitcount":                   {NewHitcount, true},
+		"holtWintersAberration":      {NewHoltWintersAberration, true},
+		"holtWintersConfidenceBands": {NewHoltWintersConfidenceBands, true},
+		"holtWintersForecast":        {NewHoltWintersForecast, true},
+		"integral":                   {NewIntegral, true},
+		"invert":                     {NewInvert, true},
+		"keepLastValue":              {NewKeepLastValue, true},
+		"limit":                      {NewLimit, true},
+		"logarithm":                  {NewLogarithm, true},
+		"log":                        {NewLogarithm, true},
+		"lowest":                     {NewHighestLowestConstructor("", false), true},
+		"lowestAverage":              {NewHighestLowestConstructor("average", false), true},
+		"lowestCurrent":              {NewHighestLowestConstructor("current", false), true},
+		"max":                        {NewAggregateConstructor("max", crossSeriesMax), true},
+		"maxSeries":                  {NewAggregateConstructor("max", crossSeriesMax), true},
+		"maximumAbove":               {NewFilterSeriesConstructor("max", ">"), true},
+		"maximumBelow":               {NewFilterSeriesConstructor("max", "<="), true},
+		"medianSeries":               {NewAggregateConstructor("median", crossSeriesMedian), true},
+		"min":                        {NewAggregateConstructor("min", crossSeriesMin), true},
+		"minSeries":                  {NewAggregateConstructor("min", crossSeriesMin), true},
+		"minMax":                     {NewMinMax, true},
+		"minimumAbove":               {NewFilterSeriesConstructor("min", ">"), true},
+		"minimumBelow":               {NewFilterSeriesConstructor("min", "<="), true},
+		"movingAverage":              {NewMovingWindowConstructor("average"), true},
+		"movingMax":                  {NewMovingWindowConstructor("max"), true},
+		"movingMedian":               {NewMovingWindowConstructor("median"), true},
+		"movingMin":                  {NewMovingWindowConstructor("min"), true},
+		"movingSum":                  {NewMovingWindowConstructor("sum"), true},
+		"movingWindow":               {NewMovingWindow, true},
+		"multiplySeries":             {NewAggregateConstructor("multiply", crossSeriesMultiply), true},
+		"nPercentile":                {NewNPercentile, true},
+		"nonNegativeDerivative":      {NewNonNegativeDerivative, true},
+		"offset":                     {NewOffset, true},
+		"offsetToZero":               {NewOffsetToZero, true},
+		"perSecond":                  {NewPerSecond, true},
+		"percentileOfSeries":         {NewPercentileOfSeries, true},
+		"pow":                        {NewPow, true},
+		"powSeries":                  {NewAggregateConstructor("pow", crossSeriesPow), true},
+		"rangeOfSeries":              {NewAggregateConstructor("rangeOf", crossSeriesRange), true},
+		"rangeSeries":                {NewAggregateConstructor("range", crossSeriesRange), true},
+		"removeAbovePercentile":      {NewRemoveAboveBelowPercentileConstructor(true), true},
+		"removeAboveValue":           {NewRemoveAboveBelowValueConstructor(true), true},
+		"removeBelowPercentile":      {NewRemoveAboveBelowPercentileConstructor(false), true},
+		"removeBelowValue":           {NewRemoveAboveBelowValueConstructor(false), true},
+		"removeEmptySeries":          {NewRemoveEmptySeries, true},
+		"scale":                      {NewScale, true},
+		"seriesByTag":                {NewSeriesByTag, true},
+		"smartSummarize":             {NewSmartSummarize, false},
+		"sortBy":                     {NewSortByConstructor("", false), true},
+		"sortByMaxima":               {NewSortByConstructor("max", true), true},
+		"sortByMinima":               {NewSortByMinima, true},
+		"sortByName":                 {NewSortByName, true},
+		"sortByTotal":                {NewSortByConstructor("sum", true), true},
+		"squareRoot":                 {NewSquareRoot, true},
+		"stddevSeries":               {NewAggregateConstructor("stddev", crossSeriesStddev), true},
+		"sum":                        {NewAggregateConstructor("sum", crossSeriesSum), true},
+		"sumSeries":                  {NewAggregateConstructor("sum", crossSeriesSum), true},
+		"summarize":                  {NewSummarize, true},
+		"timeShift":                  {NewTimeShift, true},
+		"timeSlice":                  {NewTimeSlice, true},
+		"timeStack":                  {NewTimeStack, true},
+		"transformNull":              {NewTransformNull, true},
 	}
 }
 
+// orderedFuncs are the functions that dictate the order of their output series.
+// the output for targets using any of them is not sorted by name.
+var orderedFuncs = map[string]struct{}{
+	"highest":        {},
+	"highestAverage": {},
+	"highestCurrent": {},
+	"highestMax":     {},
+	"lowest":         {},
+	"lowestAverage":  {},
+	"lowestCurrent":  {},
+	"sortBy":         {},
+	"sortByMaxima":   {},
+	"sortByMinima":   {},
+	"sortByName":     {},
+	"sortByTotal":    {},
+}
+
 // summarizeCons returns the first explicitly specified Consolidator, QueryCons for the given set of input series,
 // or the first one, otherwise.
 func summarizeCons(series []models.Series) (consolidation.Consolidator, consolidation.Consolidator) {
@@ -93,3 +235,20 @@ func consumeFuncs(cache map[Req][]models.Series, fns []GraphiteFunc) ([]models.S
 	}
 	return series, queryPatts, nil
 }
+
+// deriveSeries returns a series with the given name and points, which are derived from the given input series.
+// the series keeps the interval, consolidation and tags of the input, and is added to the cache,
+// so that its points can be reclaimed once the output is consumed.
+func deriveSeries(cache map[Req][]models.Series, in models.Series, name string, points []schema.Point) models.Series {
+	output := models.Series{
+		Target:       name,
+		Tags:         in.CopyTags(),
+		QueryPatt:    name,
+		Datapoints:   points,
+		Interval:     in.Interval,
+		Consolidator: in.Consolidator,
+		QueryCons:    in.QueryCons,
+	}
+	cache[Req{}] = append(cache[Req{}], output)
+	return output
+}
@@ -0,0 +1,107 @@
+package expr
+
+// holt-winters (triple exponential smoothing) analysis of series, as used by the holtWinters* functions
+import (
+	"math"
+
+	"gopkg.in/raintank/schema.v1"
+)
+
+// the smoothing factors graphite uses
+const (
+	holtWintersAlpha = 0.1
+	holtWintersBeta  = 0.0035
+	holtWintersGamma = 0.1
+)
+
+// holtWintersAnalysis computes the prediction and deviation for each of the given points, like graphite does.
+// seasonLength is the number of points in a season.
+// predictions are NaN where they can't be made, due to missing input.
+func holtWintersAnalysis(points []schema.Point, seasonLength int) (predictions, deviations []float64) {
+	intercepts := make([]float64, 0, len(points))
+	slopes := make([]float64, 0, len(points))
+	seasonals := make([]float64, 0, len(points))
+	predictions = make([]float64, 0, len(points))
+	deviations = make([]float64, 0, len(points))
+
+	// getLast returns the value from one season before the given index, or 0 if there is none
+	getLast := func(vals []float64, i int) float64 {
+		j := i - seasonLength
+		if j >= 0 && j < len(vals) {
+			return vals[j]
+		}
+		return 0
+	}
+
+	nextPrediction := math.NaN()
+	for i, p := range points {
+		actual := p.Val
+		if math.IsNaN(actual) {
+			// missing input values break all the math.
+			// do the best we can and move on
+			intercepts = append(intercepts, math.NaN())
+			slopes = append(slopes, 0)
+			seasonals = append(seasonals, 0)
+			predictions = append(predictions, nextPrediction)
+			deviations = append(deviations, 0)
+			nextPrediction = math.NaN()
+			continue
+		}
+
+		var lastIntercept, lastSlope, prediction float64
+		if i == 0 {
+			lastIntercept = actual
+			lastSlope = 0
+			// seed the first prediction as the first actual
+			prediction = actual
+		} else {
+			lastIntercept = intercepts[i-1]
+			lastSlope = slopes[i-1]
+			if math.IsNaN(lastIntercept) {
+				lastIntercept = actual
+			}
+			prediction = nextPrediction
+		}
+
+		lastSeasonal := getLast(seasonals, i)
+		nextLastSeasonal := getLast(seasonals, i+1)
+		lastSeasonalDev := getLast(deviations, i)
+
+		intercept := holtWintersAlpha*(actual-lastSeasonal) + (1-holtWintersAlpha)*(lastIntercept+lastSlope)
+		slope := holtWintersBeta*(intercept-lastIntercept) + (1-holtWintersBeta)*lastSlope
+		seasonal := holtWintersGamma*(actual-intercept) + (1-holtWintersGamma)*lastSeasonal
+		nextPrediction = intercept + slope + nextLastSeasonal
+
+		predictionForDev := prediction
+		if math.IsNaN(predictionForDev) {
+			predictionForDev = 0
+		}
+		deviation := holtWintersGamma*math.Abs(actual-predictionForDev) + (1-holtWintersGamma)*lastSeasonalDev
+
+		intercepts = append(intercepts, intercept)
+		slopes = append(slopes, slope)
+		seasonals = append(seasonals, seasonal)
+		predictions = append(predictions, prediction)
+		deviations = append(deviations, deviation)
+	}
+	return predictions, deviations
+}
+
+// holtWintersBands returns the lower and upper confidence band for the given prediction and deviation
+func holtWintersBands(prediction, deviation, delta float64) (float64, float64) {
+	// NaN's propagate, so no special treatment needed
+	return prediction - delta*deviation, prediction + delta*deviation
+}
+
+// holtWintersParams returns the number of points in the bootstrap period and in a season, for the given interval.
+// the bootstrap points are capped to the available number of points
+func holtWintersParams(bootstrapInterval, seasonality string, interval uint32, numPoints int) (int, int) {
+	if interval == 0 {
+		return 0, 0
+	}
+	bootstrapPoints := int(absTimeOffset(bootstrapInterval) / int64(interval))
+	if bootstrapPoints > numPoints {
+		bootstrapPoints = numPoints
+	}
+	return bootstrapPoints, int(absTimeOffset(seasonality) / int64(interval))
+}
@@ -0,0 +1,38 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// getHoltWintersTestInput returns a series of which the first 4 points make up the bootstrap period
+// when using a bootstrapInterval of 40s.
+func getHoltWintersTestInput() []models.Series {
+	vals := []float64{1, 3, 2, 4, math.NaN(), 5, 3, 6, 4, 20}
+	var points []schema.Point
+	for i, v := range vals {
+		points = append(points, schema.Point{Val: v, Ts: uint32(10 * (i + 1))})
+	}
+	return []models.Series{{Target: "a", QueryPatt: "a", Interval: 10, Datapoints: points}}
+}
+
+// checkHoltWinters compares the output of a holtWinters function against the expected values,
+// which were obtained from graphite's implementation
+func checkHoltWinters(got models.Series, expTarget string, exp []float64, t *testing.T) {
+	if got.Target != expTarget {
+		t.Errorf("expected target %q, got %q", expTarget, got.Target)
+	}
+	if len(got.Datapoints) != len(exp) {
+		t.Fatalf("%s: expected %d points, got %d", expTarget, len(exp), len(got.Datapoints))
+	}
+	for i, p := range got.Datapoints {
+		expTs := uint32(50 + 10*i)
+		bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp[i])
+		if p.Ts != expTs || (!bothNaN && math.Abs(p.Val-exp[i]) > 1e-9) {
+			t.Errorf("%s: point %d: expected ts %d val %f, got ts %d val %f", expTarget, i, expTs, exp[i], p.Ts, p.Val)
+		}
+	}
+}
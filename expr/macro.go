@@ -0,0 +1,241 @@
+package expr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// maxMacroDepth is how deeply macros may be nested, which also protects against recursive definitions
+const maxMacroDepth = 16
+
+var ErrMacroDepth = errors.New("macros nested too deeply or defined recursively")
+
+type ErrMacroArgCount struct {
+	macro string
+	exp   int
+	got   int
+}
+
+func (e ErrMacroArgCount) Error() string {
+	return fmt.Sprintf("macro %q expects %d arguments, got %d", e.macro, e.exp, e.got)
+}
+
+var (
+	macroHeader = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*)\((.*)\)$`)
+	macroParam  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Macro is a user-defined function, which is expanded into its body at parse time.
+// every $param in the body is replaced by the corresponding argument of the call, see substitute.
+// within metric patterns, the arguments must result in a valid pattern.
+type Macro struct {
+	Name   string
+	Params []string
+	Body   string
+}
+
+// macros holds the current map[string]Macro, keyed by name
+var macros atomic.Value
+
+// SetMacros sets the macros to expand. it is safe to call concurrently with parsing.
+func SetMacros(m map[string]Macro) {
+	macros.Store(m)
+}
+
+func getMacros() map[string]Macro {
+	m, _ := macros.Load().(map[string]Macro)
+	return m
+}
+
+// ReadMacros reads and validates the macro definitions in the given file.
+// every definition looks like `name(param1, param2) := body`, where body may refer to the
+// parameters as $param1 and $param2. lines starting with whitespace continue the previous definition,
+// and lines starting with # are comments.
+func ReadMacros(file string) (map[string]Macro, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMacros(f)
+}
+
+func parseMacros(r io.Reader) (map[string]Macro, error) {
+	var defs []string
+	var lines []int // the line number of each definition
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		if trimmed != line {
+			if len(defs) == 0 {
+				return nil, fmt.Errorf("line %d: continuation of a missing definition", num)
+			}
+			defs[len(defs)-1] += " " + trimmed
+			continue
+		}
+		defs = append(defs, line)
+		lines = append(lines, num)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]Macro, len(defs))
+	names := make([]string, 0, len(defs))
+	for i, def := range defs {
+		m, err := parseMacro(def)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lines[i], err)
+		}
+		if _, ok := out[m.Name]; ok {
+			return nil, fmt.Errorf("line %d: macro %q defined twice", lines[i], m.Name)
+		}
+		out[m.Name] = m
+		names = append(names, m.Name)
+	}
+	// macros may use macros defined after them, so only validate once we have all of them
+	for i, name := range names {
+		if err := validateMacro(out[name], out); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lines[i], err)
+		}
+	}
+	return out, nil
+}
+
+func parseMacro(def string) (Macro, error) {
+	pos := strings.Index(def, ":=")
+	if pos < 0 {
+		return Macro{}, errors.New("missing ':=' between macro signature and body")
+	}
+	match := macroHeader.FindStringSubmatch(strings.TrimSpace(def[:pos]))
+	if match == nil {
+		return Macro{}, fmt.Errorf("invalid macro signature %q", strings.TrimSpace(def[:pos]))
+	}
+	m := Macro{
+		Name: match[1],
+		Body: strings.TrimSpace(def[pos+2:]),
+	}
+	// like functions, macros can't be called without arguments
+	for _, param := range strings.Split(match[2], ",") {
+		param = strings.TrimSpace(param)
+		if !macroParam.MatchString(param) {
+			return Macro{}, fmt.Errorf("macro %q: invalid parameter name %q", m.Name, param)
+		}
+		for _, p := range m.Params {
+			if p == param {
+				return Macro{}, fmt.Errorf("macro %q: parameter %q specified twice", m.Name, param)
+			}
+		}
+		m.Params = append(m.Params, param)
+	}
+	if m.Body == "" {
+		return Macro{}, fmt.Errorf("macro %q: missing body", m.Name)
+	}
+	return m, nil
+}
+
+// validateMacro validates that the macro doesn't shadow a native function, only refers to its own parameters,
+// and that a call to it can be expanded given all macros
+func validateMacro(m Macro, all map[string]Macro) error {
+	if _, ok := funcs[m.Name]; ok {
+		return fmt.Errorf("macro %q has the name of a native function", m.Name)
+	}
+	for _, ref := range macroRefs(m.Body) {
+		found := false
+		for _, p := range m.Params {
+			found = found || p == ref
+		}
+		if !found {
+			return fmt.Errorf("macro %q: body refers to unknown parameter $%s", m.Name, ref)
+		}
+	}
+	call := &expr{str: m.Name, etype: etFunc}
+	for _, p := range m.Params {
+		call.args = append(call.args, &expr{str: p, etype: etName})
+	}
+	if _, err := expand(call, all, nil, 0); err != nil {
+		return fmt.Errorf("macro %q: %s", m.Name, err)
+	}
+	return nil
+}
+
+// macroRefs returns the names of the $params referred to in the given body
+func macroRefs(body string) []string {
+	var refs []string
+	for i := 0; i < len(body); i++ {
+		if body[i] != '$' {
+			continue
+		}
+		j := i + 1
+		for j < len(body) && isParamChar(body[j]) {
+			j++
+		}
+		refs = append(refs, body[i+1:j])
+		i = j - 1
+	}
+	return refs
+}
+
+func isParamChar(r byte) bool {
+	return isFnChar(r) || r == '_'
+}
+
+// arguments returns the arguments of the given call, keyed by the parameter they are for
+func (m Macro) arguments(call *expr) (map[string]*expr, error) {
+	if len(call.args) > len(m.Params) {
+		return nil, ErrMacroArgCount{m.Name, len(m.Params), len(call.args)}
+	}
+	values := make(map[string]*expr, len(m.Params))
+	for i, arg := range call.args {
+		values[m.Params[i]] = arg
+	}
+	for key, arg := range call.namedArgs {
+		found := false
+		for _, p := range m.Params {
+			found = found || p == key
+		}
+		if !found {
+			return nil, ErrUnknownKwarg{key}
+		}
+		if _, ok := values[key]; ok {
+			return nil, ErrKwargSpecifiedTwice{key}
+		}
+		values[key] = arg
+	}
+	if len(values) != len(m.Params) {
+		return nil, ErrMacroArgCount{m.Name, len(m.Params), len(values)}
+	}
+	return values, nil
+}
+
+// expandCall returns the expression that the given call of the macro expands into.
+// the positions of the returned expressions are those of the call.
+func (m Macro) expandCall(call *expr) (*expr, error) {
+	values, err := m.arguments(call)
+	if err != nil {
+		return nil, err
+	}
+	out, leftover, err := Parse(m.Body)
+	if err != nil {
+		return nil, fmt.Errorf("macro %q: failed to parse %q: %s", m.Name, m.Body, err)
+	}
+	if leftover != "" {
+		return nil, fmt.Errorf("macro %q: failed to parse %q fully. got leftover %q", m.Name, m.Body, leftover)
+	}
+	out, err = out.substitute(values, substituteOpts{inStrings: true, validate: true})
+	if err != nil {
+		return nil, fmt.Errorf("macro %q: %s", m.Name, err)
+	}
+	out.setPos(call.pos)
+	return out, nil
+}
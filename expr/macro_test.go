@@ -0,0 +1,121 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+var testMacros = `
+# the error rate of a service
+errorRate(service) := asPercent(sumSeries(services.$service.errors.*),
+    sumSeries(services.$service.requests.*))
+errorRateAlias(service) := alias(errorRate($service), '$service errors')
+scaled(series, factor) := scale($series, $factor)
+aliased(series, name) := alias($series, $name)
+total(name) := alias(a, '$name total')
+`
+
+func TestParseMacros(t *testing.T) {
+	m, err := parseMacros(strings.NewReader(testMacros))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(m) != 5 {
+		t.Fatalf("expected 5 macros, got %d", len(m))
+	}
+	exp := Macro{
+		Name:   "errorRate",
+		Params: []string{"service"},
+		Body:   "asPercent(sumSeries(services.$service.errors.*), sumSeries(services.$service.requests.*))",
+	}
+	got := m["errorRate"]
+	if got.Name != exp.Name || strings.Join(got.Params, ",") != strings.Join(exp.Params, ",") || got.Body != exp.Body {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+}
+
+func TestParseMacrosInvalid(t *testing.T) {
+	cases := []struct {
+		def string
+		err string
+	}{
+		{"foo(a) = scale($a, 2)", "line 1: missing ':='"},
+		{"foo(a, a) := scale($a, 2)", `line 1: macro "foo": parameter "a" specified twice`},
+		{"foo(a-b) := scale($a, 2)", `line 1: macro "foo": invalid parameter name "a-b"`},
+		{"foo(a) := ", `line 1: macro "foo": missing body`},
+		{"foo() := scale(a, 2)", `line 1: macro "foo": invalid parameter name ""`},
+		{"foo(a) := scale($a, 2)\nfoo(b) := $b", `line 2: macro "foo" defined twice`},
+		{"sumSeries(a) := scale($a, 2)", `line 1: macro "sumSeries" has the name of a native function`},
+		{"foo(a) := scale($b, 2)", `line 1: macro "foo": body refers to unknown parameter $b`},
+		{"foo(a) := scale($a, 2", `line 1: macro "foo": macro "foo": failed to parse`},
+		{"foo(a) := bar($a)\nbar(a) := foo($a)", "line 1: macro \"foo\": " + ErrMacroDepth.Error()},
+		{"  foo(a) := $a", "line 1: continuation of a missing definition"},
+	}
+	for i, c := range cases {
+		_, err := parseMacros(strings.NewReader(c.def))
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Fatalf("case %d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	m, err := parseMacros(strings.NewReader(testMacros))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	SetMacros(m)
+	defer SetMacros(nil)
+
+	errorRate := "asPercent(sumSeries(services.api.errors.*),sumSeries(services.api.requests.*))"
+	cases := []struct {
+		target string
+		exp    string // the expanded target, or the expected error
+		err    bool
+	}{
+		{"errorRate(api)", errorRate, false},
+		{"errorRate('api')", errorRate, false},
+		{"errorRate(service=api)", errorRate, false},
+		{"errorRateAlias(api)", "alias(" + errorRate + ",'api errors')", false},
+		{"sumSeries(errorRate(api), foo)", "sumSeries(" + errorRate + ",foo)", false},
+		{"scaled(sumSeries(a.*), 2.5)", "scale(sumSeries(a.*),2.5)", false},
+		{"errorRateAlias('{api,web}')", "alias(asPercent(sumSeries(services.{api,web}.errors.*),sumSeries(services.{api,web}.requests.*)),'{api,web} errors')", false},
+		{"aliased(a, 'x, y')", "alias(a,'x, y')", false},
+		{"aliased(a, 'x)')", "alias(a,'x)')", false},
+		{`aliased(a, "it's")`, `alias(a,"it's")`, false},
+		{"aliased(sumSeries(a, b), x)", "alias(sumSeries(a, b),x)", false},
+		{`total("it's")`, `alias(a,"it's total")`, false},
+		{"total('x, y)')", "alias(a,'x, y) total')", false},
+		{"errorRate('a,b')", `macro "errorRate": substituting the arguments into services.$service.errors.* results in the invalid metric pattern "services.a,b.errors.*"`, true},
+		{"errorRate('a)')", `macro "errorRate": substituting the arguments into services.$service.errors.* results in the invalid metric pattern "services.a).errors.*"`, true},
+		{"errorRate(\"it's\")", `macro "errorRate": substituting the arguments into services.$service.errors.* results in the invalid metric pattern "services.it's.errors.*"`, true},
+		{"errorRate(a, b)", `macro "errorRate" expects 1 arguments, got 2`, true},
+		{"errorRate(api, service=api)", `keyword argument "service" specified twice`, true},
+		{"errorRate(foo=api)", `unknown keyword argument "foo"`, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if c.err {
+			if et, ok := err.(ErrTarget); !ok || et.Message != c.exp {
+				t.Fatalf("case %d: expected error %q, got %v", i, c.exp, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err)
+		}
+		got := ExpandedTargets(exprs)
+		if len(got) != 1 || got[0] != c.exp {
+			t.Fatalf("case %d: expected %q, got %q", i, c.exp, got)
+		}
+	}
+
+	// targets without macros don't need to be rewritten
+	exprs, err := ParseMany([]string{"sumSeries(foo.*)"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := ExpandedTargets(exprs); got != nil {
+		t.Fatalf("expected no expanded targets, got %q", got)
+	}
+}
@@ -18,6 +18,7 @@ var (
 	ErrMissingQuote        = errors.New("missing quote")
 	ErrUnexpectedCharacter = errors.New("unexpected character")
 	ErrIllegalCharacter    = errors.New("illegal character for function name")
+	ErrMissingBracket      = errors.New("missing closing bracket")
 )
 
 type ErrBadArgument struct {
@@ -49,25 +50,69 @@ type ErrUnknownKwarg struct {
 }
 
 func (e ErrUnknownKwarg) Error() string {
-	return fmt.Sprintf("unknown keyword argument %q", e)
+	return fmt.Sprintf("unknown keyword argument %q", e.key)
 }
 
-type ErrBadKwarg struct {
+type ErrKwargSpecifiedTwice struct {
 	key string
-	exp Arg
-	got exprType
 }
 
-func (e ErrBadKwarg) Error() string {
-	return fmt.Sprintf("keyword argument %q bad type. expected %T - got %s", e.key, e.exp, e.got)
+func (e ErrKwargSpecifiedTwice) Error() string {
+	return fmt.Sprintf("keyword argument %q specified twice", e.key)
 }
 
-type ErrKwargSpecifiedTwice struct {
-	key string
+// ErrTarget is an error in a target, that can be reported to the user as a structured error
+type ErrTarget struct {
+	Target   string `json:"target"`
+	Offset   int    `json:"offset"`             // character offset in the target of the expression the error applies to
+	Expected string `json:"expected,omitempty"` // for arguments of the wrong type: the expected type
+	Got      string `json:"got,omitempty"`      // for arguments of the wrong type: the type that was specified
+	Message  string `json:"error"`
 }
 
-func (e ErrKwargSpecifiedTwice) Error() string {
-	return fmt.Sprintf("keyword argument %q specified twice", e.key)
+func (e ErrTarget) Error() string {
+	return fmt.Sprintf("%s (at offset %d of target %q)", e.Message, e.Offset, e.Target)
+}
+
+// errAt annotates an error with the offset in the target of the expression it applies to
+type errAt struct {
+	pos int
+	err error
+}
+
+func (e errAt) Error() string {
+	return e.err.Error()
+}
+
+// atPos annotates the error with the given offset, unless it already is.
+// ErrUnknownFunction is returned as is, as callers check for it to proxy the request to graphite.
+func atPos(pos int, err error) error {
+	switch err.(type) {
+	case errAt, ErrUnknownFunction, ErrTarget:
+		return err
+	}
+	return errAt{pos, err}
+}
+
+// newErrTarget returns the ErrTarget for an error in the given target
+func newErrTarget(target string, err error) error {
+	switch err.(type) {
+	case ErrUnknownFunction, ErrTarget:
+		return err
+	}
+	out := ErrTarget{
+		Target: target,
+	}
+	if e, ok := err.(errAt); ok {
+		out.Offset = e.pos
+		err = e.err
+	}
+	if e, ok := err.(ErrBadArgumentStr); ok {
+		out.Expected = e.exp
+		out.Got = e.got
+	}
+	out.Message = err.Error()
+	return out
 }
 
 type MetricRequest struct {
@@ -77,25 +122,45 @@ type MetricRequest struct {
 }
 
 // ParseMany parses a slice of strings into a slice of expressions (recursively)
+// and expands any macros (see SetMacros) and template() calls
 // not included: validation that requested functions exist, correct args are passed, etc.
 func ParseMany(targets []string) ([]*expr, error) {
+	return ParseManyTemplate(targets, nil)
+}
+
+// ParseManyTemplate is like ParseMany, but with the given variables for template(),
+// which override those specified in the template calls. (like graphite's template[<name>] request parameters)
+// errors are returned as ErrTarget.
+func ParseManyTemplate(targets []string, vars map[string]string) ([]*expr, error) {
 	var out []*expr
+	macros := getMacros()
 	for _, target := range targets {
 		e, leftover, err := Parse(target)
 		if err != nil {
-			return nil, err
+			return nil, newErrTarget(target, errAt{len(target) - len(leftover), err})
 		}
 		if leftover != "" {
-			return nil, fmt.Errorf("failed to parse %q fully. got leftover %q", target, leftover)
+			return nil, newErrTarget(target, errAt{len(target) - len(leftover), fmt.Errorf("failed to parse %q fully. got leftover %q", target, leftover)})
 		}
+		e, err = expand(e, macros, vars, 0)
+		if err != nil {
+			return nil, newErrTarget(target, err)
+		}
+		e.input = target
 		out = append(out, e)
 	}
 	return out, nil
 }
 
 // Parses an expression string and turns it into an expression
-// also returns any leftover data that could not be parsed
+// also returns any leftover data that could not be parsed.
+// on error, the leftover data starts where the error was found.
 func Parse(e string) (*expr, string, error) {
+	return parse(e, len(e))
+}
+
+// parse parses an expression in the given remainder of a target that has the given length
+func parse(e string, total int) (*expr, string, error) {
 	// skip whitespace
 	for len(e) > 1 && e[0] == ' ' {
 		e = e[1:]
@@ -104,52 +169,72 @@ func Parse(e string) (*expr, string, error) {
 	if len(e) == 0 {
 		return nil, "", ErrMissingExpr
 	}
+	pos := total - len(e)
 
-	if '0' <= e[0] && e[0] <= '9' || e[0] == '-' || e[0] == '+' {
-		return parseConst(e)
-	}
-
-	if strings.HasPrefix(e, "True") || strings.HasPrefix(e, "true") {
-		return &expr{bool: true, str: e[:4], etype: etBool}, e[4:], nil
+	if '0' <= e[0] && e[0] <= '9' || e[0] == '-' || e[0] == '+' || e[0] == '.' {
+		exp, leftover, err := parseConst(e)
+		if err != nil {
+			return nil, e, err
+		}
+		// if it's not a number, it's a name that starts like one, e.g. 1min.foo
+		if exp != nil {
+			exp.pos = pos
+			return exp, leftover, nil
+		}
 	}
 
-	if strings.HasPrefix(e, "False") || strings.HasPrefix(e, "false") {
-		return &expr{bool: false, str: e[:5], etype: etBool}, e[5:], nil
+	if e[0] == '[' && !isCharClass(e) {
+		return parseList(e, total)
 	}
 
 	if e[0] == '\'' || e[0] == '"' {
-		val, e, err := parseString(e)
-		return &expr{str: val, etype: etString}, e, err
+		val, leftover, err := parseString(e)
+		if err != nil {
+			return nil, e, err
+		}
+		return &expr{str: val, etype: etString, pos: pos}, leftover, nil
 	}
 
-	name, e := parseName(e)
+	name, leftover := parseName(e)
 
 	if name == "" {
 		return nil, e, ErrMissingArg
 	}
 
-	if e != "" && e[0] == '(' {
+	if leftover != "" && leftover[0] == '(' {
 		for i := range name {
 			if !isFnChar(name[i]) {
-				return nil, "", ErrIllegalCharacter
+				return nil, e[i:], ErrIllegalCharacter
 			}
 		}
 
-		exp := &expr{str: name, etype: etFunc}
+		exp := &expr{str: name, etype: etFunc, pos: pos}
 
-		ArgString, posArgs, namedArgs, e, err := parseArgList(e)
+		ArgString, posArgs, namedArgs, leftover, err := parseArgList(leftover, total)
+		if err != nil {
+			return nil, leftover, err
+		}
 		exp.argsStr = ArgString
 		exp.args = posArgs
 		exp.namedArgs = namedArgs
 
-		return exp, e, err
+		return exp, leftover, nil
+	}
+
+	switch name {
+	case "True", "true":
+		return &expr{bool: true, str: name, etype: etBool, pos: pos}, leftover, nil
+	case "False", "false":
+		return &expr{bool: false, str: name, etype: etBool, pos: pos}, leftover, nil
+	case "None":
+		return &expr{str: name, etype: etNone, pos: pos}, leftover, nil
 	}
 
-	return &expr{str: name, etype: etName}, e, nil
+	return &expr{str: name, etype: etName, pos: pos}, leftover, nil
 }
 
 // caller must assure s starts with opening paren
-func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
+func parseArgList(e string, total int) (string, []*expr, map[string]*expr, string, error) {
 
 	var (
 		posArgs   []*expr
@@ -167,36 +252,37 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 	for {
 		var arg *expr
 		var err error
-		arg, e, err = Parse(e)
+		start := e
+		arg, e, err = parse(e, total)
 		if err != nil {
 			return "", nil, nil, e, err
 		}
 
 		if e == "" {
-			return "", nil, nil, "", ErrMissingComma
+			return "", nil, nil, e, ErrMissingComma
 		}
 
 		// we now know we're parsing a key-value pair
 		// in the future we should probably add validation here that the key
 		// can't contain otherwise-valid-name chars like {, }, etc
+		// any type of value is accepted, it's up to the planner to validate it like a positional argument
 		if arg.etype == etName && e[0] == '=' {
 			e = e[1:]
-			argCont, eCont, errCont := Parse(e)
+			argCont, eCont, errCont := parse(e, total)
 			if errCont != nil {
 				return "", nil, nil, eCont, errCont
 			}
 
 			if eCont == "" {
-				return "", nil, nil, "", ErrMissingComma
-			}
-
-			if argCont.etype != etInt && argCont.etype != etFloat && argCont.etype != etName && argCont.etype != etString && argCont.etype != etBool {
-				return "", nil, nil, eCont, ErrBadArgumentStr{"int, float, name, bool or string", string(argCont.etype)}
+				return "", nil, nil, eCont, ErrMissingComma
 			}
 
 			if namedArgs == nil {
 				namedArgs = make(map[string]*expr)
 			}
+			if _, ok := namedArgs[arg.str]; ok {
+				return "", nil, nil, start, ErrKwargSpecifiedTwice{arg.str}
+			}
 
 			namedArgs[arg.str] = argCont
 
@@ -210,18 +296,86 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 			e = e[1:]
 		}
 
+		if e == "" {
+			return "", nil, nil, e, ErrMissingComma
+		}
+
 		if e[0] == ')' {
 			return ArgString[:len(ArgString)-len(e)], posArgs, namedArgs, e[1:], nil
 		}
 
 		if e[0] != ',' && e[0] != ' ' {
-			return "", nil, nil, "", ErrUnexpectedCharacter
+			return "", nil, nil, e, ErrUnexpectedCharacter
 		}
 
 		e = e[1:]
 	}
 }
 
+// parseList parses a list of expressions such as [1, 'foo'] or [[1, 2], [3]]
+// caller must assure s starts with an opening bracket
+func parseList(e string, total int) (*expr, string, error) {
+	if e[0] != '[' {
+		panic("list should start with bracket. calling code should have asserted this")
+	}
+
+	exp := &expr{etype: etList, pos: total - len(e)}
+	start := e
+	e = e[1:]
+	for len(e) > 0 && e[0] == ' ' {
+		e = e[1:]
+	}
+	if e != "" && e[0] == ']' {
+		e = e[1:]
+		exp.str = start[:len(start)-len(e)]
+		return exp, e, nil
+	}
+
+	for {
+		var item *expr
+		var err error
+		item, e, err = parse(e, total)
+		if err != nil {
+			return nil, e, err
+		}
+		exp.args = append(exp.args, item)
+
+		for len(e) > 0 && e[0] == ' ' {
+			e = e[1:]
+		}
+
+		if e == "" || e[0] == ')' {
+			return nil, e, ErrMissingBracket
+		}
+
+		if e[0] == ']' {
+			e = e[1:]
+			exp.str = start[:len(start)-len(e)]
+			return exp, e, nil
+		}
+
+		if e[0] != ',' {
+			return nil, e, ErrUnexpectedCharacter
+		}
+
+		e = e[1:]
+	}
+}
+
+// isCharClass returns whether s, which starts with a bracket, starts with a character class of a metric pattern,
+// such as in [ab].foo or [0-9], rather than with a list. a number between brackets is a list, unless a name follows.
+func isCharClass(s string) bool {
+	end := strings.IndexByte(s, ']')
+	if end <= 1 || strings.ContainsAny(s[1:end], ", '\"[") {
+		return false
+	}
+	if end+1 < len(s) && isNameChar(s[end+1]) {
+		return true
+	}
+	num, leftover, _ := parseConst(s[1:end])
+	return num == nil || leftover != ""
+}
+
 var nameChar = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!#$%&*+-/:;<>?@[]^_|~."
 
 func isNameChar(r byte) bool {
@@ -239,20 +393,49 @@ func isDigit(r byte) bool {
 	return '0' <= r && r <= '9'
 }
 
+// parseConst parses a number, such as 3, -3, 3.1, 1e3 or 1.5E-3.
+// it returns a nil expression if the input is not a number, but a name that starts like one.
 func parseConst(s string) (*expr, string, error) {
 
 	var i int
 	var float bool
-	// All valid characters for a floating-point constant
-	// Just slurp them all in and let ParseFloat sort 'em out
-	for i < len(s) && (isDigit(s[i]) || s[i] == '.' || s[i] == '+' || s[i] == '-' || s[i] == 'e' || s[i] == 'E') {
-		// note that exponent syntax results into a float value.
-		// so even values like 1e3 (1000) or 2000e-3 (2) which can be expressed as integers,
-		// are considered floating point values.  if a function expets an int, then just don't use 'e' syntax.
-		if s[i] == '.' || s[i] == 'e' || s[i] == 'E' {
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	start := i
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i < len(s) && s[i] == '.' {
+		float = true
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	if i == start || (float && i == start+1) {
+		// no digits at all
+		return nil, s, nil
+	}
+	// note that exponent syntax results into a float value.
+	// so even values like 1e3 (1000) or 2000e-3 (2) which can be expressed as integers,
+	// are considered floating point values. functions that expect an int accept them if they are whole numbers.
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
 			float = true
+			i = j
 		}
-		i++
+	}
+	// a number followed by other name characters is a name, e.g. a metric name like 10.0.0.1.cpu
+	if i < len(s) && s[i] != ']' && (isNameChar(s[i]) || s[i] == '{') {
+		return nil, s, nil
 	}
 
 	if float {
@@ -319,7 +319,7 @@ func TestParse(t *testing.T) {
 				namedArgs: map[string]*expr{
 					"key1": {etype: etString, str: "value1"},
 					"key2": {etype: etBool, str: "true", bool: true},
-					"key3": {etype: etName, str: "None"},
+					"key3": {etype: etNone, str: "None"},
 				},
 				argsStr: "metric1;tag1=val1, key1='value1', metric2;tag2=val2, key2=true, metric3;tag3=val3, key3=None, metric4;tag4=val4",
 			},
@@ -350,6 +350,99 @@ func TestParse(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"func(metric, None, key=None)",
+			&expr{
+				str:   "func",
+				etype: etFunc,
+				args: []*expr{
+					{str: "metric"},
+					{etype: etNone, str: "None"},
+				},
+				namedArgs: map[string]*expr{
+					"key": {etype: etNone, str: "None"},
+				},
+				argsStr: "metric, None, key=None",
+			},
+			nil,
+		},
+		{
+			"func(metric, key=otherFunc(foo.*, 1e3))",
+			&expr{
+				str:   "func",
+				etype: etFunc,
+				args: []*expr{
+					{str: "metric"},
+				},
+				namedArgs: map[string]*expr{
+					"key": {
+						str:   "otherFunc",
+						etype: etFunc,
+						args: []*expr{
+							{str: "foo.*"},
+							{etype: etFloat, str: "1e3", float: 1000},
+						},
+						argsStr: "foo.*, 1e3",
+					},
+				},
+				argsStr: "metric, key=otherFunc(foo.*, 1e3)",
+			},
+			nil,
+		},
+		{
+			"func(metric, [1, 'two', [3.5, -2E-2]], [ ])",
+			&expr{
+				str:   "func",
+				etype: etFunc,
+				args: []*expr{
+					{str: "metric"},
+					{
+						etype: etList,
+						str:   "[1, 'two', [3.5, -2E-2]]",
+						args: []*expr{
+							{etype: etInt, str: "1", int: 1},
+							{etype: etString, str: "two"},
+							{
+								etype: etList,
+								str:   "[3.5, -2E-2]",
+								args: []*expr{
+									{etype: etFloat, str: "3.5", float: 3.5},
+									{etype: etFloat, str: "-2E-2", float: -0.02},
+								},
+							},
+						},
+					},
+					{etype: etList, str: "[ ]"},
+				},
+				argsStr: "metric, [1, 'two', [3.5, -2E-2]], [ ]",
+			},
+			nil,
+		},
+		{
+			"func(10.0.0.1.cpu, 1min.foo, [ab].foo, Nonesuch)",
+			&expr{
+				str:   "func",
+				etype: etFunc,
+				args: []*expr{
+					{str: "10.0.0.1.cpu"},
+					{str: "1min.foo"},
+					{str: "[ab].foo"},
+					{str: "Nonesuch"},
+				},
+				argsStr: "10.0.0.1.cpu, 1min.foo, [ab].foo, Nonesuch",
+			},
+			nil,
+		},
+		{
+			"func(metric, [1, 2)",
+			nil,
+			ErrMissingBracket,
+		},
+		{
+			"func(metric, key=1, key=2)",
+			nil,
+			ErrKwargSpecifiedTwice{"key"},
+		},
 		{
 			`foo.()`,
 			nil,
@@ -373,6 +466,7 @@ func TestParse(t *testing.T) {
 			t.Errorf("case %+v expected err %v, got %v", tt.s, tt.err, err)
 			continue
 		}
+		clearPos(e)
 		if !reflect.DeepEqual(e, tt.e) {
 			spew.Config.DisablePointerAddresses = true
 			exp := spew.Sdump(tt.e)
@@ -395,6 +489,20 @@ func TestParse(t *testing.T) {
 	}
 }
 
+// clearPos clears the offsets of the expression and its arguments, which are tested separately
+func clearPos(e *expr) {
+	if e == nil {
+		return
+	}
+	e.pos = 0
+	for _, arg := range e.args {
+		clearPos(arg)
+	}
+	for _, arg := range e.namedArgs {
+		clearPos(arg)
+	}
+}
+
 func TestExtractMetric(t *testing.T) {
 	var tests = []struct {
 		in  string
@@ -436,3 +544,34 @@ func TestExtractMetric(t *testing.T) {
 		}
 	}
 }
+
+func TestTargetErrors(t *testing.T) {
+	cases := []struct {
+		target string
+		exp    ErrTarget
+	}{
+		{"sumSeries(foo", ErrTarget{Offset: 13, Message: ErrMissingComma.Error()}},
+		{"sumSeries(foo, 'bar)", ErrTarget{Offset: 15, Message: ErrMissingQuote.Error()}},
+		{"groupByNodes(foo, 'sum', [1, 2)", ErrTarget{Offset: 30, Message: ErrMissingBracket.Error()}},
+		{"sumSeries(foo, bar) baz", ErrTarget{Offset: 19, Message: `failed to parse "sumSeries(foo, bar) baz" fully. got leftover " baz"`}},
+		{"scale(foo, 'a')", ErrTarget{Offset: 11, Expected: "float", Got: "string", Message: "argument bad type. expected float - got string"}},
+		{"sumSeries(foo, 1e3)", ErrTarget{Offset: 15, Message: ErrTooManyArg.Error()}},
+		{"sumSeries(1e3)", ErrTarget{Offset: 10, Expected: "func or name", Got: "float", Message: "argument bad type. expected func or name - got float"}},
+		{"alias(scale(foo, factor=True), 'bar')", ErrTarget{Offset: 24, Expected: "float", Got: "bool", Message: "argument bad type. expected float - got bool"}},
+		{"scale(foo, 2, factor=3)", ErrTarget{Offset: 0, Message: `keyword argument "factor" specified twice`}},
+		{"scale(foo, 2, bar=3)", ErrTarget{Offset: 18, Message: `unknown keyword argument "bar"`}},
+		{"scale(foo, 2, 3)", ErrTarget{Offset: 14, Message: ErrTooManyArg.Error()}},
+		{"alias(scale(foo), 'bar')", ErrTarget{Offset: 6, Message: ErrMissingArg.Error()}},
+		{"movingAverage(foo, '1x')", ErrTarget{Offset: 19, Message: "windowSize: invalid time offset"}},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err == nil {
+			_, err = NewPlan(exprs, 1000, 2000, 800, true, nil, nil)
+		}
+		c.exp.Target = c.target
+		if !reflect.DeepEqual(err, c.exp) {
+			t.Errorf("case %d: %q: expected error %#v, got %#v", i, c.target, c.exp, err)
+		}
+	}
+}
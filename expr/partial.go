@@ -0,0 +1,70 @@
+package expr
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Partial describes how to execute targets that metrictank can't fully execute itself:
+// the largest subtrees that are natively supported are executed by metrictank,
+// and the remainder of the targets is delegated to graphite.
+type Partial struct {
+	Targets []string // the targets for graphite to execute, with each native subtree replaced by its placeholder
+	exprs   []*expr  // the native subtrees, the i'th of which is referenced by the i'th placeholder
+}
+
+// NewPartial splits the given expressions into the largest subtrees that can be executed natively,
+// and the targets that graphite should execute, in which each native subtree is replaced by
+// the series pattern returned by placeholder. plain metric patterns are left as is,
+// as graphite fetches those from us anyway.
+// from, to, stable and loc are the parameters of the request, as passed to NewPlan.
+func NewPartial(exprs []*expr, from, to uint32, stable bool, loc *time.Location, placeholder func(i int) string) Partial {
+	var p Partial
+	for _, e := range exprs {
+		p.Targets = append(p.Targets, p.split(e, Context{from: from, to: to, loc: loc}, stable, placeholder))
+	}
+	return p
+}
+
+// Len returns the number of native subtrees
+func (p Partial) Len() int {
+	return len(p.exprs)
+}
+
+// NewPlan returns the plan to execute the i'th native subtree for the given time range.
+// like for requests from graphite, no runtime consolidation is done.
+func (p Partial) NewPlan(i int, from, to uint32, stable bool, loc *time.Location) (Plan, error) {
+	return NewPlan([]*expr{p.exprs[i]}, from, to, 0, stable, loc, nil)
+}
+
+// split returns the target for graphite for the given expression, registering any native subtrees
+func (p *Partial) split(e *expr, context Context, stable bool, placeholder func(i int) string) string {
+	if e.etype != etFunc {
+		return e.target()
+	}
+	if _, _, err := newplan(e, context, stable, nil, newDedup()); err == nil {
+		// identical subtrees are only executed once
+		canonical := e.canonical()
+		for i, native := range p.exprs {
+			if native.canonical() == canonical {
+				return placeholder(i)
+			}
+		}
+		p.exprs = append(p.exprs, e)
+		return placeholder(len(p.exprs) - 1)
+	}
+	args := make([]string, 0, len(e.args)+len(e.namedArgs))
+	for _, arg := range e.args {
+		args = append(args, p.split(arg, context, stable, placeholder))
+	}
+	keys := make([]string, 0, len(e.namedArgs))
+	for key := range e.namedArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, key+"="+p.split(e.namedArgs[key], context, stable, placeholder))
+	}
+	return e.str + "(" + strings.Join(args, ",") + ")"
+}
@@ -0,0 +1,92 @@
+package expr
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestNewPartial(t *testing.T) {
+	placeholder := func(i int) string {
+		return "_p" + strconv.Itoa(i) + ".*"
+	}
+	cases := []struct {
+		targets    []string
+		stable     bool
+		expTargets []string
+		expQueries []string // the query of the request of each native subtree
+	}{
+		{
+			[]string{"someFunc(sumSeries(foo.*))"},
+			true,
+			[]string{"someFunc(_p0.*)"},
+			[]string{"foo.*"},
+		},
+		{
+			// plain patterns and other arguments are left as is
+			[]string{`someFunc(foo.*, 'a', 1.5, "it's", key=True)`},
+			true,
+			[]string{`someFunc(foo.*,'a',1.5,"it's",key=True)`},
+			nil,
+		},
+		{
+			// natively supported targets are replaced entirely
+			[]string{"sumSeries(a.*)", "someFunc(movingAverage(b, 5), alias(c, 'c'))"},
+			true,
+			[]string{"_p0.*", "someFunc(_p1.*,_p2.*)"},
+			[]string{"a.*", "b", "c"},
+		},
+		{
+			// identical subtrees share their placeholder
+			[]string{"someFunc(sumSeries(a.*), sumSeries( a.* ))", "sumSeries(a.*)"},
+			true,
+			[]string{"someFunc(_p0.*,_p0.*)", "_p0.*"},
+			[]string{"a.*"},
+		},
+		{
+			// natively supported functions that depend on unsupported ones are left to graphite
+			[]string{"sumSeries(someFunc(scale(foo, 2)), bar)"},
+			true,
+			[]string{"sumSeries(someFunc(_p0.*),bar)"},
+			[]string{"foo"},
+		},
+		{
+			// unstable functions are only executed natively if requested
+			[]string{"someFunc(smartSummarize(foo, '1h'))"},
+			true,
+			[]string{"someFunc(smartSummarize(foo,'1h'))"},
+			nil,
+		},
+		{
+			[]string{"someFunc(smartSummarize(foo, '1h'))"},
+			false,
+			[]string{"someFunc(_p0.*)"},
+			[]string{"foo"},
+		},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany(c.targets)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		partial := NewPartial(exprs, 1000, 2000, c.stable, nil, placeholder)
+		if !reflect.DeepEqual(partial.Targets, c.expTargets) {
+			t.Fatalf("case %d: expected targets %q, got %q", i, c.expTargets, partial.Targets)
+		}
+		if partial.Len() != len(c.expQueries) {
+			t.Fatalf("case %d: expected %d native subtrees, got %d", i, len(c.expQueries), partial.Len())
+		}
+		for j, query := range c.expQueries {
+			plan, err := partial.NewPlan(j, 1000, 2000, c.stable, nil)
+			if err != nil {
+				t.Fatalf("case %d: subtree %d: %s", i, j, err)
+			}
+			if len(plan.Reqs) != 1 || plan.Reqs[0].Query != query {
+				t.Fatalf("case %d: subtree %d: expected a request for %q, got %v", i, j, query, plan.Reqs)
+			}
+			if plan.MaxDataPoints != 0 {
+				t.Fatalf("case %d: subtree %d: expected no runtime consolidation, got mdp %d", i, j, plan.MaxDataPoints)
+			}
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"time"
 
 	"github.com/grafana/metrictank/api/models"
 	"github.com/grafana/metrictank/consolidation"
+	"gopkg.in/raintank/schema.v1"
 )
 
 // Req represents a request for one/more series
@@ -16,6 +18,10 @@ type Req struct {
 	From  uint32
 	To    uint32
 	Cons  consolidation.Consolidator // can be 0 to mean undefined
+	// number of points to fetch before From, on top of the From-To range.
+	// used by functions that need a number of points, rather than a duration, worth of earlier data.
+	// as the interval is not known yet when planning, the fetcher should extend From accordingly
+	PrePoints uint32
 }
 
 // NewReq creates a new Req. pass cons=0 to leave consolidator undefined,
@@ -37,9 +43,14 @@ type Plan struct {
 	From          uint32                  // global request scoped from
 	To            uint32                  // global request scoped to
 	data          map[Req][]models.Series // input data to work with. set via Run(), as well as
-	// new data generated by processing funcs. useful for two reasons:
-	// 1) reuse partial calculations e.g. queries like target=movingAvg(sum(foo), 10)&target=sum(foo) (TODO)
-	// 2) central place to return data back to pool when we're done.
+	// new data generated by processing funcs. this is the central place to return data back to pool when we're done.
+	// (partial calculations, e.g. queries like target=alias(sum(foo), 'bar')&target=sum(foo), are reused via shared)
+	// the map is created by NewPlan, so that it is shared by all copies of the plan, which are passed around by value.
+	Nodes   int // number of function calls and series requests that were planned
+	Deduped int // how many of those were identical to one planned before, and are thus only fetched or computed once
+	shared  []*sharedFunc
+	// the tag expressions of the seriesByTag requests, by query
+	tagQueries map[string][]string
 }
 
 func (p Plan) Dump(w io.Writer) {
@@ -55,6 +66,7 @@ func (p Plan) Dump(w io.Writer) {
 	fmt.Fprintf(w, "MaxDataPoints: %d\n", p.MaxDataPoints)
 	fmt.Fprintf(w, "From: %d\n", p.From)
 	fmt.Fprintf(w, "To: %d\n", p.To)
+	fmt.Fprintf(w, "Deduplicated: %d of %d\n", p.Deduped, p.Nodes)
 }
 
 // Plan validates the expressions and comes up with the initial (potentially non-optimal) execution plan
@@ -64,21 +76,32 @@ func (p Plan) Dump(w io.Writer) {
 // * validation of arguments
 // * allow functions to modify the Context (change data range or consolidation)
 // * future version: allow functions to mark safe to pre-aggregate using consolidateBy or not
-func NewPlan(exprs []*expr, from, to, mdp uint32, stable bool, reqs []Req) (Plan, error) {
+// identical requests and subexpressions, within and across targets, are only planned once.
+// loc is the timezone of the request, nil means the local timezone.
+func NewPlan(exprs []*expr, from, to, mdp uint32, stable bool, loc *time.Location, reqs []Req) (Plan, error) {
+	if loc == nil {
+		loc = time.Local
+	}
 	var err error
 	var funcs []GraphiteFunc
+	dd := newDedup()
 	for _, e := range exprs {
 		var fn GraphiteFunc
 		context := Context{
 			from: from,
 			to:   to,
+			loc:  loc,
 		}
-		fn, reqs, err = newplan(e, context, stable, reqs)
+		fn, reqs, err = newplan(e, context, stable, reqs, dd)
 		if err != nil {
-			return Plan{}, err
+			return Plan{}, newErrTarget(e.input, err)
 		}
 		funcs = append(funcs, fn)
 	}
+	shared := make([]*sharedFunc, 0, len(dd.funcs))
+	for _, fn := range dd.funcs {
+		shared = append(shared, fn)
+	}
 	return Plan{
 		Reqs:          reqs,
 		exprs:         exprs,
@@ -86,21 +109,44 @@ func NewPlan(exprs []*expr, from, to, mdp uint32, stable bool, reqs []Req) (Plan
 		MaxDataPoints: mdp,
 		From:          from,
 		To:            to,
+		Nodes:         dd.nodes,
+		Deduped:       dd.deduped,
+		shared:        shared,
+		tagQueries:    dd.tagQueries,
+		data:          make(map[Req][]models.Series),
 	}, nil
 }
 
+// TagExpressions returns the tag expressions of the given request, if it is a seriesByTag query rather than a metric pattern
+func (p Plan) TagExpressions(r Req) ([]string, bool) {
+	expressions, ok := p.tagQueries[r.Query]
+	return expressions, ok
+}
+
 // newplan adds requests as needed for the given expr, resolving function calls as needed
-func newplan(e *expr, context Context, stable bool, reqs []Req) (GraphiteFunc, []Req, error) {
+func newplan(e *expr, context Context, stable bool, reqs []Req, dd *dedup) (GraphiteFunc, []Req, error) {
 	if e.etype != etFunc && e.etype != etName {
-		return nil, nil, errors.New("request must be a function call or metric pattern")
+		return nil, nil, errAt{e.pos, errors.New("request must be a function call or metric pattern")}
 	}
+	dd.nodes++
 	if e.etype == etName {
 		req := NewReq(e.str, context.from, context.to, context.consol)
-		reqs = append(reqs, req)
+		req.PrePoints = context.prePoints
+		if containsReq(reqs, req) {
+			dd.deduped++
+		} else {
+			reqs = append(reqs, req)
+		}
 		return NewGet(req), reqs, nil
 	}
 
 	// here e.type is guaranteed to be etFunc
+	key := dedupKey{e.canonical(), context}
+	if fn, ok := dd.funcs[key]; ok {
+		dd.deduped++
+		return fn, reqs, nil
+	}
+
 	fdef, ok := funcs[e.str]
 	if !ok {
 		return nil, nil, ErrUnknownFunction(e.str)
@@ -110,13 +156,45 @@ func newplan(e *expr, context Context, stable bool, reqs []Req) (GraphiteFunc, [
 	}
 
 	fn := fdef.constr()
-	reqs, err := newplanFunc(e, fn, context, stable, reqs)
-	return fn, reqs, err
+	reqs, err := newplanFunc(e, fn, context, stable, reqs, dd)
+	if err != nil {
+		return nil, nil, atPos(e.pos, err)
+	}
+	// seriesByTag has no series inputs, but like a metric pattern it needs data to be fetched
+	if sbt, ok := fn.(*FuncSeriesByTag); ok {
+		req := NewReq(sbt.Query(), context.from, context.to, context.consol)
+		req.PrePoints = context.prePoints
+		if !containsReq(reqs, req) {
+			reqs = append(reqs, req)
+		}
+		sbt.req = req
+		dd.tagQueries[req.Query] = sbt.expressions
+	}
+	shared := &sharedFunc{GraphiteFunc: fn}
+	dd.funcs[key] = shared
+	return shared, reqs, nil
+}
+
+// argKey returns the keyword by which the given arg can be specified.
+// series args that have no key of their own go by the names graphite uses for them.
+func argKey(arg Arg) string {
+	if key := arg.Key(); key != "" {
+		return key
+	}
+	switch arg.(type) {
+	case ArgSeries:
+		return "series"
+	case ArgSeriesList:
+		return "seriesList"
+	case ArgSeriesLists:
+		return "seriesLists"
+	}
+	return ""
 }
 
 // newplanFunc adds requests as needed for the given expr, and validates the function input
 // provided you already know the expression is a function call to the given function
-func newplanFunc(e *expr, fn GraphiteFunc, context Context, stable bool, reqs []Req) ([]Req, error) {
+func newplanFunc(e *expr, fn GraphiteFunc, context Context, stable bool, reqs []Req, dd *dedup) ([]Req, error) {
 	// first comes the interesting task of validating the arguments as specified by the function,
 	// against the arguments that were parsed.
 
@@ -129,93 +207,134 @@ func newplanFunc(e *expr, fn GraphiteFunc, context Context, stable bool, reqs []
 	// * we can't do extensive, accurate validation of the type here because what the output from a function we depend on
 	//   might be dynamically typed. e.g. movingAvg returns 1..N series depending on how many it got as input
 
-	// first validate the mandatory args
-	pos := 0    // pos in args of next given arg to process
-	cutoff := 0 // marks the index of the first optional point (if any)
-	var argExp Arg
-	for cutoff, argExp = range argsExp {
-		if argExp.Optional() {
-			break
-		}
-		if len(e.args) <= pos {
-			return nil, ErrMissingArg
-		}
-		pos, err = e.consumeBasicArg(pos, argExp)
-		if err != nil {
-			return nil, err
-		}
+	// args that are series(Lists) can only be set up once we know the context, which is after all basic args are known.
+	// we track them here, by the call and position at which they were specified.
+	// for keyword args, the call is a stand-in that only has the given value as positional arg.
+	type seriesArg struct {
+		e   *expr
+		pos int
+		exp Arg
 	}
-	if !argExp.Optional() {
-		cutoff += 1
+	var seriesArgs []seriesArg
+	consume := func(call *expr, pos int, exp Arg) (int, error) {
+		if call.needsSeriesArg(pos, exp) {
+			seriesArgs = append(seriesArgs, seriesArg{call, pos, exp})
+		}
+		return call.consumeBasicArg(pos, exp)
 	}
 
-	// we stopped iterating the mandatory args.
-	// any remaining args should be due to optional args otherwise there's too many
-	// we also track here which keywords can also be used for the given optional args
-	// so that those args should not be specified via their keys anymore.
-
-	seenKwargs := make(map[string]struct{})
-	for _, argOpt := range argsExp[cutoff:] {
-		if len(e.args) <= pos {
-			break // no more args specified. we're done.
+	// like in graphite, every arg, mandatory or optional, can be specified by position or by keyword.
+	// positional args come first, so we take args by position until we run out of them and then look for keywords.
+	// optional args given as None are treated as not specified.
+	pos := 0                                // pos in args of next given arg to process
+	positional := make(map[string]struct{}) // keys of the args that were specified by position
+	for _, argExp := range argsExp {
+		key := argKey(argExp)
+		if len(e.args) > pos {
+			positional[key] = struct{}{}
+			if argExp.Optional() && e.args[pos].isNone() {
+				pos++
+				continue
+			}
+			pos, err = consume(e, pos, argExp)
+			if err != nil {
+				return nil, err
+			}
+			continue
 		}
-		pos, err = e.consumeBasicArg(pos, argOpt)
-		if err != nil {
+		val, ok := e.namedArgs[key]
+		if !ok {
+			if !argExp.Optional() {
+				return nil, ErrMissingArg
+			}
+			continue
+		}
+		if argExp.Optional() && val.isNone() {
+			continue
+		}
+		kwarg := &expr{etype: etFunc, str: e.str, args: []*expr{val}, pos: e.pos}
+		if _, err = consume(kwarg, 0, argExp); err != nil {
 			return nil, err
 		}
-		seenKwargs[argOpt.Key()] = struct{}{}
 	}
 	if len(e.args) > pos {
-		return nil, ErrTooManyArg
+		return nil, errAt{e.args[pos].pos, ErrTooManyArg}
 	}
 
-	// for any provided keyword args, verify that they are what the function stipulated
+	// verify that the provided keyword args are what the function stipulated
 	// and that they have not already been specified via their position
+	keys := make([]string, 0, len(e.namedArgs))
 	for key := range e.namedArgs {
-		_, ok := seenKwargs[key]
-		if ok {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := positional[key]; ok {
 			return nil, ErrKwargSpecifiedTwice{key}
 		}
-		err = e.consumeKwarg(key, argsExp[cutoff:])
-		if err != nil {
-			return nil, err
+		found := false
+		for _, argExp := range argsExp {
+			found = found || argKey(argExp) == key
+		}
+		if !found {
+			return nil, errAt{e.namedArgs[key].pos, ErrUnknownKwarg{key}}
 		}
-		seenKwargs[key] = struct{}{}
 	}
 
 	// functions now have their non-series input args set,
 	// so they should now be able to specify any context alterations
-	context = fn.Context(context)
-	// now that we know the needed context for the data coming into
+	contexts := []Context{fn.Context(context)}
+	if mfn, ok := fn.(MultiContextFunc); ok {
+		contexts = mfn.Contexts(context)
+	}
+	// now that we know the needed context(s) for the data coming into
 	// this function, we can set up the input arguments for the function
 	// that are series
-	pos = 0
-	for _, argExp = range argsExp[:cutoff] {
-		switch argExp.(type) {
-		case ArgSeries, ArgSeriesList, ArgSeriesLists:
-			pos, reqs, err = e.consumeSeriesArg(pos, argExp, context, stable, reqs)
+	for _, context := range contexts {
+		for _, sa := range seriesArgs {
+			_, reqs, err = sa.e.consumeSeriesArg(sa.pos, sa.exp, context, stable, reqs, dd)
 			if err != nil {
 				return nil, err
 			}
-		default:
-			return reqs, err
 		}
 	}
 	return reqs, err
 }
 
-// Run invokes all processing as specified in the plan (expressions, from/to) with the input as input
+// Run invokes all processing as specified in the plan (expressions, from/to) with the input as input.
+// the buffers of the input data, as well as those of the series generated along the way, are tracked by the plan,
+// and returned to the pool by Clean.
 func (p Plan) Run(input map[Req][]models.Series) ([]models.Series, error) {
 	var out []models.Series
-	p.data = input
-	for _, fn := range p.funcs {
+	for req, series := range input {
+		p.data[req] = append(p.data[req], series...)
+	}
+	for _, fn := range p.shared {
+		fn.reset()
+	}
+	// fetched data may come in any order (e.g. from different cluster peers),
+	// sort it so that functions like limit() behave deterministically.
+	for _, series := range p.data {
+		sort.Sort(models.SeriesByTarget(series))
+	}
+	for i, fn := range p.funcs {
 		series, err := fn.Exec(p.data)
 		if err != nil {
 			return nil, err
 		}
-		sort.Sort(models.SeriesByTarget(series))
+		if !p.exprs[i].isOrdered() {
+			sort.Sort(models.SeriesByTarget(series))
+		}
 		out = append(out, series...)
 	}
+	// consolidation happens in place, so output series that share their data with others
+	// (e.g. due to deduplication of identical targets) need their own copy, except for the last one
+	users := make(map[*schema.Point]int)
+	for _, o := range out {
+		if len(o.Datapoints) != 0 {
+			users[&o.Datapoints[0]]++
+		}
+	}
 	for i, o := range out {
 		if p.MaxDataPoints != 0 && len(o.Datapoints) > int(p.MaxDataPoints) {
 			// series may have been created by a function that didn't know which consolidation function to default to.
@@ -223,6 +342,13 @@ func (p Plan) Run(input map[Req][]models.Series) ([]models.Series, error) {
 			if o.Consolidator == 0 {
 				o.Consolidator = consolidation.Avg
 			}
+			if users[&o.Datapoints[0]] > 1 {
+				users[&o.Datapoints[0]]--
+				points := getPoints(len(o.Datapoints))
+				copy(points, o.Datapoints)
+				o.Datapoints = points
+				p.data[Req{}] = append(p.data[Req{}], o)
+			}
 			out[i].Datapoints, out[i].Interval = consolidation.ConsolidateStable(o.Datapoints, o.Interval, p.MaxDataPoints, o.Consolidator)
 		}
 	}
@@ -230,11 +356,23 @@ func (p Plan) Run(input map[Req][]models.Series) ([]models.Series, error) {
 }
 
 // Clean returns all buffers (all input data + generated series along the way)
-// back to the pool.
+// back to the pool. it must only be called once the output of Run is no longer needed,
+// e.g. after the response has been written. buffers that are tracked more than once are only returned once.
 func (p Plan) Clean() {
-	for _, series := range p.data {
+	// slices of the same buffer end at the same address, wherever they start
+	seen := make(map[*schema.Point]struct{})
+	for req, series := range p.data {
 		for _, serie := range series {
+			if cap(serie.Datapoints) == 0 {
+				continue
+			}
+			end := &serie.Datapoints[:cap(serie.Datapoints)][cap(serie.Datapoints)-1]
+			if _, ok := seen[end]; ok {
+				continue
+			}
+			seen[end] = struct{}{}
 			pointSlicePool.Put(serie.Datapoints[:0])
 		}
+		delete(p.data, req)
 	}
 }
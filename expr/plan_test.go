@@ -2,10 +2,13 @@ package expr
 
 import (
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/grafana/metrictank/api/models"
 	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/test"
 )
 
 // here we use smartSummarize because it has multiple optional arguments which allows us to test some interesting things
@@ -134,6 +137,82 @@ func TestArgs(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"all args by keyword",
+			nil,
+			map[string]*expr{
+				"seriesList":  {etype: etName, str: "foo.bar.*"},
+				"interval":    {etype: etString, str: "1hour"},
+				"alignToFrom": {etype: etBool, bool: true},
+			},
+			[]Req{
+				NewReq("foo.bar.*", from, to, 0),
+			},
+			nil,
+		},
+		{
+			"optional arg as None by position, the next one by keyword",
+			[]*expr{
+				{etype: etName, str: "foo.bar.*"},
+				{etype: etString, str: "1hour"},
+				{etype: etNone, str: "None"},
+			},
+			map[string]*expr{
+				"alignToFrom": {etype: etBool, bool: true},
+			},
+			[]Req{
+				NewReq("foo.bar.*", from, to, 0),
+			},
+			nil,
+		},
+		{
+			"required arg by position and by keyword",
+			[]*expr{
+				{etype: etName, str: "foo.bar.*"},
+				{etype: etString, str: "1hour"},
+			},
+			map[string]*expr{
+				"interval": {etype: etString, str: "1hour"},
+			},
+			nil,
+			ErrKwargSpecifiedTwice{"interval"},
+		},
+		{
+			"unknown keyword",
+			[]*expr{
+				{etype: etName, str: "foo.bar.*"},
+				{etype: etString, str: "1hour"},
+			},
+			map[string]*expr{
+				"foo": {etype: etString, str: "sum", pos: 34},
+			},
+			nil,
+			errAt{34, ErrUnknownKwarg{"foo"}},
+		},
+		{
+			"too many args",
+			[]*expr{
+				{etype: etName, str: "foo.bar.*"},
+				{etype: etString, str: "1hour"},
+				{etype: etString, str: "sum"},
+				{etype: etBool, bool: true},
+				{etype: etInt, int: 1, str: "1", pos: 45},
+			},
+			nil,
+			nil,
+			errAt{45, ErrTooManyArg},
+		},
+		{
+			"required arg of wrong type by keyword",
+			[]*expr{
+				{etype: etName, str: "foo.bar.*"},
+			},
+			map[string]*expr{
+				"interval": {etype: etInt, int: 1, str: "1", pos: 34},
+			},
+			nil,
+			errAt{34, ErrBadArgumentStr{"string", "int"}},
+		},
 		{
 			"missing required argument",
 			[]*expr{
@@ -153,7 +232,7 @@ func TestArgs(t *testing.T) {
 			args:      c.args,
 			namedArgs: c.namedArgs,
 		}
-		req, err := newplanFunc(e, fn, Context{from: from, to: to}, stable, nil)
+		req, err := newplanFunc(e, fn, Context{from: from, to: to}, stable, nil, newDedup())
 		if !reflect.DeepEqual(err, c.expErr) {
 			t.Errorf("case %d: %q, expected error %v - got %v", i, c.name, c.expErr, err)
 		}
@@ -270,7 +349,7 @@ func TestConsolidateBy(t *testing.T) {
 	for i, c := range cases {
 		// for the purpose of this test, we assume ParseMany works fine.
 		exprs, _ := ParseMany([]string{c.in})
-		plan, err := NewPlan(exprs, from, to, 800, stable, nil)
+		plan, err := NewPlan(exprs, from, to, 800, stable, nil, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -427,7 +506,7 @@ func TestNamingChains(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		plan, err := NewPlan(exprs, from, to, 800, stable, nil)
+		plan, err := NewPlan(exprs, from, to, 800, stable, nil, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -458,3 +537,358 @@ func TestNamingChains(t *testing.T) {
 		}
 	}
 }
+
+// TestOrderedOutput tests that the output is sorted by target, unless the target uses a function that dictates the order
+func TestOrderedOutput(t *testing.T) {
+	from := uint32(1000)
+	to := uint32(2000)
+	cases := []struct {
+		target string
+		expOut []string
+	}{
+		{`foo.*`, []string{"foo.a", "foo.b", "foo.c"}},
+		{`limit(foo.*, 2)`, []string{"foo.a", "foo.b"}},
+		{`sortByName(foo.*, reverse=True)`, []string{"foo.c", "foo.b", "foo.a"}},
+		{`alias(sortByName(foo.*, reverse=True), 'bar')`, []string{"bar", "bar", "bar"}},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := map[Req][]models.Series{
+			plan.Reqs[0]: {
+				{QueryPatt: "foo.*", Target: "foo.b"},
+				{QueryPatt: "foo.*", Target: "foo.c"},
+				{QueryPatt: "foo.*", Target: "foo.a"},
+			},
+		}
+		out, err := plan.Run(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(c.expOut) {
+			t.Fatalf("case %d: %q: expected %d series output, not %d", i, c.target, len(c.expOut), len(out))
+		}
+		for j, exp := range c.expOut {
+			if out[j].Target != exp {
+				t.Errorf("case %d: %q: output series mismatch at pos %d: expected %q, got %q", i, c.target, j, exp, out[j].Target)
+			}
+		}
+	}
+}
+
+// TestArgIn tests that arguments that can be of multiple types (e.g. asPercent's total) are planned correctly
+func TestArgIn(t *testing.T) {
+	from := uint32(1000)
+	to := uint32(2000)
+	cases := []struct {
+		target string
+		expReq []Req
+		expErr bool
+	}{
+		{`asPercent(a.*)`, []Req{NewReq("a.*", from, to, 0)}, false},
+		{`asPercent(a.*, 50)`, []Req{NewReq("a.*", from, to, 0)}, false},
+		{`asPercent(a.*, 50.5)`, []Req{NewReq("a.*", from, to, 0)}, false},
+		{`asPercent(a.*, total=50)`, []Req{NewReq("a.*", from, to, 0)}, false},
+		{`asPercent(a.*, b)`, []Req{NewReq("a.*", from, to, 0), NewReq("b", from, to, 0)}, false},
+		{`asPercent(a.*, sum(b.*))`, []Req{NewReq("a.*", from, to, 0), NewReq("b.*", from, to, 0)}, false},
+		{`asPercent(a.*, None, 1)`, []Req{NewReq("a.*", from, to, 0)}, false},
+		{`asPercent(a.*, b.*, 0, 1)`, []Req{NewReq("a.*", from, to, 0), NewReq("b.*", from, to, 0)}, false},
+		{`asPercent(a.*, "foo")`, nil, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+		if (err != nil) != c.expErr {
+			t.Fatalf("case %d: %q: expected error %t, got %v", i, c.target, c.expErr, err)
+		}
+		if !reflect.DeepEqual(plan.Reqs, c.expReq) {
+			t.Errorf("case %d: %q, expected req %v - got %v", i, c.target, c.expReq, plan.Reqs)
+		}
+	}
+}
+
+// TestTimeShiftReqs tests that functions that shift time request data for the right time range(s)
+func TestTimeShiftReqs(t *testing.T) {
+	from := uint32(1000000)
+	to := uint32(2000000)
+	day := uint32(86400)
+	cases := []struct {
+		target string
+		expReq []Req
+		expErr bool
+	}{
+		{`timeShift(a, '1d')`, []Req{NewReq("a", from-day, to-day, 0)}, false},
+		{`timeShift(a, '-1d')`, []Req{NewReq("a", from-day, to-day, 0)}, false},
+		{`timeShift(a, '+1d')`, []Req{NewReq("a", from+day, to+day, 0)}, false},
+		{`timeShift(sum(a, b), '1d', false)`, []Req{NewReq("a", from-day, to-day, 0), NewReq("b", from-day, to-day, 0)}, false},
+		{`timeShift(a, 'foo')`, nil, true},
+		{`timeStack(a, '1d', 1, 3)`, []Req{NewReq("a", from-day, to-day, 0), NewReq("a", from-2*day, to-2*day, 0)}, false},
+		{`timeStack(a, timeShiftEnd=1)`, []Req{NewReq("a", from, to, 0)}, false},
+		{`timeSlice(a, '-1h')`, []Req{NewReq("a", from, to, 0)}, false},
+		{`timeSlice(a, 'foo')`, nil, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+		if (err != nil) != c.expErr {
+			t.Fatalf("case %d: %q: expected error %t, got %v", i, c.target, c.expErr, err)
+		}
+		if !reflect.DeepEqual(plan.Reqs, c.expReq) {
+			t.Errorf("case %d: %q, expected req %v - got %v", i, c.target, c.expReq, plan.Reqs)
+		}
+	}
+}
+
+// TestPrePointsReqs tests that functions such as the moving window and holtWinters functions request the data needed before from
+func TestPrePointsReqs(t *testing.T) {
+	from := uint32(1000000)
+	to := uint32(2000000)
+	withPrePoints := func(req Req, prePoints uint32) Req {
+		req.PrePoints = prePoints
+		return req
+	}
+	cases := []struct {
+		target string
+		expReq []Req
+		expErr bool
+	}{
+		{`movingAverage(a, '5min')`, []Req{NewReq("a", from-300, to, 0)}, false},
+		{`movingSum(a, "-1min")`, []Req{NewReq("a", from-60, to, 0)}, false},
+		{`movingAverage(a, '60y')`, []Req{NewReq("a", 0, to, 0)}, false},
+		{`movingMax(a, 5)`, []Req{withPrePoints(NewReq("a", from, to, 0), 5)}, false},
+		{`movingMin(movingMedian(a, 5), '1min')`, []Req{withPrePoints(NewReq("a", from-60, to, 0), 5)}, false},
+		{`movingWindow(movingWindow(a, 3, 'sum'), 2, xFilesFactor=0.5)`, []Req{withPrePoints(NewReq("a", from, to, 0), 5)}, false},
+		{`movingWindow(a, 3, 'foo')`, nil, true},
+		{`derivative(a)`, []Req{withPrePoints(NewReq("a", from, to, 0), 1)}, false},
+		{`nonNegativeDerivative(movingAverage(a, 2), 100)`, []Req{withPrePoints(NewReq("a", from, to, 0), 3)}, false},
+		{`delay(a, 3)`, []Req{withPrePoints(NewReq("a", from, to, 0), 3)}, false},
+		{`integral(a)`, []Req{NewReq("a", from, to, 0)}, false},
+		{`holtWintersForecast(a)`, []Req{NewReq("a", from-7*86400, to, 0)}, false},
+		{`holtWintersConfidenceBands(a, 2, '1d')`, []Req{NewReq("a", from-86400, to, 0)}, false},
+		{`holtWintersAberration(derivative(a), bootstrapInterval='1h')`, []Req{withPrePoints(NewReq("a", from-3600, to, 0), 1)}, false},
+		{`holtWintersForecast(a, '1y')`, []Req{NewReq("a", 0, to, 0)}, false},
+		{`holtWintersConfidenceBands(a, 2, '1y')`, []Req{NewReq("a", 0, to, 0)}, false},
+		{`holtWintersAberration(a, bootstrapInterval='1y')`, []Req{NewReq("a", 0, to, 0)}, false},
+		// the points before from that movingAverage needs are buckets of summarize and hitcount
+		{`movingAverage(summarize(a, '1h'), 5)`, []Req{NewReq("a", from-5*3600, to, 0)}, false},
+		{`movingSum(hitcount(a, '10min'), 3)`, []Req{NewReq("a", from-1800, to, 0)}, false},
+		{`movingAverage(summarize(a, '1d'), 30)`, []Req{NewReq("a", 0, to, 0)}, false},
+		{`movingAverage(a, 0)`, nil, true},
+		{`movingAverage(a, 'foo')`, nil, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+		if (err != nil) != c.expErr {
+			t.Fatalf("case %d: %q: expected error %t, got %v", i, c.target, c.expErr, err)
+		}
+		if !reflect.DeepEqual(plan.Reqs, c.expReq) {
+			t.Errorf("case %d: %q, expected req %v - got %v", i, c.target, c.expReq, plan.Reqs)
+		}
+	}
+}
+
+// TestSeriesByTag tests that seriesByTag results in a request for the tag query, which can be used like a metric pattern
+func TestSeriesByTag(t *testing.T) {
+	from := uint32(1000)
+	to := uint32(2000)
+	cases := []struct {
+		target         string
+		expReq         []Req
+		expExpressions []string
+		expErr         bool
+	}{
+		{`seriesByTag('name=foo')`, []Req{NewReq("seriesByTag('name=foo')", from, to, 0)}, []string{"name=foo"}, false},
+		{`seriesByTag("name=foo", "dc=~us-.*", "host!=a.b")`, []Req{NewReq("seriesByTag('name=foo','dc=~us-.*','host!=a.b')", from, to, 0)}, []string{"name=foo", "dc=~us-.*", "host!=a.b"}, false},
+		{`seriesByTag("name=foo','bar")`, []Req{NewReq(`seriesByTag("name=foo','bar")`, from, to, 0)}, []string{"name=foo','bar"}, false},
+		{`sumSeries(seriesByTag('name=foo'), bar)`, []Req{NewReq("seriesByTag('name=foo')", from, to, 0), NewReq("bar", from, to, 0)}, []string{"name=foo"}, false},
+		{`consolidateBy(seriesByTag('name=foo'), 'max')`, []Req{NewReq("seriesByTag('name=foo')", from, to, consolidation.Max)}, []string{"name=foo"}, false},
+		{`aliasByTags(seriesByTag('name=foo'), 'dc', 1)`, []Req{NewReq("seriesByTag('name=foo')", from, to, 0)}, []string{"name=foo"}, false},
+		{`groupByTags(seriesByTag('name=foo'), 'sum', 'dc', 'name')`, []Req{NewReq("seriesByTag('name=foo')", from, to, 0)}, []string{"name=foo"}, false},
+		{`groupByTags(seriesByTag('name=foo'), 'sum', 1)`, nil, nil, true},
+		{`seriesByTag('foo')`, nil, nil, true},
+		{`seriesByTag('=foo')`, nil, nil, true},
+		{`seriesByTag('name=foo', 1)`, nil, nil, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := NewPlan(exprs, from, to, 800, true, nil, nil)
+		if (err != nil) != c.expErr {
+			t.Fatalf("case %d: %q: expected error %t, got %v", i, c.target, c.expErr, err)
+		}
+		if !reflect.DeepEqual(plan.Reqs, c.expReq) {
+			t.Errorf("case %d: %q, expected req %v - got %v", i, c.target, c.expReq, plan.Reqs)
+		}
+		for _, req := range plan.Reqs {
+			expressions, ok := plan.TagExpressions(req)
+			if ok != strings.HasPrefix(req.Query, "seriesByTag") {
+				t.Errorf("case %d: %q: TagExpressions(%q) gave the wrong result", i, c.target, req.Query)
+			}
+			if ok && !reflect.DeepEqual(expressions, c.expExpressions) {
+				t.Errorf("case %d: %q: expected tag expressions %v, got %v", i, c.target, c.expExpressions, expressions)
+			}
+		}
+	}
+}
+
+func TestAggregateArgs(t *testing.T) {
+	from := uint32(1000)
+	to := uint32(2000)
+	cases := []struct {
+		target string
+		expErr bool
+	}{
+		{`aggregate(foo.*, 'sum')`, false},
+		{`aggregate(foo.*, 'rangeOf', 0.5)`, false},
+		{`aggregate(foo.*, 'bogus')`, true},
+		{`percentileOfSeries(foo.*, 95)`, false},
+		{`percentileOfSeries(foo.*, 99.9, true)`, false},
+		{`percentileOfSeries(foo.*, 0)`, true},
+		{`percentileOfSeries(foo.*, 101)`, true},
+		{`groupByNode(foo.*, 0, 'stddev')`, false},
+		{`groupByNodes(foo.*, 'count', 0, 1)`, false},
+		{`summarize(foo.*, '1d')`, false},
+		{`summarize(foo.*, '1h', 'max', true)`, false},
+		{`summarize(foo.*, '1d', 'bogus')`, true},
+		{`summarize(foo.*, 'bogus')`, true},
+		{`hitcount(foo.*, '5min', true)`, false},
+		{`hitcount(foo.*, '0s')`, true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseMany([]string{c.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewPlan(exprs, from, to, 800, true, nil, nil)
+		if (err != nil) != c.expErr {
+			t.Fatalf("case %d: %q: expected error %t, got %v", i, c.target, c.expErr, err)
+		}
+	}
+}
+
+// TestPlanClean tests that the data of a run is cleaned up, also when it ran on a copy of the plan, like in the render api
+func TestPlanClean(t *testing.T) {
+	exprs, err := ParseMany([]string{"sumSeries(foo.*)", "scale(foo.*, 2)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(exprs, 0, 10, 0, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(p Plan) {
+		input := map[Req][]models.Series{
+			plan.Reqs[0]: {{Target: "foo.a", QueryPatt: "foo.*", Datapoints: getPoints(10)}},
+		}
+		if _, err := p.Run(input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run(plan)
+	if len(plan.data[plan.Reqs[0]]) != 1 || len(plan.data[Req{}]) != 1 {
+		t.Fatalf("expected the input and the output of scale to be tracked, got %v", plan.data)
+	}
+	plan.Clean()
+	if len(plan.data) != 0 {
+		t.Fatalf("expected no data to be tracked after Clean, got %v", plan.data)
+	}
+}
+
+// TestPlanSharedFetchAlias tests that a function modifying its input series doesn't affect
+// other targets that fetch the same series
+func TestPlanSharedFetchAlias(t *testing.T) {
+	exprs, err := ParseMany([]string{"alias(a, 'x')", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(exprs, 0, 10, 0, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Reqs) != 1 {
+		t.Fatalf("expected 1 request, got %v", plan.Reqs)
+	}
+	input := map[Req][]models.Series{
+		plan.Reqs[0]: {{Target: "a", QueryPatt: "a", Datapoints: getPoints(10)}},
+	}
+	out, err := plan.Run(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected 2 series, got %v", out)
+	}
+	if out[0].Target != "x" || out[1].Target != "a" || out[1].QueryPatt != "a" {
+		t.Fatalf("expected targets x and a, got %q (%q) and %q (%q)", out[0].Target, out[0].QueryPatt, out[1].Target, out[1].QueryPatt)
+	}
+}
+
+func BenchmarkPlanRun10k_1(b *testing.B) {
+	benchmarkPlanRun(b, 1)
+}
+func BenchmarkPlanRun10k_10(b *testing.B) {
+	benchmarkPlanRun(b, 10)
+}
+func BenchmarkPlanRun10k_100(b *testing.B) {
+	benchmarkPlanRun(b, 100)
+}
+
+// benchmarkPlanRun runs a plan with a few common functions on the given number of series of 10k points.
+// like in the render api, the input is fetched into buffers from the pool, and the plan is cleaned after every run.
+func benchmarkPlanRun(b *testing.B, numSeries int) {
+	exprs, err := ParseMany([]string{
+		"sumSeries(scale(foo.*, 2))",
+		"averageSeries(offset(foo.*, 1))",
+		"maxSeries(absolute(foo.*))",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	plan, err := NewPlan(exprs, 0, 10000, 0, true, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var input []models.Series
+	for i := 0; i < numSeries; i++ {
+		input = append(input, models.Series{
+			Target:     "foo." + strconv.Itoa(i),
+			QueryPatt:  "foo.*",
+			Datapoints: test.RandFloats10k(),
+			Interval:   1,
+		})
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(numSeries * 10000 * 12))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		series := make([]models.Series, len(input))
+		for j, serie := range input {
+			series[j] = serie
+			series[j].Datapoints = getPoints(len(serie.Datapoints))
+			copy(series[j].Datapoints, serie.Datapoints)
+		}
+		results, err = plan.Run(map[Req][]models.Series{plan.Reqs[0]: series})
+		if err != nil {
+			b.Fatal(err)
+		}
+		plan.Clean()
+	}
+}
@@ -1,9 +1,19 @@
 package expr
 
-import "sync"
+import (
+	"sync"
+
+	"gopkg.in/raintank/schema.v1"
+)
 
 var pointSlicePool *sync.Pool
 
+// floatSlicePool holds the float64 columns that functions use for per-point state while they process their input,
+// such as the number of non-null values seen for every point. it holds pointers, such that putting them back doesn't allocate.
+var floatSlicePool = sync.Pool{
+	New: func() interface{} { return new([]float64) },
+}
+
 // Pool tells the expr library which pool to use for temporary []schema.Point
 // this lets the expr package effectively create and drop point slices as needed
 // it is recommended you use the same pool in your application, e.g. to get slices
@@ -12,3 +22,36 @@ var pointSlicePool *sync.Pool
 func Pool(p *sync.Pool) {
 	pointSlicePool = p
 }
+
+// getPoints returns a slice of n points from the pool, for the caller to set.
+func getPoints(n int) []schema.Point {
+	return growPoints(pointSlicePool.Get().([]schema.Point), n)
+}
+
+// growPoints returns the given slice from the pool resized to n points, for the caller to set.
+// if its capacity is insufficient, a large enough slice is allocated instead. the small one is
+// left to the garbage collector, as it would otherwise keep coming back from the pool.
+func growPoints(points []schema.Point, n int) []schema.Point {
+	if cap(points) >= n {
+		return points[:n]
+	}
+	return make([]schema.Point, n)
+}
+
+// getFloats returns a column of n float64 values from the pool, all set to val.
+// it should be returned with putFloats once the caller is done with it.
+func getFloats(n int, val float64) *[]float64 {
+	col := floatSlicePool.Get().(*[]float64)
+	if cap(*col) < n {
+		*col = make([]float64, n)
+	}
+	*col = (*col)[:n]
+	for i := range *col {
+		(*col)[i] = val
+	}
+	return col
+}
+
+func putFloats(col *[]float64) {
+	floatSlicePool.Put(col)
+}
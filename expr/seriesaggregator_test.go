@@ -93,6 +93,266 @@ func TestSeriesAggregateMultiple(t *testing.T) {
 	)
 }
 
+func TestSeriesAggregateMedianStddev(t *testing.T) {
+	input := []models.Series{
+		{
+			QueryPatt:  "a",
+			Datapoints: getCopy(a),
+		},
+		{
+			QueryPatt:  "c",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "d",
+			Datapoints: getCopy(d),
+		},
+	}
+	testSeriesAggregate(
+		"multipleSeries",
+		"median",
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 5.5, Ts: 30},
+			{Val: 15.5, Ts: 40},
+			{Val: 41.5, Ts: 50},
+			{Val: 250, Ts: 60},
+		},
+		t,
+	)
+	testSeriesAggregate(
+		"multipleSeries",
+		"stddev",
+		input[1:],
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 16.5, Ts: 20},
+			{Val: 99, Ts: 30},
+			{Val: 13.5, Ts: 40},
+			{Val: 38.5, Ts: 50},
+			{Val: 123, Ts: 60},
+		},
+		t,
+	)
+}
+
+func TestSeriesAggregateDiffMultiply(t *testing.T) {
+	input := []models.Series{
+		{
+			QueryPatt:  "a",
+			Datapoints: getCopy(a),
+		},
+		{
+			QueryPatt:  "c",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "d",
+			Datapoints: getCopy(d),
+		},
+	}
+	testSeriesAggregate(
+		"multipleSeries",
+		"diff",
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: -33, Ts: 20},
+			{Val: 5.5 - 1 - 199, Ts: 30},
+			{Val: 2 - 29, Ts: 40}, // in accordance with graphite, the first non-null value is the base
+			{Val: 3 - 80, Ts: 50},
+			{Val: 1234567890 - 4 - 250, Ts: 60},
+		},
+		t,
+	)
+	testSeriesAggregate(
+		"multipleSeries",
+		"multiply",
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 5.5 * 199, Ts: 30},
+			{Val: math.NaN(), Ts: 40}, // in accordance with graphite, multiplying with null is null
+			{Val: math.NaN(), Ts: 50},
+			{Val: 1234567890 * 4 * 250, Ts: 60},
+		},
+		t,
+	)
+}
+
+func TestSeriesAggregateCountRangeLast(t *testing.T) {
+	input := []models.Series{
+		{
+			QueryPatt:  "a",
+			Datapoints: getCopy(a),
+		},
+		{
+			QueryPatt:  "c",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "d",
+			Datapoints: getCopy(d),
+		},
+	}
+	testSeriesAggregate(
+		"multipleSeries",
+		"count",
+		input,
+		[]schema.Point{
+			{Val: 3, Ts: 10},
+			{Val: 3, Ts: 20},
+			{Val: 3, Ts: 30},
+			{Val: 2, Ts: 40},
+			{Val: 2, Ts: 50},
+			{Val: 3, Ts: 60},
+		},
+		t,
+	)
+	testSeriesAggregate(
+		"multipleSeries",
+		"range",
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 33, Ts: 20},
+			{Val: 198, Ts: 30},
+			{Val: 27, Ts: 40},
+			{Val: 77, Ts: 50},
+			{Val: 1234567886, Ts: 60},
+		},
+		t,
+	)
+	testSeriesAggregate(
+		"multipleSeries",
+		"last",
+		[]models.Series{input[1], input[0]},
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 5.5, Ts: 30},
+			{Val: 2, Ts: 40}, // in accordance with graphite, the last non-null value is used
+			{Val: 3, Ts: 50},
+			{Val: 1234567890, Ts: 60},
+		},
+		t,
+	)
+}
+
+func TestSeriesAggregatePercentile(t *testing.T) {
+	input := []models.Series{
+		{
+			QueryPatt:  "a",
+			Datapoints: getCopy(a),
+		},
+		{
+			QueryPatt:  "c",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "d",
+			Datapoints: getCopy(d),
+		},
+	}
+	testSeriesPercentile(
+		"p50",
+		50,
+		false,
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 5.5, Ts: 30},
+			{Val: 29, Ts: 40},
+			{Val: 80, Ts: 50},
+			{Val: 250, Ts: 60},
+		},
+		t,
+	)
+	testSeriesPercentile(
+		"p50-interpolated",
+		50,
+		true,
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 0, Ts: 20},
+			{Val: 5.5, Ts: 30},
+			{Val: 15.5, Ts: 40},
+			{Val: 41.5, Ts: 50},
+			{Val: 250, Ts: 60},
+		},
+		t,
+	)
+	testSeriesPercentile(
+		"p90",
+		90,
+		false,
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 33, Ts: 20},
+			{Val: 199, Ts: 30},
+			{Val: 29, Ts: 40},
+			{Val: 80, Ts: 50},
+			{Val: 1234567890, Ts: 60},
+		},
+		t,
+	)
+	testSeriesPercentile(
+		"p100-interpolated",
+		100,
+		true,
+		input,
+		[]schema.Point{
+			{Val: 0, Ts: 10},
+			{Val: 33, Ts: 20},
+			{Val: 199, Ts: 30},
+			{Val: 29, Ts: 40},
+			{Val: 80, Ts: 50},
+			{Val: 1234567890, Ts: 60},
+		},
+		t,
+	)
+}
+
+func TestSeriesAggregatePow(t *testing.T) {
+	f := crossSeriesPow
+	in := []models.Series{
+		{
+			QueryPatt:  "c",
+			Datapoints: getCopy(c),
+		},
+		{
+			QueryPatt:  "a",
+			Datapoints: getCopy(a),
+		},
+	}
+	exp := []schema.Point{
+		{Val: 1, Ts: 10},
+		{Val: 1, Ts: 20},
+		{Val: 1, Ts: 30},
+		{Val: math.NaN(), Ts: 40}, // in accordance with graphite, pow with null is null
+		{Val: math.NaN(), Ts: 50},
+		{Val: math.NaN(), Ts: 60}, // 4^1234567890 overflows, which graphite treats as null
+	}
+	got := make([]schema.Point, 0, len(exp))
+	f(in, &got)
+	if len(got) != len(exp) {
+		t.Fatalf("len output expected %d, got %d", len(exp), len(got))
+	}
+	for j, p := range got {
+		bothNaN := math.IsNaN(p.Val) && math.IsNaN(exp[j].Val)
+		if (bothNaN || p.Val == exp[j].Val) && p.Ts == exp[j].Ts {
+			continue
+		}
+		t.Fatalf("output point %d - expected %v got %v", j, exp[j], p)
+	}
+}
+
 func testSeriesAggregate(name, agg string, in []models.Series, out []schema.Point, t *testing.T) {
 	f := getCrossSeriesAggFunc(agg)
 
@@ -111,6 +371,24 @@ func testSeriesAggregate(name, agg string, in []models.Series, out []schema.Poin
 	}
 }
 
+func testSeriesPercentile(name string, n float64, interpolate bool, in []models.Series, out []schema.Point, t *testing.T) {
+	f := getCrossSeriesPercentileFunc(n, interpolate)
+
+	got := make([]schema.Point, 0, len(out))
+	f(in, &got)
+
+	if len(got) != len(out) {
+		t.Fatalf("case %q: len output expected %d, got %d", name, len(out), len(got))
+	}
+	for j, p := range got {
+		bothNaN := math.IsNaN(p.Val) && math.IsNaN(out[j].Val)
+		if (bothNaN || p.Val == out[j].Val) && p.Ts == out[j].Ts {
+			continue
+		}
+		t.Fatalf("case %q: output point %d - expected %v got %v", name, j, out[j], p)
+	}
+}
+
 func BenchmarkSeriesAggregateAvg10k_100NoNulls(b *testing.B) {
 	benchmarkSeriesAggregate(b, crossSeriesAvg, 100, test.RandFloats10k, test.RandFloats10k)
 }
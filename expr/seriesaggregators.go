@@ -3,6 +3,7 @@ package expr
 // aggregation functions for series of data
 import (
 	"math"
+	"sort"
 
 	"github.com/grafana/metrictank/api/models"
 	"gopkg.in/raintank/schema.v1"
@@ -13,6 +14,16 @@ type seriesAggregator struct {
 	name     string
 }
 
+// isIdentity returns whether aggregating a single series results in that same series,
+// in which case the aggregation can be skipped.
+func (s seriesAggregator) isIdentity() bool {
+	switch s.name {
+	case "avg", "average", "min", "max", "sum", "total", "last", "current", "diff", "multiply", "median", "pow":
+		return true
+	}
+	return false
+}
+
 type crossSeriesAggFunc func(in []models.Series, out *[]schema.Point)
 
 func getCrossSeriesAggFunc(c string) crossSeriesAggFunc {
@@ -23,106 +34,334 @@ func getCrossSeriesAggFunc(c string) crossSeriesAggFunc {
 		return crossSeriesMin
 	case "max":
 		return crossSeriesMax
-	case "sum":
+	case "sum", "total":
 		return crossSeriesSum
+	case "count":
+		return crossSeriesCount
+	case "last", "current":
+		return crossSeriesLast
+	case "range", "rangeOf":
+		return crossSeriesRange
+	case "diff":
+		return crossSeriesDiff
+	case "multiply":
+		return crossSeriesMultiply
+	case "median":
+		return crossSeriesMedian
+	case "stddev":
+		return crossSeriesStddev
 	}
 	return nil
 }
 
+// the aggregation functions process their input one series at a time, accumulating into the output points
+// and into columns of per-point state from the pool (such as the number of non-null values seen), rather than point by point.
+// this way the data is read sequentially, which matters when aggregating many long series.
+// note that the values of every point are still combined in the order of the series, so the results don't change.
+
+// aggOutput returns the output buffer resized for the given input, with the timestamps of the input and all values set to val
+func aggOutput(in []models.Series, out []schema.Point, val float64) []schema.Point {
+	points := growPoints(out, len(in[0].Datapoints))
+	for i, p := range in[0].Datapoints {
+		points[i] = schema.Point{Val: val, Ts: p.Ts}
+	}
+	return points
+}
+
 func crossSeriesAvg(in []models.Series, out *[]schema.Point) {
-	for i := 0; i < len(in[0].Datapoints); i++ {
-		num := 0
-		sum := float64(0)
-		for j := 0; j < len(in); j++ {
-			p := in[j].Datapoints[i].Val
-			if !math.IsNaN(p) {
-				num++
-				sum += p
+	points := aggOutput(in, *out, 0)
+	num := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if !math.IsNaN(p.Val) {
+				(*num)[i]++
+				points[i].Val += p.Val
 			}
 		}
-		point := schema.Point{
-			Ts: in[0].Datapoints[i].Ts,
-		}
-		if num == 0 {
-			point.Val = math.NaN()
+	}
+	for i, n := range *num {
+		if n == 0 {
+			points[i].Val = math.NaN()
 		} else {
-			point.Val = sum / float64(num)
+			points[i].Val /= n
 		}
-
-		*out = append(*out, point)
 	}
+	putFloats(num)
+	*out = points
 }
 
 func crossSeriesMin(in []models.Series, out *[]schema.Point) {
-	for i := 0; i < len(in[0].Datapoints); i++ {
-		nan := true
-		min := math.Inf(1)
-		for j := 0; j < len(in); j++ {
-			p := in[j].Datapoints[i].Val
-			if !math.IsNaN(p) && p < min {
-				nan = false
-				min = p
+	points := aggOutput(in, *out, math.Inf(1))
+	set := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			// comparisons with NaN are false, so null values are skipped
+			if p.Val < points[i].Val {
+				(*set)[i] = 1
+				points[i].Val = p.Val
 			}
 		}
+	}
+	nanUnset(points, *set)
+	putFloats(set)
+	*out = points
+}
 
-		point := schema.Point{
-			Ts: in[0].Datapoints[i].Ts,
+func crossSeriesMax(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, math.Inf(-1))
+	set := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if p.Val > points[i].Val {
+				(*set)[i] = 1
+				points[i].Val = p.Val
+			}
 		}
-		if nan {
-			point.Val = math.NaN()
-		} else {
-			point.Val = min
+	}
+	nanUnset(points, *set)
+	putFloats(set)
+	*out = points
+}
+
+func crossSeriesSum(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 0)
+	set := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if !math.IsNaN(p.Val) {
+				(*set)[i] = 1
+				points[i].Val += p.Val
+			}
 		}
+	}
+	nanUnset(points, *set)
+	putFloats(set)
+	*out = points
+}
 
-		*out = append(*out, point)
+// nanUnset sets the points for which no value was set to null
+func nanUnset(points []schema.Point, set []float64) {
+	for i, s := range set {
+		if s == 0 {
+			points[i].Val = math.NaN()
+		}
 	}
 }
 
-func crossSeriesMax(in []models.Series, out *[]schema.Point) {
-	for i := 0; i < len(in[0].Datapoints); i++ {
-		nan := true
-		max := math.Inf(-1)
-		for j := 0; j < len(in); j++ {
-			p := in[j].Datapoints[i].Val
-			if !math.IsNaN(p) && p > max {
-				nan = false
-				max = p
+// crossSeriesDiff subtracts all values from the first one.
+// in accordance with graphite, the first non-null value is used as the base, and nulls are ignored.
+func crossSeriesDiff(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 0)
+	set := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if math.IsNaN(p.Val) {
+				continue
+			}
+			if (*set)[i] == 0 {
+				(*set)[i] = 1
+				points[i].Val = p.Val
+			} else {
+				points[i].Val -= p.Val
 			}
 		}
+	}
+	nanUnset(points, *set)
+	putFloats(set)
+	*out = points
+}
 
-		point := schema.Point{
-			Ts: in[0].Datapoints[i].Ts,
+// crossSeriesMultiply multiplies all values.
+// in accordance with graphite, if any of the values is null, so is the result.
+func crossSeriesMultiply(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 1)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			points[i].Val *= p.Val
 		}
-		if nan {
-			point.Val = math.NaN()
-		} else {
-			point.Val = max
+	}
+	*out = points
+}
+
+// crossSeriesPow raises the value of the first series to the power of the second, the result of that
+// to the power of the third, and so on.
+// in accordance with graphite, if any of the values is null, so is the result.
+func crossSeriesPow(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 0)
+	for i, p := range in[0].Datapoints {
+		points[i].Val = p.Val
+	}
+	for _, serie := range in[1:] {
+		for i, p := range serie.Datapoints[:len(points)] {
+			points[i].Val = safePow(points[i].Val, p.Val)
 		}
+	}
+	*out = points
+}
 
-		*out = append(*out, point)
+// crossSeriesMedian computes the median of the non-null values.
+// like the percentiles, this needs all values of a point at once, so it goes point by point.
+func crossSeriesMedian(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, math.NaN())
+	col := getFloats(len(in), 0)
+	for i := range points {
+		if vals := sortedValuesAt(in, i, col); len(vals) != 0 {
+			points[i].Val = median(vals)
+		}
 	}
+	putFloats(col)
+	*out = points
 }
 
-func crossSeriesSum(in []models.Series, out *[]schema.Point) {
-	for i := 0; i < len(in[0].Datapoints); i++ {
-		nan := true
-		sum := float64(0)
-		for j := 0; j < len(in); j++ {
-			p := in[j].Datapoints[i].Val
-			if !math.IsNaN(p) {
-				nan = false
-				sum += p
+// crossSeriesStddev computes the population standard deviation of the non-null values
+func crossSeriesStddev(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, math.NaN())
+	col := getFloats(len(in), 0)
+	for i := range points {
+		if vals := sortedValuesAt(in, i, col); len(vals) != 0 {
+			points[i].Val = stddev(vals)
+		}
+	}
+	putFloats(col)
+	*out = points
+}
+
+// crossSeriesCount counts the non-null values
+func crossSeriesCount(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if !math.IsNaN(p.Val) {
+				points[i].Val++
 			}
 		}
-		point := schema.Point{
-			Ts: in[0].Datapoints[i].Ts,
+	}
+	for i := range points {
+		if points[i].Val == 0 {
+			points[i].Val = math.NaN()
 		}
-		if nan {
-			point.Val = math.NaN()
-		} else {
-			point.Val = sum
+	}
+	*out = points
+}
+
+// crossSeriesLen returns the number of series for every point, regardless of null values, like graphite's countSeries
+func crossSeriesLen(in []models.Series, out *[]schema.Point) {
+	*out = aggOutput(in, *out, float64(len(in)))
+}
+
+// crossSeriesLast returns the value of the last series that is not null
+func crossSeriesLast(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, math.NaN())
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if !math.IsNaN(p.Val) {
+				points[i].Val = p.Val
+			}
+		}
+	}
+	*out = points
+}
+
+// crossSeriesRange computes the difference between the highest and the lowest value
+func crossSeriesRange(in []models.Series, out *[]schema.Point) {
+	points := aggOutput(in, *out, 0)
+	min := getFloats(len(points), math.Inf(1))
+	max := getFloats(len(points), math.Inf(-1))
+	set := getFloats(len(points), 0)
+	for _, serie := range in {
+		for i, p := range serie.Datapoints[:len(points)] {
+			if math.IsNaN(p.Val) {
+				continue
+			}
+			(*set)[i] = 1
+			(*min)[i] = math.Min((*min)[i], p.Val)
+			(*max)[i] = math.Max((*max)[i], p.Val)
+		}
+	}
+	for i := range points {
+		points[i].Val = (*max)[i] - (*min)[i]
+	}
+	nanUnset(points, *set)
+	putFloats(min)
+	putFloats(max)
+	putFloats(set)
+	*out = points
+}
+
+// getCrossSeriesPercentileFunc returns a function that computes the n-th percentile of the non-null values.
+// it follows graphite's percentile algorithm, which picks the nearest rank unless interpolate is set,
+// in which case it interpolates linearly between the two nearest ranks.
+func getCrossSeriesPercentileFunc(n float64, interpolate bool) crossSeriesAggFunc {
+	return func(in []models.Series, out *[]schema.Point) {
+		points := aggOutput(in, *out, math.NaN())
+		col := getFloats(len(in), 0)
+		for i := range points {
+			if vals := sortedValuesAt(in, i, col); len(vals) != 0 {
+				points[i].Val = percentile(vals, n, interpolate)
+			}
+		}
+		putFloats(col)
+		*out = points
+	}
+}
+
+// sortedValuesAt returns the sorted non-null values of the series at the given index,
+// using col, which must have room for a value of each series, as storage
+func sortedValuesAt(in []models.Series, i int, col *[]float64) []float64 {
+	vals := (*col)[:0]
+	for _, serie := range in {
+		if p := serie.Datapoints[i].Val; !math.IsNaN(p) {
+			vals = append(vals, p)
 		}
+	}
+	sort.Float64s(vals)
+	return vals
+}
+
+// percentile returns the n-th percentile of the given sorted values, which must not be empty
+func percentile(sorted []float64, n float64, interpolate bool) float64 {
+	fractionalRank := (n / 100) * float64(len(sorted)+1)
+	rank := int(fractionalRank)
+	rankFraction := fractionalRank - float64(rank)
+	if !interpolate {
+		rank += int(math.Ceil(rankFraction))
+	}
 
-		*out = append(*out, point)
+	var val float64
+	switch {
+	case rank == 0:
+		val = sorted[0]
+	case rank-1 >= len(sorted):
+		val = sorted[len(sorted)-1]
+	default:
+		val = sorted[rank-1]
+	}
+
+	if interpolate && rank < len(sorted) {
+		val += rankFraction * (sorted[rank] - val)
+	}
+	return val
+}
+
+// median returns the median of the given sorted values, which must not be empty
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// stddev returns the population standard deviation of the given values, which must not be empty
+func stddev(vals []float64) float64 {
+	avg := float64(0)
+	for _, v := range vals {
+		avg += v
+	}
+	avg /= float64(len(vals))
+	deviations := float64(0)
+	for _, v := range vals {
+		deviations += (v - avg) * (v - avg)
 	}
+	return math.Sqrt(deviations / float64(len(vals)))
 }
@@ -0,0 +1,48 @@
+package expr
+
+// summarization of entire series into a single value, so that series can be compared against each other or against a threshold
+import (
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+)
+
+type summarizedSeries struct {
+	serie models.Series
+	val   float64
+}
+
+// getSeriesSummaryFunc returns the function that summarizes a series into a single value, for the given graphite function name
+// it returns nil if the name is not known
+func getSeriesSummaryFunc(fn string) batch.AggFunc {
+	switch fn {
+	case "avg", "average":
+		return batch.Avg
+	case "count":
+		return batch.Cnt
+	case "current", "last":
+		return batch.Lst
+	case "min":
+		return batch.Min
+	case "max":
+		return batch.Max
+	case "sum", "total":
+		return batch.Sum
+	}
+	return nil
+}
+
+// summarizeSeries reduces each of the given series to a single value by means of fn.
+// series without any points are summarized as NaN, like all-null series are.
+func summarizeSeries(series []models.Series, fn batch.AggFunc) []summarizedSeries {
+	out := make([]summarizedSeries, 0, len(series))
+	for _, serie := range series {
+		val := math.NaN()
+		if len(serie.Datapoints) != 0 {
+			val = fn(serie.Datapoints)
+		}
+		out = append(out, summarizedSeries{serie, val})
+	}
+	return out
+}
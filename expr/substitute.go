@@ -0,0 +1,106 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// substituteOpts are the options for substituting $params, which differ between macros and template()
+type substituteOpts struct {
+	inStrings bool // whether $params are also substituted within strings
+	validate  bool // whether metric patterns must remain valid after substitution
+	strToNum  bool // whether a string that is a whole argument becomes a number if it is one, like in graphite's template()
+}
+
+// substitute returns the expression with the $params replaced by the given values.
+// a $param that makes up a whole argument is replaced by the value as is, so that e.g. strings remain strings.
+// within metric patterns (and strings, if opts.inStrings) it is replaced by the text of the value, e.g. a string without its quotes.
+func (e *expr) substitute(values map[string]*expr, opts substituteOpts) (*expr, error) {
+	switch e.etype {
+	case etName:
+		if strings.HasPrefix(e.str, "$") {
+			if val, ok := values[e.str[1:]]; ok {
+				return val.wholeValue(e.pos, opts), nil
+			}
+		}
+		str := substituteText(e.str, values)
+		if opts.validate {
+			if name, leftover := parseName(str); name != str || leftover != "" {
+				return nil, fmt.Errorf("substituting the arguments into %s results in the invalid metric pattern %q", e.str, str)
+			}
+		}
+		e.str = str
+	case etString:
+		if opts.inStrings {
+			e.str = substituteText(e.str, values)
+		}
+	case etFunc, etList:
+		for i, arg := range e.args {
+			out, err := arg.substitute(values, opts)
+			if err != nil {
+				return nil, err
+			}
+			e.args[i] = out
+		}
+		for key, arg := range e.namedArgs {
+			out, err := arg.substitute(values, opts)
+			if err != nil {
+				return nil, err
+			}
+			e.namedArgs[key] = out
+		}
+		if e.etype == etFunc {
+			e.argsStr = e.argsTarget()
+		} else {
+			items := make([]string, 0, len(e.args))
+			for _, item := range e.args {
+				items = append(items, item.target())
+			}
+			e.str = "[" + strings.Join(items, ",") + "]"
+		}
+	}
+	return e, nil
+}
+
+// substituteText replaces every $param in the given text by the text of the corresponding value
+func substituteText(str string, values map[string]*expr) string {
+	var out strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '$' {
+			out.WriteByte(str[i])
+			continue
+		}
+		j := i + 1
+		for j < len(str) && isParamChar(str[j]) {
+			j++
+		}
+		if val, ok := values[str[i+1:j]]; ok {
+			out.WriteString(val.textValue())
+			i = j - 1
+		} else {
+			out.WriteByte('$')
+		}
+	}
+	return out.String()
+}
+
+// textValue returns the text to substitute for a $param within a metric pattern or string.
+// strings are substituted without their quotes.
+func (e expr) textValue() string {
+	if e.etype == etFunc {
+		return e.target()
+	}
+	return e.str
+}
+
+// wholeValue returns a copy of the expression to use for a $param that is a whole argument at the given position
+func (e *expr) wholeValue(pos int, opts substituteOpts) *expr {
+	out := e.copy()
+	if opts.strToNum && out.etype == etString {
+		if num, leftover, err := parseConst(out.str); num != nil && leftover == "" && err == nil {
+			out = num
+		}
+	}
+	out.pos = pos
+	return out
+}
@@ -0,0 +1,53 @@
+package expr
+
+import "strconv"
+
+// expandTemplate expands a call of template(seriesList, *args, **kwargs) like graphite does:
+// the $name variables in the metric patterns of the series list are replaced by the values of the keyword arguments,
+// and $1, $2, etc by those of the positional arguments. vars override the values given in the call.
+// a variable that is a whole argument, as in movingAverage(foo, $n), is replaced by its value as is,
+// so that it can also be used for arguments that are not series.
+func expandTemplate(call *expr, vars map[string]string) (*expr, error) {
+	if len(call.args) == 0 {
+		return nil, ErrMissingArg
+	}
+	in := call.args[0]
+	if in.etype != etName && in.etype != etFunc {
+		return nil, in.badArg(ArgSeriesList{})
+	}
+	values := make(map[string]*expr, len(call.args)-1+len(call.namedArgs)+len(vars))
+	for i, arg := range call.args[1:] {
+		if !arg.isTemplateValue() {
+			return nil, arg.badTemplateValue()
+		}
+		values[strconv.Itoa(i+1)] = arg
+	}
+	for key, arg := range call.namedArgs {
+		if !arg.isTemplateValue() {
+			return nil, arg.badTemplateValue()
+		}
+		values[key] = arg
+	}
+	for key, val := range vars {
+		values[key] = &expr{etype: etString, str: val}
+	}
+	// like graphite, variables are not substituted within strings, and the resulting patterns are not validated
+	out, err := in.substitute(values, substituteOpts{strToNum: true})
+	if err != nil {
+		return nil, err
+	}
+	out.expanded = "template"
+	return out, nil
+}
+
+func (e expr) isTemplateValue() bool {
+	switch e.etype {
+	case etString, etInt, etFloat, etBool:
+		return true
+	}
+	return false
+}
+
+func (e expr) badTemplateValue() error {
+	return errAt{e.pos, ErrBadArgumentStr{"string, int, float or bool", e.etype.desc()}}
+}
@@ -0,0 +1,42 @@
+package expr
+
+import (
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	cases := []struct {
+		target string
+		vars   map[string]string
+		exp    string // the expanded target, or the expected error
+		err    bool
+	}{
+		{`template(hosts.$hostname.cpu, hostname="worker1")`, nil, "hosts.worker1.cpu", false},
+		{`template(hosts.$1.cpu.$2, 'worker1', 'user')`, nil, "hosts.worker1.cpu.user", false},
+		{`template(hosts.$hostname.cpu, hostname="worker1")`, map[string]string{"hostname": "worker2"}, "hosts.worker2.cpu", false},
+		{`template(hosts.$hostname.cpu)`, map[string]string{"hostname": "worker2"}, "hosts.worker2.cpu", false},
+		{`template(hosts.$hostname.$other)`, map[string]string{"hostname": "worker2"}, "hosts.worker2.$other", false},
+		{`template(movingAverage(hosts.$host.cpu, $n), host='a', n=5)`, nil, "movingAverage(hosts.a.cpu,5)", false},
+		{`template(movingAverage(hosts.$host.cpu, $n), host='a', n=5)`, map[string]string{"n": "10"}, "movingAverage(hosts.a.cpu,10)", false},
+		{`template(summarize(a.$x, $interval, func='sum'), x=1, interval='1h')`, nil, "summarize(a.1,'1h',func='sum')", false},
+		{`sumSeries(template(a.$x, x=1), b)`, nil, "sumSeries(a.1,b)", false},
+		{`template(1, x=1)`, nil, "argument bad type. expected func or name - got int", true},
+		{`template(a.$x, x=b)`, nil, "argument bad type. expected string, int, float or bool - got name", true},
+	}
+	for i, c := range cases {
+		exprs, err := ParseManyTemplate([]string{c.target}, c.vars)
+		if c.err {
+			if et, ok := err.(ErrTarget); !ok || et.Message != c.exp {
+				t.Fatalf("case %d: expected error %q, got %v", i, c.exp, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err)
+		}
+		got := ExpandedTargets(exprs)
+		if len(got) != 1 || got[0] != c.exp {
+			t.Fatalf("case %d: expected %q, got %q", i, c.exp, got)
+		}
+	}
+}
@@ -84,6 +84,7 @@ func (a ArgFloat) Optional() bool { return a.opt }
 type ArgString struct {
 	key       string
 	opt       bool
+	typ       string // graphite's type of the parameter, if more specific than a string, e.g. paramInterval
 	validator []Validator
 	val       *string
 }
@@ -91,6 +92,29 @@ type ArgString struct {
 func (a ArgString) Key() string    { return a.key }
 func (a ArgString) Optional() bool { return a.opt }
 
+// ArgStrings represents one or more strings
+type ArgStrings struct {
+	key       string
+	opt       bool
+	validator []Validator
+	val       *[]string
+}
+
+func (a ArgStrings) Key() string    { return a.key }
+func (a ArgStrings) Optional() bool { return a.opt }
+
+// ArgStringsOrInts represents one or more strings or numbers without decimals, in any mix
+// such as the nodes or tags that aliasByTags takes
+type ArgStringsOrInts struct {
+	key       string
+	opt       bool
+	validator []Validator
+	val       *[]expr
+}
+
+func (a ArgStringsOrInts) Key() string    { return a.key }
+func (a ArgStringsOrInts) Optional() bool { return a.opt }
+
 // like string, but should result in a regex
 type ArgRegex struct {
 	key       string
@@ -111,3 +135,26 @@ type ArgBool struct {
 
 func (a ArgBool) Key() string    { return a.key }
 func (a ArgBool) Optional() bool { return a.opt }
+
+// ArgIn is an argument that can be any one of the given args, e.g. a number or a seriesList.
+// the first arg that accepts the given input will be used.
+// note that a name or func input is always assumed to be a series(List), unless it is None
+type ArgIn struct {
+	key  string
+	opt  bool
+	args []Arg
+}
+
+func (a ArgIn) Key() string    { return a.key }
+func (a ArgIn) Optional() bool { return a.opt }
+
+// seriesArg returns the first series, seriesList or seriesLists arg, if any
+func (a ArgIn) seriesArg() Arg {
+	for _, arg := range a.args {
+		switch arg.(type) {
+		case ArgSeries, ArgSeriesList, ArgSeriesLists:
+			return arg
+		}
+	}
+	return nil
+}
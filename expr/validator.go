@@ -1,8 +1,23 @@
 package expr
 
-import "errors"
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/raintank/dur"
+)
 
 var ErrIntPositive = errors.New("integer must be positive")
+var ErrInvalidSummaryFunc = errors.New("invalid summary function")
+var ErrInvalidOperator = errors.New("invalid operator")
+var ErrInvalidAggFunc = errors.New("invalid aggregation function")
+var ErrInvalidWindowAggFunc = errors.New("invalid window aggregation function")
+var ErrInvalidTimeOffset = errors.New("invalid time offset")
+var ErrInvalidDateTime = errors.New("invalid date/time")
+var ErrInvalidTagExpression = errors.New("invalid tag expression")
+var ErrInvalidInterval = errors.New("invalid interval")
+var ErrInvalidPercent = errors.New("percent must be greater than 0 and at most 100")
 
 // Validator is a function to validate an input
 type Validator func(e *expr) error
@@ -13,3 +28,76 @@ func IntPositive(e *expr) error {
 	}
 	return nil
 }
+
+// IsPercent validates a percentile number, which may be an int or a float
+func IsPercent(e *expr) error {
+	n := e.float
+	if e.etype == etInt {
+		n = float64(e.int)
+	}
+	if n <= 0 || n > 100 {
+		return ErrInvalidPercent
+	}
+	return nil
+}
+
+func IsAggFunc(e *expr) error {
+	if getCrossSeriesAggFunc(e.str) == nil {
+		return ErrInvalidAggFunc
+	}
+	return nil
+}
+
+func IsWindowAggFunc(e *expr) error {
+	if getWindowAggFunc(e.str) == nil {
+		return ErrInvalidWindowAggFunc
+	}
+	return nil
+}
+
+func IsSeriesSummaryFunc(e *expr) error {
+	if getSeriesSummaryFunc(e.str) == nil {
+		return ErrInvalidSummaryFunc
+	}
+	return nil
+}
+
+func IsOperator(e *expr) error {
+	switch e.str {
+	case "=", "!=", ">", ">=", "<", "<=":
+		return nil
+	}
+	return ErrInvalidOperator
+}
+
+func IsTimeOffset(e *expr) error {
+	if _, err := parseTimeOffset(e.str); err != nil {
+		return ErrInvalidTimeOffset
+	}
+	return nil
+}
+
+// IsInterval validates a non-zero duration such as "1d" or "5min"
+func IsInterval(e *expr) error {
+	if _, err := dur.ParseNDuration(e.str); err != nil {
+		return ErrInvalidInterval
+	}
+	return nil
+}
+
+func IsDateTime(e *expr) error {
+	if _, err := dur.ParseDateTime(e.str, time.Local, time.Now(), 0); err != nil {
+		return ErrInvalidDateTime
+	}
+	return nil
+}
+
+// IsTagExpression checks that the string is a tag expression such as "key=value", "key!=value", "key=~regex" or "key!=~regex".
+// the index does the full validation
+func IsTagExpression(e *expr) error {
+	pos := strings.Index(e.str, "=")
+	if pos < 1 || strings.Contains(e.str[:pos], ";") || e.str[:pos] == "!" {
+		return ErrInvalidTagExpression
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package expr
+
+// aggregation functions for windows of points, as used by the moving window functions
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/grafana/metrictank/batch"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// percentileFuncRe matches the names of percentile functions, such as p50 or p99.9
+var percentileFuncRe = regexp.MustCompile(`^p([0-9]+(\.[0-9]+)?)$`)
+
+// getWindowAggFunc returns the function that aggregates a window of points into a single value, for the given graphite function name
+// it returns nil if the name is not known.
+// like in graphite, the functions ignore null values, except for avg_zero which counts them as 0.
+// callers should not call them for windows that only contain nulls.
+func getWindowAggFunc(fn string) batch.AggFunc {
+	switch fn {
+	case "avg", "average":
+		return batch.Avg
+	case "avg_zero":
+		return windowAvgZero
+	case "count":
+		return batch.Cnt
+	case "diff":
+		return windowDiff
+	case "first":
+		return windowFirst
+	case "last", "current":
+		return batch.Lst
+	case "max":
+		return batch.Max
+	case "median":
+		return windowMedian
+	case "min":
+		return batch.Min
+	case "multiply":
+		return windowMultiply
+	case "range", "rangeOf":
+		return windowRange
+	case "stddev":
+		return windowStddev
+	case "sum", "total":
+		return batch.Sum
+	}
+	if m := percentileFuncRe.FindStringSubmatch(fn); m != nil {
+		// the regex assures the percentile is a valid number
+		n, _ := strconv.ParseFloat(m[1], 64)
+		return getWindowPercentileFunc(n)
+	}
+	return nil
+}
+
+// windowAvgZero computes the average of the values, counting null values as 0
+func windowAvgZero(in []schema.Point) float64 {
+	if len(in) == 0 {
+		return math.NaN()
+	}
+	sum := float64(0)
+	for _, p := range in {
+		if !math.IsNaN(p.Val) {
+			sum += p.Val
+		}
+	}
+	return sum / float64(len(in))
+}
+
+// windowFirst returns the first non-null value
+func windowFirst(in []schema.Point) float64 {
+	for _, p := range in {
+		if !math.IsNaN(p.Val) {
+			return p.Val
+		}
+	}
+	return math.NaN()
+}
+
+// getWindowPercentileFunc returns a function that computes the n-th percentile of the non-null values,
+// picking the nearest rank like graphite does.
+func getWindowPercentileFunc(n float64) batch.AggFunc {
+	return func(in []schema.Point) float64 {
+		col := getFloats(len(in), 0)
+		defer putFloats(col)
+		vals := sortedValues(in, col)
+		if len(vals) == 0 {
+			return math.NaN()
+		}
+		return percentile(vals, n, false)
+	}
+}
+
+// windowDiff subtracts all non-null values from the first non-null value
+func windowDiff(in []schema.Point) float64 {
+	nan := true
+	diff := float64(0)
+	for _, p := range in {
+		if math.IsNaN(p.Val) {
+			continue
+		}
+		if nan {
+			nan = false
+			diff = p.Val
+		} else {
+			diff -= p.Val
+		}
+	}
+	if nan {
+		return math.NaN()
+	}
+	return diff
+}
+
+// windowMedian computes the median of the non-null values.
+// it is called for every point of a moving window, so the values are sorted in a column from the pool.
+func windowMedian(in []schema.Point) float64 {
+	col := getFloats(len(in), 0)
+	defer putFloats(col)
+	vals := sortedValues(in, col)
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	return median(vals)
+}
+
+// windowMultiply multiplies all non-null values
+func windowMultiply(in []schema.Point) float64 {
+	nan := true
+	product := float64(1)
+	for _, p := range in {
+		if !math.IsNaN(p.Val) {
+			nan = false
+			product *= p.Val
+		}
+	}
+	if nan {
+		return math.NaN()
+	}
+	return product
+}
+
+func windowRange(in []schema.Point) float64 {
+	return batch.Max(in) - batch.Min(in)
+}
+
+// windowStddev computes the population standard deviation of the non-null values
+func windowStddev(in []schema.Point) float64 {
+	col := getFloats(len(in), 0)
+	defer putFloats(col)
+	vals := sortedValues(in, col)
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	return stddev(vals)
+}
+
+// sortedValues returns the sorted non-null values of the points,
+// using col, which must have room for all of them, as storage
+func sortedValues(in []schema.Point, col *[]float64) []float64 {
+	vals := (*col)[:0]
+	for _, p := range in {
+		if !math.IsNaN(p.Val) {
+			vals = append(vals, p.Val)
+		}
+	}
+	sort.Float64s(vals)
+	return vals
+}
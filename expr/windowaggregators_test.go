@@ -0,0 +1,49 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestWindowAggFuncs(t *testing.T) {
+	nan := math.NaN()
+	in := []schema.Point{
+		{Val: nan, Ts: 10},
+		{Val: 4, Ts: 20},
+		{Val: 1, Ts: 30},
+		{Val: nan, Ts: 40},
+		{Val: 3, Ts: 50},
+		{Val: 2, Ts: 60},
+		{Val: 10, Ts: 70},
+		{Val: nan, Ts: 80},
+	}
+	cases := []struct {
+		fn  string
+		exp float64
+	}{
+		{"avg_zero", 2.5},
+		{"first", 4},
+		{"p0", 1},
+		{"p50", 3},
+		{"p80", 10},
+		{"p99.9", 10},
+		{"p100", 10},
+	}
+	for _, c := range cases {
+		fn := getWindowAggFunc(c.fn)
+		if fn == nil {
+			t.Fatalf("%s: expected a function, got nil", c.fn)
+		}
+		if got := fn(in); got != c.exp {
+			t.Errorf("%s: expected %v, got %v", c.fn, c.exp, got)
+		}
+	}
+
+	for _, name := range []string{"p", "p5x", "p.5", "p-5", "first5", "avg_nonzero"} {
+		if getWindowAggFunc(name) != nil {
+			t.Errorf("%s: expected nil, got a function", name)
+		}
+	}
+}
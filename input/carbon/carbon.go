@@ -1,13 +1,13 @@
-// package carbon provides a traditional carbon input for metrictank
+// package carbon provides a traditional carbon input for metrictank, for the plaintext (over tcp and udp) and pickle protocols
 // note: it does not support the "carbon2.0" protocol that serializes metrics2.0 into a plaintext carbon-like protocol
 package carbon
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"io"
 	"net"
-	"strings"
 	"sync"
 
 	"github.com/grafana/metrictank/cluster"
@@ -19,10 +19,10 @@ import (
 	"gopkg.in/raintank/schema.v1"
 )
 
-// metric input.carbon.metrics_per_message is how many metrics per message were seen. in carbon's case this is always 1.
+// metric input.carbon.metrics_per_message is how many metrics per message were seen. for the plaintext protocol this is always 1, for the pickle protocol it's the number of metrics in a batch.
 var metricsPerMessage = stats.NewMeter32("input.carbon.metrics_per_message", false)
 
-// metric input.carbon.metrics_decode_err is a count of times an input message (MetricData, MetricDataArray or carbon line) failed to parse
+// metric input.carbon.metrics_decode_err is a count of times an input message (MetricData, MetricDataArray, carbon line or pickled batch or metric) failed to parse
 var metricsDecodeErr = stats.NewCounter32("input.carbon.metrics_decode_err")
 
 type Carbon struct {
@@ -30,38 +30,43 @@ type Carbon struct {
 	addrStr          string
 	addr             *net.TCPAddr
 	listener         *net.TCPListener
+	pickleAddr       *net.TCPAddr // nil if the pickle listener is disabled
+	pickleListener   *net.TCPListener
+	udpAddr          *net.UDPAddr // nil if the udp listener is disabled
 	handlerWaitGroup sync.WaitGroup
 	quit             chan struct{}
 	connTrack        *ConnTrack
-	intervalGetter   IntervalGetter
+	intervalGetter   input.IntervalGetter
 }
 
+// ConnTrack tracks the open connections, so they can be closed on shutdown.
+// note that the udp listener is a connection without a remote address.
 type ConnTrack struct {
 	sync.Mutex
-	conns map[string]net.Conn
+	conns map[net.Conn]struct{}
 }
 
 func NewConnTrack() *ConnTrack {
 	return &ConnTrack{
-		conns: make(map[string]net.Conn),
+		conns: make(map[net.Conn]struct{}),
 	}
 }
 
 func (c *ConnTrack) Add(conn net.Conn) {
 	c.Lock()
-	c.conns[conn.RemoteAddr().String()] = conn
+	c.conns[conn] = struct{}{}
 	c.Unlock()
 }
 
 func (c *ConnTrack) Remove(conn net.Conn) {
 	c.Lock()
-	delete(c.conns, conn.RemoteAddr().String())
+	delete(c.conns, conn)
 	c.Unlock()
 }
 
 func (c *ConnTrack) CloseAll() {
 	c.Lock()
-	for _, conn := range c.conns {
+	for conn := range c.conns {
 		conn.Close()
 	}
 	c.Unlock()
@@ -73,12 +78,16 @@ func (c *Carbon) Name() string {
 
 var Enabled bool
 var addr string
+var pickleAddr string
+var udpAddr string
 var partitionId int
 
 func ConfigSetup() {
 	inCarbon := flag.NewFlagSet("carbon-in", flag.ExitOnError)
 	inCarbon.BoolVar(&Enabled, "enabled", false, "")
 	inCarbon.StringVar(&addr, "addr", ":2003", "tcp listen address")
+	inCarbon.StringVar(&pickleAddr, "pickle-addr", "", "tcp listen address for the pickle protocol, e.g. :2004. empty to disable")
+	inCarbon.StringVar(&udpAddr, "udp-addr", "", "udp listen address for the plaintext protocol, e.g. :2003. empty to disable")
 	inCarbon.IntVar(&partitionId, "partition", 0, "partition Id.")
 	globalconf.Register("carbon-in", inCarbon)
 }
@@ -95,14 +104,27 @@ func New() *Carbon {
 	if err != nil {
 		log.Fatal(4, "carbon-in: %s", err.Error())
 	}
-	return &Carbon{
+	c := &Carbon{
 		addrStr:   addr,
 		addr:      addrT,
 		connTrack: NewConnTrack(),
 	}
+	if pickleAddr != "" {
+		c.pickleAddr, err = net.ResolveTCPAddr("tcp", pickleAddr)
+		if err != nil {
+			log.Fatal(4, "carbon-in: %s", err.Error())
+		}
+	}
+	if udpAddr != "" {
+		c.udpAddr, err = net.ResolveUDPAddr("udp", udpAddr)
+		if err != nil {
+			log.Fatal(4, "carbon-in: %s", err.Error())
+		}
+	}
+	return c
 }
 
-func (c *Carbon) IntervalGetter(i IntervalGetter) {
+func (c *Carbon) IntervalGetter(i input.IntervalGetter) {
 	c.intervalGetter = i
 }
 
@@ -115,7 +137,28 @@ func (c *Carbon) Start(handler input.Handler) {
 	c.listener = l
 	log.Info("carbon-in: listening on %v/tcp", c.addr)
 	c.quit = make(chan struct{})
-	go c.accept()
+	go c.accept(c.listener, c.handle)
+
+	if c.pickleAddr != nil {
+		l, err := net.ListenTCP("tcp", c.pickleAddr)
+		if nil != err {
+			log.Fatal(4, "carbon-in: %s", err.Error())
+		}
+		c.pickleListener = l
+		log.Info("carbon-in: listening on %v/tcp for the pickle protocol", c.pickleAddr)
+		go c.accept(c.pickleListener, c.handlePickle)
+	}
+
+	if c.udpAddr != nil {
+		conn, err := net.ListenUDP("udp", c.udpAddr)
+		if nil != err {
+			log.Fatal(4, "carbon-in: %s", err.Error())
+		}
+		log.Info("carbon-in: listening on %v/udp", c.udpAddr)
+		c.handlerWaitGroup.Add(1)
+		c.connTrack.Add(conn)
+		go c.handleUDP(conn)
+	}
 }
 
 // MaintainPriority is very simplistic for carbon. there is no backfill,
@@ -124,9 +167,9 @@ func (c *Carbon) MaintainPriority() {
 	cluster.Manager.SetPriority(0)
 }
 
-func (c *Carbon) accept() {
+func (c *Carbon) accept(listener *net.TCPListener, handle func(net.Conn)) {
 	for {
-		conn, err := c.listener.AcceptTCP()
+		conn, err := listener.AcceptTCP()
 		if nil != err {
 			select {
 			case <-c.quit:
@@ -139,7 +182,7 @@ func (c *Carbon) accept() {
 		}
 		c.handlerWaitGroup.Add(1)
 		c.connTrack.Add(conn)
-		go c.handle(conn)
+		go handle(conn)
 	}
 }
 
@@ -147,6 +190,9 @@ func (c *Carbon) Stop() {
 	log.Info("carbon-in: shutting down.")
 	close(c.quit)
 	c.listener.Close()
+	if c.pickleListener != nil {
+		c.pickleListener.Close()
+	}
 	c.connTrack.CloseAll()
 	c.handlerWaitGroup.Wait()
 }
@@ -155,6 +201,7 @@ func (c *Carbon) handle(conn net.Conn) {
 	defer func() {
 		conn.Close()
 		c.connTrack.Remove(conn)
+		c.handlerWaitGroup.Done()
 	}()
 	// TODO c.SetTimeout(60e9)
 	r := bufio.NewReaderSize(conn, 4096)
@@ -175,28 +222,71 @@ func (c *Carbon) handle(conn net.Conn) {
 			break
 		}
 
-		// no validation for m2.0 to provide a grace period in adopting new clients
-		key, val, ts, err := carbon20.ValidatePacket(buf, carbon20.MediumLegacy, carbon20.NoneM20)
+		c.processLine(buf)
+	}
+}
+
+// handleUDP handles the datagrams sent to the udp listener, each of which may have multiple lines of the plaintext protocol
+func (c *Carbon) handleUDP(conn *net.UDPConn) {
+	defer func() {
+		conn.Close()
+		c.connTrack.Remove(conn)
+		c.handlerWaitGroup.Done()
+	}()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
 		if err != nil {
-			metricsDecodeErr.Inc()
-			log.Error(4, "carbon-in: invalid metric: %s", err.Error())
-			continue
+			select {
+			case <-c.quit:
+				// we are shutting down.
+			default:
+				log.Error(4, "carbon-in: Recv error: %s", err.Error())
+			}
+			break
 		}
-		nameSplits := strings.Split(string(key), ";")
-		md := &schema.MetricData{
-			Name:     nameSplits[0],
-			Metric:   nameSplits[0],
-			Interval: c.intervalGetter.GetInterval(nameSplits[0]),
-			Value:    val,
-			Unit:     "unknown",
-			Time:     int64(ts),
-			Mtype:    "gauge",
-			Tags:     nameSplits[1:],
-			OrgId:    1, // admin org
+		for _, line := range bytes.Split(buf[:n], []byte{'\n'}) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			c.processLine(line)
 		}
-		md.SetId()
-		metricsPerMessage.ValueUint32(1)
-		c.Handler.Process(md, int32(partitionId))
 	}
-	c.handlerWaitGroup.Done()
+}
+
+// processLine processes a line of the plaintext protocol
+func (c *Carbon) processLine(buf []byte) {
+	// no validation for m2.0 to provide a grace period in adopting new clients
+	key, val, ts, err := carbon20.ValidatePacket(buf, carbon20.MediumLegacy, carbon20.NoneM20)
+	if err != nil {
+		metricsDecodeErr.Inc()
+		log.Error(4, "carbon-in: invalid metric: %s", err.Error())
+		return
+	}
+	metricsPerMessage.ValueUint32(1)
+	c.process(string(key), val, ts)
+}
+
+// process hands the metric with the given key, which may have tags in the graphite format, to the handler
+func (c *Carbon) process(key string, val float64, ts uint32) {
+	name, tags, err := parseName(key)
+	if err != nil {
+		metricsDecodeErr.Inc()
+		log.Error(4, "carbon-in: invalid metric name %q: %s", key, err.Error())
+		return
+	}
+	md := &schema.MetricData{
+		Name:     name,
+		Metric:   name,
+		Interval: c.intervalGetter.GetInterval(nameWithTags(name, tags)),
+		Value:    val,
+		Unit:     "unknown",
+		Time:     int64(ts),
+		Mtype:    "gauge",
+		Tags:     tags,
+		OrgId:    1, // admin org
+	}
+	md.SetId()
+	c.Handler.Process(md, int32(partitionId))
 }
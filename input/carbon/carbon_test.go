@@ -0,0 +1,168 @@
+package carbon
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pickle "github.com/kisielk/og-rek"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type mockHandler struct {
+	sync.Mutex
+	metrics []schema.MetricData
+}
+
+func (m *mockHandler) Process(metric *schema.MetricData, partition int32) {
+	m.Lock()
+	m.metrics = append(m.metrics, *metric)
+	m.Unlock()
+}
+
+func (m *mockHandler) count() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.metrics)
+}
+
+type fixedIntervalGetter int
+
+func (f fixedIntervalGetter) GetInterval(name string) int {
+	return int(f)
+}
+
+func newTestCarbon(handler *mockHandler) *Carbon {
+	return &Carbon{
+		Handler:        handler,
+		quit:           make(chan struct{}),
+		connTrack:      NewConnTrack(),
+		intervalGetter: fixedIntervalGetter(10),
+	}
+}
+
+func metricData(key string, val float64, ts int64) schema.MetricData {
+	name, tags, _ := parseName(key)
+	md := schema.MetricData{
+		Name:     name,
+		Metric:   name,
+		Interval: 10,
+		Value:    val,
+		Unit:     "unknown",
+		Time:     ts,
+		Mtype:    "gauge",
+		Tags:     tags,
+		OrgId:    1,
+	}
+	md.SetId()
+	return md
+}
+
+// pickled by python with pickle.dumps([('cpu.load;host=a', (1500000000, 1.5)), (u'.mem.free', (1500000010.5, 7)), ('bad', ('x', 1))], protocol=2)
+var pickledBatch = []byte("\x80\x02]q\x00(X\x0f\x00\x00\x00cpu.load;host=aq\x01J\x00/hYG?\xf8\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\t\x00\x00\x00.mem.freeq\x04GA\xd6Z\x0b\xc2\xa0\x00\x00K\x07\x86q\x05\x86q\x06X\x03\x00\x00\x00badq\x07X\x01\x00\x00\x00xq\x08K\x01\x86q\t\x86q\ne.")
+
+func TestHandlePickle(t *testing.T) {
+	handler := &mockHandler{}
+	c := newTestCarbon(handler)
+	client, server := net.Pipe()
+	c.handlerWaitGroup.Add(1)
+	c.connTrack.Add(server)
+	go c.handlePickle(server)
+
+	var header [4]byte
+	for _, batch := range [][]byte{pickledBatch, []byte("not a pickle"), pickledBatch} {
+		binary.BigEndian.PutUint32(header[:], uint32(len(batch)))
+		client.Write(header[:])
+		client.Write(batch)
+	}
+	client.Close()
+	c.handlerWaitGroup.Wait()
+
+	exp := []schema.MetricData{
+		metricData("cpu.load;host=a", 1.5, 1500000000),
+		metricData("mem.free", 7, 1500000010),
+		metricData("cpu.load;host=a", 1.5, 1500000000),
+		metricData("mem.free", 7, 1500000010),
+	}
+	if !reflect.DeepEqual(handler.metrics, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, handler.metrics)
+	}
+	c.connTrack.Lock()
+	defer c.connTrack.Unlock()
+	if len(c.connTrack.conns) != 0 {
+		t.Fatalf("expected the connection to be untracked, got %d tracked connections", len(c.connTrack.conns))
+	}
+}
+
+func TestHandlePickleTooLarge(t *testing.T) {
+	handler := &mockHandler{}
+	c := newTestCarbon(handler)
+	client, server := net.Pipe()
+	c.handlerWaitGroup.Add(1)
+	go c.handlePickle(server)
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], maxPickleSize+1)
+	client.Write(header[:])
+	// the connection is closed without reading the batch
+	c.handlerWaitGroup.Wait()
+	if _, err := client.Write([]byte{0}); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestDecodePickleMetricInvalid(t *testing.T) {
+	cases := []interface{}{
+		pickle.Tuple{"cpu\x00load", pickle.Tuple{int64(1500000000), 1.5}},
+		pickle.Tuple{"cpu.lo\xe9d", pickle.Tuple{int64(1500000000), 1.5}},
+		pickle.Tuple{"cpu.load", pickle.Tuple{math.NaN(), 1.5}},
+		pickle.Tuple{"cpu.load", pickle.Tuple{float64(1 << 32), 1.5}},
+		pickle.Tuple{"cpu.load", pickle.Tuple{int64(-1), 1.5}},
+	}
+	for i, item := range cases {
+		if m, err := decodePickleMetric(item); err == nil {
+			t.Fatalf("case %d: expected an error, got %+v", i, m)
+		}
+	}
+}
+
+func TestHandleUDP(t *testing.T) {
+	handler := &mockHandler{}
+	c := newTestCarbon(handler)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handlerWaitGroup.Add(1)
+	c.connTrack.Add(conn)
+	go c.handleUDP(conn)
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("cpu.load;host=a 1.5 1500000000\ninvalid\r\n\nmem.free 7 1500000010\n"))
+	client.Write([]byte("disk.used 3 1500000020"))
+
+	// datagrams are processed in order, so once the last one arrived, we can stop
+	for i := 0; i < 1000 && handler.count() < 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	close(c.quit)
+	c.connTrack.CloseAll()
+	c.handlerWaitGroup.Wait()
+
+	exp := []schema.MetricData{
+		metricData("cpu.load;host=a", 1.5, 1500000000),
+		metricData("mem.free", 7, 1500000010),
+		metricData("disk.used", 3, 1500000020),
+	}
+	if !reflect.DeepEqual(handler.metrics, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, handler.metrics)
+	}
+}
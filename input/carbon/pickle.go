@@ -0,0 +1,185 @@
+package carbon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+
+	pickle "github.com/kisielk/og-rek"
+	"github.com/metrics20/go-metrics20/carbon20"
+	"github.com/raintank/worldping-api/pkg/log"
+)
+
+// maxPickleSize is the maximum size of a pickled batch, like in carbon
+const maxPickleSize = 1 << 20
+
+var errBatchNotList = errors.New("pickled batch is not a list")
+
+// pickleMetric is a metric of a pickled batch
+type pickleMetric struct {
+	key string
+	val float64
+	ts  uint32
+}
+
+// handlePickle handles a connection of the pickle protocol, on which every batch of metrics is pickled
+// and prefixed with its length as 4 byte big endian integer.
+func (c *Carbon) handlePickle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		c.connTrack.Remove(conn)
+		c.handlerWaitGroup.Done()
+	}()
+	r := bufio.NewReaderSize(conn, 4096)
+	var header [4]byte
+	var buf []byte
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == nil {
+			size := binary.BigEndian.Uint32(header[:])
+			if size > maxPickleSize {
+				// we can't skip the batch safely, so we drop the connection
+				metricsDecodeErr.Inc()
+				log.Error(4, "carbon-in: pickled batch of %d bytes exceeds the maximum of %d bytes. closing connection", size, maxPickleSize)
+				break
+			}
+			if cap(buf) < int(size) {
+				buf = make([]byte, size)
+			}
+			buf = buf[:size]
+			_, err = io.ReadFull(r, buf)
+		}
+		if err != nil {
+			select {
+			case <-c.quit:
+				// we are shutting down.
+			default:
+				if io.EOF != err {
+					log.Error(4, "carbon-in: Recv error: %s", err.Error())
+				}
+			}
+			break
+		}
+
+		metrics, err := decodePickle(buf)
+		if err != nil {
+			metricsDecodeErr.Inc()
+			log.Error(4, "carbon-in: invalid pickled batch: %s", err.Error())
+			continue
+		}
+		metricsPerMessage.ValueUint32(uint32(len(metrics)))
+		for _, m := range metrics {
+			c.process(m.key, m.val, m.ts)
+		}
+	}
+}
+
+// decodePickle decodes a pickled batch of metrics, a list of (path, (timestamp, value)) tuples.
+// like carbon, metrics that are invalid are skipped, in which case the decode error stat is incremented.
+func decodePickle(buf []byte) ([]pickleMetric, error) {
+	decoded, err := pickle.NewDecoder(bytes.NewReader(buf)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	items, ok := decoded.([]interface{})
+	if !ok {
+		return nil, errBatchNotList
+	}
+	metrics := make([]pickleMetric, 0, len(items))
+	for _, item := range items {
+		m, err := decodePickleMetric(item)
+		if err != nil {
+			metricsDecodeErr.Inc()
+			log.Error(4, "carbon-in: invalid pickled metric: %s", err.Error())
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func decodePickleMetric(item interface{}) (pickleMetric, error) {
+	var m pickleMetric
+	fields, ok := pair(item)
+	if !ok {
+		return m, fmt.Errorf("expected a (path, (timestamp, value)) tuple, got %v", item)
+	}
+	key, ok := fields[0].(string)
+	if !ok {
+		return m, fmt.Errorf("expected a string as path, got %v", fields[0])
+	}
+	// graphite ignores a leading dot, see carbon20.ValidatePacket
+	if len(key) != 0 && key[0] == '.' {
+		key = key[1:]
+	}
+	if err := validateKey(key); err != nil {
+		return m, fmt.Errorf("invalid path %q: %s", key, err)
+	}
+	m.key = key
+	point, ok := pair(fields[1])
+	if !ok {
+		return m, fmt.Errorf("expected a (timestamp, value) tuple for %s, got %v", key, fields[1])
+	}
+	ts, err := toFloat(point[0])
+	if err != nil || !(ts >= 0 && ts < 1<<32) {
+		return m, fmt.Errorf("invalid timestamp %v for %s", point[0], key)
+	}
+	m.ts = uint32(ts)
+	m.val, err = toFloat(point[1])
+	if err != nil {
+		return m, fmt.Errorf("invalid value %v for %s", point[1], key)
+	}
+	return m, nil
+}
+
+// validateKey validates the key of a pickled metric the same way carbon20.ValidatePacket validates
+// the key of a line of the plaintext protocol, see processLine
+func validateKey(key string) error {
+	switch carbon20.GetVersion(key) {
+	case carbon20.Legacy:
+		return carbon20.ValidateKeyLegacy(key, carbon20.MediumLegacy)
+	case carbon20.M20:
+		return carbon20.ValidateKeyM20(key, carbon20.NoneM20)
+	default:
+		return carbon20.ValidateKeyM20NoEquals(key, carbon20.NoneM20)
+	}
+}
+
+// pair returns the elements of a tuple or list of 2 elements
+func pair(v interface{}) ([]interface{}, bool) {
+	var elements []interface{}
+	switch v := v.(type) {
+	case pickle.Tuple:
+		elements = v
+	case []interface{}:
+		elements = v
+	}
+	return elements, len(elements) == 2
+}
+
+// toFloat converts a number, or a string of one, to a float, like python's float()
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
@@ -0,0 +1,48 @@
+package carbon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/metrictank/input"
+)
+
+var errEmptyName = errors.New("empty metric name")
+
+// parseName parses a metric key in the graphite 1.1 tagged format, e.g. "cpu.load;host=a;dc=x",
+// into the name and the tags, sorted, like in graphite.
+// the tags are validated like in graphite, see input.ValidateTag, and may not be given more than once.
+func parseName(key string) (string, []string, error) {
+	splits := strings.Split(key, ";")
+	name := splits[0]
+	if name == "" {
+		return "", nil, errEmptyName
+	}
+	if len(splits) == 1 {
+		return name, nil, nil
+	}
+	tags := splits[1:]
+	for _, tag := range tags {
+		pos := strings.IndexByte(tag, '=')
+		if pos == -1 {
+			return "", nil, fmt.Errorf("tag %q has no value", tag)
+		}
+		if err := input.ValidateTag(tag[:pos], tag[pos+1:]); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := input.SortTags(tags); err != nil {
+		return "", nil, err
+	}
+	return name, tags, nil
+}
+
+// nameWithTags returns the name with the given sorted tags in the graphite format,
+// which is how the index refers to the series.
+func nameWithTags(name string, tags []string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	return name + ";" + strings.Join(tags, ";")
+}
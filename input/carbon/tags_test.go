@@ -0,0 +1,40 @@
+package carbon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseName(t *testing.T) {
+	cases := []struct {
+		key  string
+		name string
+		tags []string
+		err  bool
+	}{
+		{"cpu.load", "cpu.load", nil, false},
+		{"cpu.load;host=a;dc=x", "cpu.load", []string{"dc=x", "host=a"}, false},
+		{"cpu.load;url=http://a/b?c=d", "cpu.load", []string{"url=http://a/b?c=d"}, false},
+		{"cpu.load;host=a;host0=b", "cpu.load", []string{"host0=b", "host=a"}, false},
+		{";host=a", "", nil, true},
+		{"cpu.load;", "", nil, true},
+		{"cpu.load;host", "", nil, true},
+		{"cpu.load;=a", "", nil, true},
+		{"cpu.load;host=", "", nil, true},
+		{"cpu.load;ho!st=a", "", nil, true},
+		{"cpu.load;ho^st=a", "", nil, true},
+		{"cpu.load;host=~a", "", nil, true},
+		{"cpu.load;name=a", "", nil, true},
+		{"cpu.load;host=a;dc=x;host=b", "", nil, true},
+	}
+	for _, c := range cases {
+		name, tags, err := parseName(c.key)
+		if (err != nil) != c.err {
+			t.Errorf("key %q: expected error %t, got %v", c.key, c.err, err)
+			continue
+		}
+		if name != c.name || !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("key %q: expected %q %v, got %q %v", c.key, c.name, c.tags, name, tags)
+		}
+	}
+}
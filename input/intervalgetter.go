@@ -1,12 +1,14 @@
-package carbon
+package input
 
 import (
+	"strings"
+
 	"github.com/grafana/metrictank/idx"
 	"github.com/grafana/metrictank/mdata"
 )
 
 //IntervalGetter is anything that can return the interval for the given path
-//we don't want the carbon plugin to directly talk to an index because the api
+//we don't want input plugins such as carbon to directly talk to an index because the api
 //surface is too big and it would couple too tightly which is annoying in unit tests
 type IntervalGetter interface {
 	GetInterval(name string) int
@@ -20,6 +22,9 @@ func NewIndexIntervalGetter(idx idx.MetricIndex) IntervalGetter {
 	return IndexIntervalGetter{idx}
 }
 
+// GetInterval returns the interval of the series with the given name, which may have tags in the graphite format,
+// e.g. "cpu.load;dc=x;host=a", with the tags sorted like the index does.
+// the storage-schemas are matched against the name without tags.
 func (i IndexIntervalGetter) GetInterval(name string) int {
 	archives := i.idx.GetPath(1, name)
 	for _, a := range archives {
@@ -29,6 +34,9 @@ func (i IndexIntervalGetter) GetInterval(name string) int {
 	}
 	// if it's the first time we're seeing this series, do the more expensive matching
 	// note that the index will also do this matching again first time it sees the metric
+	if pos := strings.IndexByte(name, ';'); pos != -1 {
+		name = name[:pos]
+	}
 	_, schema := mdata.MatchSchema(name, 0)
 	return schema.Retentions[0].SecondsPerPoint
 }
@@ -0,0 +1,237 @@
+// package prometheus provides an input for the prometheus remote_write protocol
+package prometheus
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/input"
+	"github.com/grafana/metrictank/prompb"
+	"github.com/grafana/metrictank/stats"
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/rakyll/globalconf"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// metric input.prometheus.metrics_per_message is how many metrics (samples) per remote_write request were seen
+var metricsPerMessage = stats.NewMeter32("input.prometheus.metrics_per_message", false)
+
+// metric input.prometheus.metrics_decode_err is a count of times a remote_write request failed to decode
+var metricsDecodeErr = stats.NewCounter32("input.prometheus.metrics_decode_err")
+
+// metric input.prometheus.series_invalid is a count of times a series of a remote_write request could not be converted into metrics, due to its labels
+var seriesInvalid = stats.NewCounter32("input.prometheus.series_invalid")
+
+// fixedIntervalGetter returns the same interval for every name
+type fixedIntervalGetter int
+
+func (f fixedIntervalGetter) GetInterval(name string) int {
+	return int(f)
+}
+
+type Prometheus struct {
+	input.Handler
+	addr           string
+	server         *http.Server
+	intervalGetter input.IntervalGetter
+	maxRequestSize int // in bytes, after decompression
+}
+
+func (p *Prometheus) Name() string {
+	return "prometheus"
+}
+
+var Enabled bool
+var addr string
+var partitionId int
+var interval int
+var maxRequestSize int
+
+func ConfigSetup() {
+	inPrometheus := flag.NewFlagSet("prometheus-in", flag.ExitOnError)
+	inPrometheus.BoolVar(&Enabled, "enabled", false, "")
+	inPrometheus.StringVar(&addr, "addr", ":9201", "http listen address. prometheus should remote_write to http://<addr>/write")
+	inPrometheus.IntVar(&partitionId, "partition", 0, "partition Id.")
+	inPrometheus.IntVar(&interval, "interval", 0, "interval of all series in seconds. 0 means the interval is determined by the storage-schemas, like for carbon")
+	inPrometheus.IntVar(&maxRequestSize, "max-request-size", 32*1024*1024, "maximum size in bytes of a remote_write request, after decompression. larger requests are rejected")
+	globalconf.Register("prometheus-in", inPrometheus)
+}
+
+func ConfigProcess() {
+	if !Enabled {
+		return
+	}
+	if interval < 0 {
+		log.Fatal(4, "prometheus-in: interval must not be negative")
+	}
+	if maxRequestSize <= 0 {
+		log.Fatal(4, "prometheus-in: max-request-size must be positive")
+	}
+	cluster.Manager.SetPartitions([]int32{int32(partitionId)})
+}
+
+func New() *Prometheus {
+	p := &Prometheus{
+		addr:           addr,
+		maxRequestSize: maxRequestSize,
+	}
+	if interval > 0 {
+		p.intervalGetter = fixedIntervalGetter(interval)
+	}
+	return p
+}
+
+// IntervalGetter sets how the interval of the series is determined, unless a fixed interval is configured.
+// the interval is looked up by the name of the series, with its sorted tags in the graphite format.
+func (p *Prometheus) IntervalGetter(i input.IntervalGetter) {
+	if interval > 0 {
+		return
+	}
+	p.intervalGetter = i
+}
+
+func (p *Prometheus) Start(handler input.Handler) {
+	p.Handler = handler
+	l, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		log.Fatal(4, "prometheus-in: %s", err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/write", p.write)
+	p.server = &http.Server{Handler: mux}
+	log.Info("prometheus-in: listening on %v/tcp", l.Addr())
+	go func() {
+		err := p.server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error(4, "prometheus-in: %s", err.Error())
+		}
+	}()
+}
+
+// MaintainPriority is very simplistic for prometheus. there is no backfill,
+// so mark as ready immediately.
+func (p *Prometheus) MaintainPriority() {
+	cluster.Manager.SetPriority(0)
+}
+
+func (p *Prometheus) Stop() {
+	log.Info("prometheus-in: shutting down.")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.server.Shutdown(ctx); err != nil {
+		log.Error(4, "prometheus-in: shutdown error: %s", err.Error())
+	}
+}
+
+// write handles a remote_write request
+func (p *Prometheus) write(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// the body is limited before it is read, and its decompressed size before it is decompressed
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(prompb.MaxEncodedLen(p.maxRequestSize))))
+	if err != nil {
+		log.Error(4, "prometheus-in: Recv error: %s", err.Error())
+		status := http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	req, err := prompb.DecodeWriteRequest(body, p.maxRequestSize)
+	if err != nil {
+		metricsDecodeErr.Inc()
+		log.Error(4, "prometheus-in: invalid write request: %s", err.Error())
+		status := http.StatusBadRequest
+		if _, ok := err.(prompb.ErrTooLarge); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	num := 0
+	for _, ts := range req.Timeseries {
+		num += len(ts.Samples)
+	}
+	metricsPerMessage.ValueUint32(uint32(num))
+	for _, ts := range req.Timeseries {
+		p.process(ts)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// process hands a metric for every sample of the series to the handler.
+// NaN values, such as prometheus' staleness markers, are skipped since they can't be stored.
+func (p *Prometheus) process(ts prompb.TimeSeries) {
+	name, tags, err := nameAndTags(ts.Labels)
+	if err != nil {
+		seriesInvalid.Inc()
+		log.Debug("prometheus-in: invalid series: %s", err.Error())
+		return
+	}
+	var md *schema.MetricData
+	for _, sample := range ts.Samples {
+		if math.IsNaN(sample.Value) {
+			continue
+		}
+		if md == nil {
+			md = &schema.MetricData{
+				Name:     name,
+				Metric:   name,
+				Interval: p.intervalGetter.GetInterval(strings.Join(append([]string{name}, tags...), ";")),
+				Unit:     "unknown",
+				Mtype:    "gauge",
+				Tags:     tags,
+				OrgId:    1, // admin org
+			}
+			md.SetId()
+		}
+		// the handler may hold on to the metric, so we give it a copy
+		m := *md
+		m.Value = sample.Value
+		m.Time = sample.Timestamp / 1000
+		p.Handler.Process(&m, int32(partitionId))
+	}
+}
+
+// nameAndTags returns the name and the sorted tags of a series with the given labels.
+// the labels are validated like the tags of the carbon input, see input.ValidateTag,
+// so the name label, which the tag index uses for the name of a series, is reserved.
+func nameAndTags(labels []prompb.Label) (string, []string, error) {
+	var name string
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		switch {
+		case l.Name == "__name__":
+			name = l.Value
+		case l.Value == "":
+			// like in prometheus, an empty label is the same as a missing one
+		default:
+			if err := input.ValidateTag(l.Name, l.Value); err != nil {
+				return "", nil, err
+			}
+			tags = append(tags, l.Name+"="+l.Value)
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("series without __name__ label")
+	}
+	if strings.IndexByte(name, ';') != -1 {
+		return "", nil, fmt.Errorf("name %q must not contain ;", name)
+	}
+	if err := input.SortTags(tags); err != nil {
+		return "", nil, err
+	}
+	return name, tags, nil
+}
@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/prompb"
+	"gopkg.in/raintank/schema.v1"
+)
+
+type mockHandler struct {
+	metrics    []schema.MetricData
+	partitions []int32
+}
+
+func (m *mockHandler) Process(metric *schema.MetricData, partition int32) {
+	m.metrics = append(m.metrics, *metric)
+	m.partitions = append(m.partitions, partition)
+}
+
+func TestWrite(t *testing.T) {
+	partitionId = 3
+	defer func() { partitionId = 0 }()
+	handler := &mockHandler{}
+	p := &Prometheus{Handler: handler, intervalGetter: fixedIntervalGetter(15), maxRequestSize: 1024}
+
+	body := prompb.EncodeWriteRequest(prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []prompb.Label{
+					{Name: "job", Value: "api"},
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "code", Value: "200"},
+					{Name: "instance", Value: ""},
+				},
+				Samples: []prompb.Sample{{Value: 10, Timestamp: 1500000000500}, {Value: 12, Timestamp: 1500000015000}},
+			},
+			{
+				// invalid: the name label is reserved
+				Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "name", Value: "x"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1500000000000}},
+			},
+			{
+				// invalid: no name
+				Labels:  []prompb.Label{{Name: "job", Value: "api"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1500000000000}},
+			},
+		},
+	})
+	w := httptest.NewRecorder()
+	p.write(w, httptest.NewRequest("POST", "/write", bytes.NewReader(body)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	md := schema.MetricData{
+		OrgId:    1,
+		Name:     "http_requests_total",
+		Metric:   "http_requests_total",
+		Interval: 15,
+		Unit:     "unknown",
+		Mtype:    "gauge",
+		Tags:     []string{"code=200", "job=api"},
+	}
+	md.SetId()
+	first, second := md, md
+	first.Value, first.Time = 10, 1500000000
+	second.Value, second.Time = 12, 1500000015
+	if exp := []schema.MetricData{first, second}; !reflect.DeepEqual(handler.metrics, exp) {
+		t.Fatalf("expected metrics %+v, got %+v", exp, handler.metrics)
+	}
+	if exp := []int32{3, 3}; !reflect.DeepEqual(handler.partitions, exp) {
+		t.Fatalf("expected partitions %v, got %v", exp, handler.partitions)
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	p := &Prometheus{Handler: &mockHandler{}, intervalGetter: fixedIntervalGetter(15), maxRequestSize: 1024}
+	w := httptest.NewRecorder()
+	p.write(w, httptest.NewRequest("POST", "/write", bytes.NewReader([]byte("not snappy"))))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	// a body claiming to decompress to more than the maximum size
+	w = httptest.NewRecorder()
+	p.write(w, httptest.NewRequest("POST", "/write", bytes.NewReader([]byte{0x81, 0x08})))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	// a body larger than the maximum size
+	w = httptest.NewRecorder()
+	p.write(w, httptest.NewRequest("POST", "/write", bytes.NewReader(make([]byte, 2048))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	w = httptest.NewRecorder()
+	p.write(w, httptest.NewRequest("GET", "/write", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestNameAndTags(t *testing.T) {
+	cases := []struct {
+		labels []prompb.Label
+		name   string
+		tags   []string
+		err    bool
+	}{
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}, {Name: "dc", Value: "x"}}, "up", []string{"dc=x", "job=api"}, false},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "url", Value: "http://a/b?c=d"}}, "up", []string{"url=http://a/b?c=d"}, false},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: ""}}, "up", []string{}, false},
+		{[]prompb.Label{{Name: "__name__", Value: "up;job=api"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a;b"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "~api"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "jo=b", Value: "api"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "", Value: "api"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "name", Value: "x"}}, "", nil, true},
+		{[]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}, {Name: "job", Value: "b"}}, "", nil, true},
+	}
+	for i, c := range cases {
+		name, tags, err := nameAndTags(c.labels)
+		if (err != nil) != c.err {
+			t.Fatalf("case %d: expected error %t, got %v", i, c.err, err)
+		}
+		if name != c.name || !c.err && !reflect.DeepEqual(tags, c.tags) {
+			t.Fatalf("case %d: expected %q %v, got %q %v", i, c.name, c.tags, name, tags)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package input
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateTag validates a tag of a series, given its key and value, like graphite does:
+// the key must be non-empty and not contain any of ;!^=, and the value must be non-empty,
+// not contain ; and not start with ~. additionally, the name tag is reserved for the name of the series.
+func ValidateTag(key, value string) error {
+	if key == "" || strings.ContainsAny(key, ";!^=") {
+		return fmt.Errorf("tag %q: key must be non-empty and not contain any of ;!^=", key+"="+value)
+	}
+	if key == "name" {
+		return fmt.Errorf("tag %q: the name tag is reserved for the metric name", key+"="+value)
+	}
+	if value == "" || value[0] == '~' || strings.IndexByte(value, ';') != -1 {
+		return fmt.Errorf("tag %q: value must be non-empty, not contain ; and not start with ~", key+"="+value)
+	}
+	return nil
+}
+
+// SortTags sorts the given tags, in the graphite format key=value, like graphite does,
+// and validates that no key is given more than once.
+func SortTags(tags []string) error {
+	sort.Strings(tags)
+	for i := 1; i < len(tags); i++ {
+		if tagKey(tags[i]) == tagKey(tags[i-1]) {
+			return fmt.Errorf("tag %q is given more than once", tagKey(tags[i]))
+		}
+	}
+	return nil
+}
+
+func tagKey(tag string) string {
+	return tag[:strings.IndexByte(tag, '=')]
+}
@@ -12,6 +12,7 @@ type MockCache struct {
 	CacheIfHotCb    func()
 	StopCount       int
 	SearchCount     int
+	PeekCount       int
 }
 
 func (mc *MockCache) Add(m string, t uint32, i chunk.IterGen) {
@@ -41,3 +42,10 @@ func (mc *MockCache) Search(m string, f uint32, u uint32) *CCSearchResult {
 	mc.SearchCount++
 	return nil
 }
+
+func (mc *MockCache) Peek(m string, f uint32, u uint32) *CCSearchResult {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.PeekCount++
+	return nil
+}
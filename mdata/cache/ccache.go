@@ -192,3 +192,24 @@ func (c *CCache) Search(ctx context.Context, metric string, from, until uint32)
 
 	return res
 }
+
+// Peek looks up the chunks like Search, but without side effects: it doesn't count towards
+// the hit and miss stats, and doesn't mark the chunks as used, so it doesn't affect their eviction.
+func (c *CCache) Peek(ctx context.Context, metric string, from, until uint32) *CCSearchResult {
+	res := &CCSearchResult{
+		From:  from,
+		Until: until,
+	}
+
+	if from == until {
+		return res
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	if cm, ok := c.metricCache[metric]; ok {
+		cm.Search(ctx, metric, res, from, until)
+	}
+	return res
+}
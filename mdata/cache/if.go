@@ -11,6 +11,7 @@ type Cache interface {
 	CacheIfHot(string, uint32, chunk.IterGen)
 	Stop()
 	Search(context.Context, string, uint32, uint32) *CCSearchResult
+	Peek(context.Context, string, uint32, uint32) *CCSearchResult
 }
 
 type CachePusher interface {
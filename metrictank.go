@@ -26,6 +26,7 @@ import (
 	"github.com/grafana/metrictank/input"
 	inCarbon "github.com/grafana/metrictank/input/carbon"
 	inKafkaMdm "github.com/grafana/metrictank/input/kafkamdm"
+	inPrometheus "github.com/grafana/metrictank/input/prometheus"
 	"github.com/grafana/metrictank/mdata"
 	"github.com/grafana/metrictank/mdata/cache"
 	"github.com/grafana/metrictank/mdata/notifierKafka"
@@ -131,6 +132,7 @@ func main() {
 	// load config for metric ingestors
 	inCarbon.ConfigSetup()
 	inKafkaMdm.ConfigSetup()
+	inPrometheus.ConfigSetup()
 
 	// load config for cluster handlers
 	notifierNsq.ConfigSetup()
@@ -208,12 +210,13 @@ func main() {
 	***********************************/
 	inCarbon.ConfigProcess()
 	inKafkaMdm.ConfigProcess(*instance)
+	inPrometheus.ConfigProcess()
 	notifierNsq.ConfigProcess()
 	notifierKafka.ConfigProcess(*instance)
 	statsConfig.ConfigProcess(*instance)
 	mdata.ConfigProcess()
 
-	if !inCarbon.Enabled && !inKafkaMdm.Enabled {
+	if !inCarbon.Enabled && !inKafkaMdm.Enabled && !inPrometheus.Enabled {
 		log.Fatal(4, "you should enable at least 1 input plugin")
 	}
 
@@ -297,6 +300,10 @@ func main() {
 		inputs = append(inputs, inKafkaMdm.New())
 	}
 
+	if inPrometheus.Enabled {
+		inputs = append(inputs, inPrometheus.New())
+	}
+
 	if cluster.Mode == cluster.ModeMulti && len(inputs) > 1 {
 		log.Warn("It is not recommended to run a mulitnode cluster with more than 1 input plugin.")
 	}
@@ -374,7 +381,10 @@ func main() {
 	***********************************/
 	for _, plugin := range inputs {
 		if carbonPlugin, ok := plugin.(*inCarbon.Carbon); ok {
-			carbonPlugin.IntervalGetter(inCarbon.NewIndexIntervalGetter(metricIndex))
+			carbonPlugin.IntervalGetter(input.NewIndexIntervalGetter(metricIndex))
+		}
+		if prometheusPlugin, ok := plugin.(*inPrometheus.Prometheus); ok {
+			prometheusPlugin.IntervalGetter(input.NewIndexIntervalGetter(metricIndex))
 		}
 		plugin.Start(input.NewDefaultHandler(metrics, metricIndex, plugin.Name()))
 		plugin.MaintainPriority()
@@ -0,0 +1,540 @@
+// Package prompb implements the protocol buffer messages of the prometheus remote storage protocols,
+// as defined in prometheus' prompb/remote.proto and prompb/types.proto.
+// only the fields that metrictank uses are supported, other fields are skipped when decoding.
+package prompb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+)
+
+type MatchType int32
+
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+func (m MatchType) String() string {
+	switch m {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	case MatchNotRegexp:
+		return "!~"
+	}
+	return fmt.Sprintf("MatchType(%d)", int32(m))
+}
+
+type WriteRequest struct {
+	Timeseries []TimeSeries // field 1
+}
+
+type ReadRequest struct {
+	Queries []Query // field 1
+}
+
+type Query struct {
+	StartTimestampMs int64          // field 1
+	EndTimestampMs   int64          // field 2
+	Matchers         []LabelMatcher // field 3
+}
+
+type LabelMatcher struct {
+	Type  MatchType // field 1
+	Name  string    // field 2
+	Value string    // field 3
+}
+
+type ReadResponse struct {
+	Results []QueryResult // field 1, one for each query of the request
+}
+
+type QueryResult struct {
+	Timeseries []TimeSeries // field 1
+}
+
+type TimeSeries struct {
+	Labels  []Label  // field 1
+	Samples []Sample // field 2
+}
+
+type Label struct {
+	Name  string // field 1
+	Value string // field 2
+}
+
+type Sample struct {
+	Value     float64 // field 1
+	Timestamp int64   // field 2, in ms
+}
+
+// ErrTooLarge is returned when a request decompresses to more than the maximum size
+type ErrTooLarge struct {
+	Size int
+	Max  int
+}
+
+func (e ErrTooLarge) Error() string {
+	return fmt.Sprintf("request of %d bytes exceeds the maximum of %d bytes", e.Size, e.Max)
+}
+
+// MaxEncodedLen returns the maximum size of a snappy compressed request that decompresses to maxSize bytes
+func MaxEncodedLen(maxSize int) int {
+	return snappy.MaxEncodedLen(maxSize)
+}
+
+// decode decompresses the snappy compressed body. the decompressed size is checked against maxSize
+// before anything is allocated, as it is taken from the header of the body.
+func decode(body []byte, maxSize int) ([]byte, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSize {
+		return nil, ErrTooLarge{size, maxSize}
+	}
+	return snappy.Decode(nil, body)
+}
+
+// DecodeWriteRequest decodes a snappy compressed WriteRequest, as sent by prometheus.
+// requests that decompress to more than maxSize bytes are rejected with ErrTooLarge.
+func DecodeWriteRequest(body []byte, maxSize int) (WriteRequest, error) {
+	var req WriteRequest
+	buf, err := decode(body, maxSize)
+	if err != nil {
+		return req, err
+	}
+	err = req.Unmarshal(buf)
+	return req, err
+}
+
+// EncodeWriteRequest returns the snappy compressed WriteRequest
+func EncodeWriteRequest(req WriteRequest) []byte {
+	return snappy.Encode(nil, req.Marshal())
+}
+
+// DecodeReadRequest decodes a snappy compressed ReadRequest, as sent by prometheus.
+// requests that decompress to more than maxSize bytes are rejected with ErrTooLarge.
+func DecodeReadRequest(body []byte, maxSize int) (ReadRequest, error) {
+	var req ReadRequest
+	buf, err := decode(body, maxSize)
+	if err != nil {
+		return req, err
+	}
+	err = req.Unmarshal(buf)
+	return req, err
+}
+
+// EncodeReadRequest returns the snappy compressed ReadRequest
+func EncodeReadRequest(req ReadRequest) []byte {
+	return snappy.Encode(nil, req.Marshal())
+}
+
+func (r *WriteRequest) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		if field == 1 && wire == wireBytes {
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var ts TimeSeries
+			if err := ts.Unmarshal(msg); err != nil {
+				return err
+			}
+			r.Timeseries = append(r.Timeseries, ts)
+			continue
+		}
+		if err := d.skip(wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r WriteRequest) Marshal() []byte {
+	size := 0
+	for _, ts := range r.Timeseries {
+		size += messageSize(1, ts.size())
+	}
+	b := make([]byte, 0, size)
+	for _, ts := range r.Timeseries {
+		b = appendMessage(b, 1, ts.size())
+		b = ts.appendTo(b)
+	}
+	return b
+}
+
+func (r *ReadRequest) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		if field == 1 && wire == wireBytes {
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var q Query
+			if err := q.Unmarshal(msg); err != nil {
+				return err
+			}
+			r.Queries = append(r.Queries, q)
+			continue
+		}
+		if err := d.skip(wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r ReadRequest) Marshal() []byte {
+	var b []byte
+	for _, q := range r.Queries {
+		b = appendMessage(b, 1, q.size())
+		b = q.appendTo(b)
+	}
+	return b
+}
+
+func (q *Query) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wireVarint:
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			q.StartTimestampMs = int64(v)
+		case field == 2 && wire == wireVarint:
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			q.EndTimestampMs = int64(v)
+		case field == 3 && wire == wireBytes:
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var m LabelMatcher
+			if err := m.Unmarshal(msg); err != nil {
+				return err
+			}
+			q.Matchers = append(q.Matchers, m)
+		default:
+			// includes the read hints in field 4
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q Query) size() int {
+	n := varintFieldSize(1, uint64(q.StartTimestampMs)) + varintFieldSize(2, uint64(q.EndTimestampMs))
+	for _, m := range q.Matchers {
+		n += messageSize(3, m.size())
+	}
+	return n
+}
+
+func (q Query) appendTo(b []byte) []byte {
+	b = appendVarintField(b, 1, uint64(q.StartTimestampMs))
+	b = appendVarintField(b, 2, uint64(q.EndTimestampMs))
+	for _, m := range q.Matchers {
+		b = appendMessage(b, 3, m.size())
+		b = m.appendTo(b)
+	}
+	return b
+}
+
+func (m *LabelMatcher) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wireVarint:
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			m.Type = MatchType(v)
+		case field == 2 && wire == wireBytes:
+			v, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			m.Name = string(v)
+		case field == 3 && wire == wireBytes:
+			v, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			m.Value = string(v)
+		default:
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m LabelMatcher) size() int {
+	return varintFieldSize(1, uint64(m.Type)) + stringFieldSize(2, m.Name) + stringFieldSize(3, m.Value)
+}
+
+func (m LabelMatcher) appendTo(b []byte) []byte {
+	b = appendVarintField(b, 1, uint64(m.Type))
+	b = appendStringField(b, 2, m.Name)
+	return appendStringField(b, 3, m.Value)
+}
+
+func (r *ReadResponse) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		if field == 1 && wire == wireBytes {
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var res QueryResult
+			if err := res.Unmarshal(msg); err != nil {
+				return err
+			}
+			r.Results = append(r.Results, res)
+			continue
+		}
+		if err := d.skip(wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r ReadResponse) Marshal() []byte {
+	size := 0
+	for _, res := range r.Results {
+		size += messageSize(1, res.size())
+	}
+	b := make([]byte, 0, size)
+	for _, res := range r.Results {
+		b = appendMessage(b, 1, res.size())
+		b = res.appendTo(b)
+	}
+	return b
+}
+
+func (r *QueryResult) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		if field == 1 && wire == wireBytes {
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var ts TimeSeries
+			if err := ts.Unmarshal(msg); err != nil {
+				return err
+			}
+			r.Timeseries = append(r.Timeseries, ts)
+			continue
+		}
+		if err := d.skip(wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r QueryResult) size() int {
+	n := 0
+	for _, ts := range r.Timeseries {
+		n += messageSize(1, ts.size())
+	}
+	return n
+}
+
+func (r QueryResult) appendTo(b []byte) []byte {
+	for _, ts := range r.Timeseries {
+		b = appendMessage(b, 1, ts.size())
+		b = ts.appendTo(b)
+	}
+	return b
+}
+
+func (t *TimeSeries) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wireBytes:
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var l Label
+			if err := l.Unmarshal(msg); err != nil {
+				return err
+			}
+			t.Labels = append(t.Labels, l)
+		case field == 2 && wire == wireBytes:
+			msg, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			var s Sample
+			if err := s.Unmarshal(msg); err != nil {
+				return err
+			}
+			t.Samples = append(t.Samples, s)
+		default:
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t TimeSeries) size() int {
+	n := 0
+	for _, l := range t.Labels {
+		n += messageSize(1, l.size())
+	}
+	for _, s := range t.Samples {
+		n += messageSize(2, s.size())
+	}
+	return n
+}
+
+func (t TimeSeries) appendTo(b []byte) []byte {
+	for _, l := range t.Labels {
+		b = appendMessage(b, 1, l.size())
+		b = l.appendTo(b)
+	}
+	for _, s := range t.Samples {
+		b = appendMessage(b, 2, s.size())
+		b = s.appendTo(b)
+	}
+	return b
+}
+
+func (l *Label) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wireBytes:
+			v, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			l.Name = string(v)
+		case field == 2 && wire == wireBytes:
+			v, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			l.Value = string(v)
+		default:
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l Label) size() int {
+	return stringFieldSize(1, l.Name) + stringFieldSize(2, l.Value)
+}
+
+func (l Label) appendTo(b []byte) []byte {
+	b = appendStringField(b, 1, l.Name)
+	return appendStringField(b, 2, l.Value)
+}
+
+func (s *Sample) Unmarshal(buf []byte) error {
+	d := decoder{buf: buf}
+	for !d.done() {
+		field, wire, err := d.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wireFixed64:
+			v, err := d.fixed64()
+			if err != nil {
+				return err
+			}
+			s.Value = math.Float64frombits(v)
+		case field == 2 && wire == wireVarint:
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			s.Timestamp = int64(v)
+		default:
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s Sample) size() int {
+	n := varintFieldSize(2, uint64(s.Timestamp))
+	if s.Value != 0 || math.Signbit(s.Value) {
+		n += 1 + 8
+	}
+	return n
+}
+
+func (s Sample) appendTo(b []byte) []byte {
+	if s.Value != 0 || math.Signbit(s.Value) {
+		b = append(b, 1<<3|wireFixed64)
+		b = appendFixed64(b, math.Float64bits(s.Value))
+	}
+	return appendVarintField(b, 2, uint64(s.Timestamp))
+}
@@ -0,0 +1,152 @@
+package prompb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadRequestRoundTrip(t *testing.T) {
+	req := ReadRequest{
+		Queries: []Query{
+			{
+				StartTimestampMs: 1500000000000,
+				EndTimestampMs:   1500000600000,
+				Matchers: []LabelMatcher{
+					{Type: MatchEqual, Name: "__name__", Value: "cpu"},
+					{Type: MatchNotRegexp, Name: "host", Value: "web.*"},
+				},
+			},
+			{
+				StartTimestampMs: -1000,
+				Matchers: []LabelMatcher{
+					{Type: MatchNotEqual, Name: "dc", Value: ""},
+				},
+			},
+		},
+	}
+	body := EncodeReadRequest(req)
+	got, err := DecodeReadRequest(body, len(req.Marshal()))
+	if err != nil {
+		t.Fatalf("DecodeReadRequest returned error %s", err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Fatalf("expected %+v, got %+v", req, got)
+	}
+}
+
+func TestWriteRequestRoundTrip(t *testing.T) {
+	req := WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels:  []Label{{"__name__", "http_requests_total"}, {"code", "200"}},
+				Samples: []Sample{{1027, 1500000000000}, {1031, 1500000015000}},
+			},
+			{
+				Labels:  []Label{{"__name__", "up"}},
+				Samples: []Sample{{1, 1500000000000}},
+			},
+		},
+	}
+	body := EncodeWriteRequest(req)
+	got, err := DecodeWriteRequest(body, len(req.Marshal()))
+	if err != nil {
+		t.Fatalf("DecodeWriteRequest returned error %s", err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Fatalf("expected %+v, got %+v", req, got)
+	}
+}
+
+// TestDecodeTooLarge tests that requests that decompress to more than the maximum size are rejected,
+// also when the size in the header of the body is bogus
+func TestDecodeTooLarge(t *testing.T) {
+	req := WriteRequest{
+		Timeseries: []TimeSeries{{Labels: []Label{{"__name__", "up"}}, Samples: []Sample{{1, 1500000000000}}}},
+	}
+	body := EncodeWriteRequest(req)
+	size := len(req.Marshal())
+	_, err := DecodeWriteRequest(body, size-1)
+	if exp := (ErrTooLarge{size, size - 1}); err != exp {
+		t.Fatalf("expected error %v, got %v", exp, err)
+	}
+	// a few bytes claiming to decompress to 4GB
+	_, err = DecodeReadRequest([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 1<<20)
+	if _, ok := err.(ErrTooLarge); !ok {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestReadResponseRoundTrip(t *testing.T) {
+	resp := ReadResponse{
+		Results: []QueryResult{
+			{
+				Timeseries: []TimeSeries{
+					{
+						Labels:  []Label{{"__name__", "cpu"}, {"host", "a"}},
+						Samples: []Sample{{1.5, 1000}, {0, 2000}, {-3, 3000}},
+					},
+					{
+						Labels: []Label{{"__name__", "mem"}},
+					},
+				},
+			},
+			{},
+		},
+	}
+	var got ReadResponse
+	if err := got.Unmarshal(resp.Marshal()); err != nil {
+		t.Fatalf("Unmarshal returned error %s", err)
+	}
+	// empty messages are still encoded, so they can be told apart
+	if !reflect.DeepEqual(got, resp) {
+		t.Fatalf("expected %+v, got %+v", resp, got)
+	}
+}
+
+// TestWireFormat checks our encoding against the one of the reference implementation
+func TestWireFormat(t *testing.T) {
+	ts := TimeSeries{
+		Labels:  []Label{{"a", "b"}},
+		Samples: []Sample{{1, 1000}},
+	}
+	exp := []byte{
+		0x0a, 0x06, // labels, 6 bytes
+		0x0a, 0x01, 'a', 0x12, 0x01, 'b',
+		0x12, 0x0c, // samples, 12 bytes
+		0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // value 1.0
+		0x10, 0xe8, 0x07, // timestamp 1000
+	}
+	got := ts.appendTo(nil)
+	if !bytes.Equal(got, exp) {
+		t.Fatalf("expected %x, got %x", exp, got)
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	buf := []byte{
+		0x08, 0x0a, // start 10
+		0x22, 0x02, 0x08, 0x01, // hints
+		0x1a, 0x05, 0x12, 0x01, 'a', 0x1a, 0x00, // matcher
+		0x2d, 1, 2, 3, 4, // fixed32 field 5
+		0x10, 0x14, // end 20
+	}
+	var q Query
+	if err := q.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal returned error %s", err)
+	}
+	exp := Query{StartTimestampMs: 10, EndTimestampMs: 20, Matchers: []LabelMatcher{{Name: "a"}}}
+	if !reflect.DeepEqual(q, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, q)
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	full := ReadResponse{Results: []QueryResult{{Timeseries: []TimeSeries{{Labels: []Label{{"__name__", "cpu"}}}}}}}.Marshal()
+	for i := 1; i < len(full); i++ {
+		var r ReadResponse
+		if err := r.Unmarshal(full[:i]); err == nil {
+			t.Fatalf("expected error for message truncated to %d bytes, got %+v", i, r)
+		}
+	}
+}
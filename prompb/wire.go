@@ -0,0 +1,170 @@
+package prompb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	errUnexpectedEOF = errors.New("prompb: unexpected end of message")
+	errOverflow      = errors.New("prompb: varint overflows 64 bits")
+)
+
+// wire types, see https://developers.google.com/protocol-buffers/docs/encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// decoder reads the fields of a protocol buffer message
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) done() bool {
+	return d.pos >= len(d.buf)
+}
+
+// key reads the key of the next field, returning its field number and wire type
+func (d *decoder) key() (int, int, error) {
+	v, err := d.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= 64 {
+			return 0, errOverflow
+		}
+		if d.pos >= len(d.buf) {
+			return 0, errUnexpectedEOF
+		}
+		b := d.buf[d.pos]
+		d.pos++
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+}
+
+func (d *decoder) fixed64() (uint64, error) {
+	if len(d.buf)-d.pos < 8 {
+		return 0, errUnexpectedEOF
+	}
+	v := binary.LittleEndian.Uint64(d.buf[d.pos:])
+	d.pos += 8
+	return v, nil
+}
+
+// bytes reads a length-delimited value. the returned slice refers to the buffer being decoded.
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errUnexpectedEOF
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// skip skips over the value of a field of the given wire type
+func (d *decoder) skip(wire int) error {
+	var err error
+	switch wire {
+	case wireVarint:
+		_, err = d.varint()
+	case wireFixed64:
+		_, err = d.fixed64()
+	case wireBytes:
+		_, err = d.bytes()
+	case wireFixed32:
+		if len(d.buf)-d.pos < 4 {
+			return errUnexpectedEOF
+		}
+		d.pos += 4
+	default:
+		// groups are deprecated and not used by the remote storage protocols
+		return fmt.Errorf("prompb: unsupported wire type %d", wire)
+	}
+	return err
+}
+
+func varintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// like proto3, fields that have their default value are omitted.
+// all our field numbers are < 16, so keys always take a single byte.
+
+func varintFieldSize(field int, v uint64) int {
+	if v == 0 {
+		return 0
+	}
+	return 1 + varintSize(v)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = append(b, byte(field<<3|wireVarint))
+	return appendVarint(b, v)
+}
+
+func stringFieldSize(field int, s string) int {
+	if s == "" {
+		return 0
+	}
+	return 1 + varintSize(uint64(len(s))) + len(s)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = append(b, byte(field<<3|wireBytes))
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// messageSize returns the size of an embedded message field, whose own size is given
+func messageSize(field int, size int) int {
+	return 1 + varintSize(uint64(size)) + size
+}
+
+// appendMessage appends the key and length of an embedded message field. the caller appends the message itself.
+func appendMessage(b []byte, field int, size int) []byte {
+	b = append(b, byte(field<<3|wireBytes))
+	return appendVarint(b, uint64(size))
+}
@@ -0,0 +1,203 @@
+package promql
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// Lookback is how far back a query looks for the latest point of a series at a given time, in seconds.
+// like in prometheus, this is 5 minutes.
+const Lookback = 5 * 60
+
+// Series is a series of the result of a query
+type Series struct {
+	Labels map[string]string
+	Points []schema.Point
+}
+
+// Result returns the result of the program, given the output of its target.
+// unless a quantile is computed, the points of the returned series are those of the output of the target.
+func (p Program) Result(in []models.Series) []Series {
+	out := make([]Series, 0, len(in))
+	for _, serie := range in {
+		out = append(out, Series{
+			Labels: p.labels.of(serie.Tags),
+			Points: serie.Datapoints,
+		})
+	}
+	if !p.histogram {
+		return out
+	}
+	return histogramQuantile(p.quantile, out, p.ops)
+}
+
+// of returns the labels of a series with the given tags
+func (l labels) of(tags map[string]string) map[string]string {
+	out := make(map[string]string, len(tags))
+	if l.aggregated {
+		for _, label := range l.by {
+			key := label
+			if key == "__name__" {
+				key = "name"
+			}
+			if val, ok := tags[key]; ok && val != "" {
+				out[label] = val
+			}
+		}
+		return out
+	}
+	for key, val := range tags {
+		if key == "name" {
+			if !l.name {
+				continue
+			}
+			key = "__name__"
+		}
+		out[key] = val
+	}
+	return out
+}
+
+type bucket struct {
+	upperBound float64
+	points     []schema.Point
+}
+
+// histogramQuantile computes the given quantile from histogram buckets, like prometheus' histogram_quantile:
+// the buckets are grouped by their labels other than le, and the quantile is interpolated within the bucket it falls in.
+// the given arithmetic is applied to the computed quantiles.
+func histogramQuantile(q float64, in []Series, ops []scalarOp) []Series {
+	var keys []string
+	groups := make(map[string][]bucket)
+	groupLabels := make(map[string]map[string]string)
+	for _, serie := range in {
+		upperBound, err := strconv.ParseFloat(serie.Labels["le"], 64)
+		if err != nil {
+			// like prometheus, we ignore series without a valid le label
+			continue
+		}
+		labels := make(map[string]string, len(serie.Labels))
+		for key, val := range serie.Labels {
+			if key != "le" {
+				labels[key] = val
+			}
+		}
+		key := labelsKey(labels)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			groupLabels[key] = labels
+		}
+		groups[key] = append(groups[key], bucket{upperBound, serie.Points})
+	}
+
+	out := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		buckets := groups[key]
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].upperBound < buckets[j].upperBound })
+		n := len(buckets[0].points)
+		for _, b := range buckets[1:] {
+			if len(b.points) < n {
+				n = len(b.points)
+			}
+		}
+		points := make([]schema.Point, n)
+		bounds := make([]float64, 0, len(buckets))
+		counts := make([]float64, 0, len(buckets))
+		for i := range points {
+			bounds, counts = bounds[:0], counts[:0]
+			for _, b := range buckets {
+				if !math.IsNaN(b.points[i].Val) {
+					bounds = append(bounds, b.upperBound)
+					counts = append(counts, b.points[i].Val)
+				}
+			}
+			val := bucketQuantile(q, bounds, counts)
+			for _, op := range ops {
+				val = op.apply(val)
+			}
+			points[i] = schema.Point{Val: val, Ts: buckets[0].points[i].Ts}
+		}
+		out = append(out, Series{Labels: groupLabels[key], Points: points})
+	}
+	return out
+}
+
+// bucketQuantile computes the quantile from the cumulative counts of buckets with the given, sorted upper bounds.
+// it works the same as prometheus' bucketQuantile.
+func bucketQuantile(q float64, bounds, counts []float64) float64 {
+	switch {
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	case len(bounds) < 2 || !math.IsInf(bounds[len(bounds)-1], 1):
+		return math.NaN()
+	}
+	// counts may decrease due to the buckets being scraped at different times. treat them as monotonic
+	for i := 1; i < len(counts); i++ {
+		if counts[i] < counts[i-1] {
+			counts[i] = counts[i-1]
+		}
+	}
+	last := len(counts) - 1
+	rank := q * counts[last]
+	b := sort.SearchFloat64s(counts, rank)
+	switch {
+	case b == last:
+		return bounds[last-1]
+	case b == 0 && bounds[0] <= 0:
+		return bounds[0]
+	}
+	start, end, count := 0.0, bounds[b], counts[b]
+	if b > 0 {
+		start = bounds[b-1]
+		count -= counts[b-1]
+		rank -= counts[b-1]
+	}
+	return start + (end-start)*(rank/count)
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(labels[key])
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// Samples returns the values of the series at every step from start to end, inclusive.
+// like in prometheus, the value at a given time is the latest non-null value within the lookback period before it.
+// steps at which the series has no such value are left out.
+func (s Series) Samples(start, end, step uint32) []schema.Point {
+	var out []schema.Point
+	i := 0 // index of the first point after the current step
+	latest := -1
+	for ts := start; ts <= end; ts += step {
+		for i < len(s.Points) && s.Points[i].Ts <= ts {
+			if !math.IsNaN(s.Points[i].Val) {
+				latest = i
+			}
+			i++
+		}
+		if latest >= 0 && s.Points[latest].Ts+Lookback > ts {
+			out = append(out, schema.Point{Val: s.Points[latest].Val, Ts: ts})
+		}
+		if ts+step < ts {
+			break // overflow
+		}
+	}
+	return out
+}
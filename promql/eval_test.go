@@ -0,0 +1,105 @@
+package promql
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func TestLabels(t *testing.T) {
+	tags := map[string]string{"name": "cpu", "host": "a", "dc": ""}
+	cases := []struct {
+		labels labels
+		exp    map[string]string
+	}{
+		{labels{name: true}, map[string]string{"__name__": "cpu", "host": "a", "dc": ""}},
+		{labels{}, map[string]string{"host": "a", "dc": ""}},
+		{labels{aggregated: true}, map[string]string{}},
+		{labels{aggregated: true, by: []string{"__name__", "dc", "zone"}}, map[string]string{"__name__": "cpu"}},
+	}
+	for i, c := range cases {
+		if got := c.labels.of(tags); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("case %d: expected %v, got %v", i, c.exp, got)
+		}
+	}
+}
+
+func TestBucketQuantile(t *testing.T) {
+	inf := math.Inf(1)
+	cases := []struct {
+		q      float64
+		bounds []float64
+		counts []float64
+		exp    float64
+	}{
+		{0.5, []float64{1, 2, inf}, []float64{10, 20, 20}, 1},
+		{0.75, []float64{1, 2, inf}, []float64{10, 20, 20}, 1.5},
+		{0.25, []float64{1, 2, inf}, []float64{10, 20, 20}, 0.5},
+		{0.99, []float64{1, 2, inf}, []float64{10, 10, 20}, 2},
+		{0.5, []float64{1, 2, inf}, []float64{10, 8, 20}, 1},
+		{-1, []float64{1, inf}, []float64{1, 1}, math.Inf(-1)},
+		{2, []float64{1, inf}, []float64{1, 1}, inf},
+	}
+	for i, c := range cases {
+		if got := bucketQuantile(c.q, c.bounds, c.counts); got != c.exp {
+			t.Errorf("case %d: expected %v, got %v", i, c.exp, got)
+		}
+	}
+	if got := bucketQuantile(0.5, []float64{1, 2}, []float64{1, 2}); !math.IsNaN(got) {
+		t.Errorf("expected NaN without +Inf bucket, got %v", got)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	bucket := func(host, le string, vals ...float64) models.Series {
+		points := make([]schema.Point, len(vals))
+		for i, v := range vals {
+			points[i] = schema.Point{Val: v, Ts: uint32(10 * (i + 1))}
+		}
+		return models.Series{Tags: map[string]string{"name": "lat_bucket", "host": host, "le": le}, Datapoints: points}
+	}
+	prog := Program{
+		Target:    "whatever",
+		histogram: true,
+		quantile:  0.5,
+		ops:       []scalarOp{{op: "*", val: 2}},
+	}
+	got := prog.Result([]models.Series{
+		bucket("a", "+Inf", 4, 8),
+		bucket("a", "1", 2, 2),
+		bucket("a", "2", 4, 6),
+		bucket("b", "1", 1),
+		bucket("b", "+Inf", 2),
+		bucket("b", "foo", 2),
+	})
+	exp := []Series{
+		{Labels: map[string]string{"host": "a"}, Points: []schema.Point{{Val: 2, Ts: 10}, {Val: 3, Ts: 20}}},
+		{Labels: map[string]string{"host": "b"}, Points: []schema.Point{{Val: 2, Ts: 10}}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestSamples(t *testing.T) {
+	s := Series{Points: []schema.Point{
+		{Val: 1, Ts: 100},
+		{Val: math.NaN(), Ts: 200},
+		{Val: 3, Ts: 300},
+	}}
+	got := s.Samples(50, 900, 100)
+	// no value before the first point, the null is skipped, and the last value expires after the lookback
+	exp := []schema.Point{
+		{Val: 1, Ts: 150},
+		{Val: 1, Ts: 250},
+		{Val: 3, Ts: 350},
+		{Val: 3, Ts: 450},
+		{Val: 3, Ts: 550},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
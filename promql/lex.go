@@ -0,0 +1,189 @@
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type itemType int
+
+const (
+	itemEOF itemType = iota
+	itemIdentifier
+	itemNumber
+	itemString
+	itemDuration // the contents of [], e.g. 5m
+	itemOperator // arithmetic and comparison operators, and label matching operators
+	itemLeftParen
+	itemRightParen
+	itemLeftBrace
+	itemRightBrace
+	itemComma
+)
+
+type item struct {
+	typ itemType
+	pos int
+	val string // for strings, the unquoted value
+}
+
+func (i item) String() string {
+	switch i.typ {
+	case itemEOF:
+		return "end of input"
+	case itemString:
+		return strconv.Quote(i.val)
+	case itemDuration:
+		return "[" + i.val + "]"
+	}
+	return fmt.Sprintf("%q", i.val)
+}
+
+// lex splits the query into items
+func lex(query string) ([]item, error) {
+	var items []item
+	pos := 0
+	for {
+		for pos < len(query) && isSpace(query[pos]) {
+			pos++
+		}
+		if pos == len(query) {
+			return append(items, item{itemEOF, pos, ""}), nil
+		}
+		start := pos
+		c := query[pos]
+		switch {
+		case c == '#':
+			// comment until the end of the line
+			for pos < len(query) && query[pos] != '\n' {
+				pos++
+			}
+			continue
+		case c == '(':
+			items = append(items, item{itemLeftParen, pos, "("})
+			pos++
+		case c == ')':
+			items = append(items, item{itemRightParen, pos, ")"})
+			pos++
+		case c == '{':
+			items = append(items, item{itemLeftBrace, pos, "{"})
+			pos++
+		case c == '}':
+			items = append(items, item{itemRightBrace, pos, "}"})
+			pos++
+		case c == ',':
+			items = append(items, item{itemComma, pos, ","})
+			pos++
+		case c == '[':
+			end := strings.IndexByte(query[pos:], ']')
+			if end < 0 {
+				return nil, ParseError{pos, "unclosed ["}
+			}
+			items = append(items, item{itemDuration, pos, strings.TrimSpace(query[pos+1 : pos+end])})
+			pos += end + 1
+		case c == '"' || c == '\'' || c == '`':
+			val, n, err := lexString(query[pos:])
+			if err != nil {
+				return nil, ParseError{pos, err.Error()}
+			}
+			items = append(items, item{itemString, pos, val})
+			pos += n
+		case isDigit(c) || (c == '.' && pos+1 < len(query) && isDigit(query[pos+1])):
+			for pos < len(query) && (isAlphaNum(query[pos]) || query[pos] == '.' ||
+				((query[pos] == '+' || query[pos] == '-') && (query[pos-1] == 'e' || query[pos-1] == 'E'))) {
+				pos++
+			}
+			items = append(items, item{itemNumber, start, query[start:pos]})
+		case isAlpha(c) || c == ':':
+			for pos < len(query) && (isAlphaNum(query[pos]) || query[pos] == ':' || query[pos] == '.') {
+				pos++
+			}
+			items = append(items, item{itemIdentifier, start, query[start:pos]})
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "=~", "!~", ">=", "<=", "+", "-", "*", "/", "%", "^", "=", ">", "<"} {
+				if strings.HasPrefix(query[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, ParseError{pos, fmt.Sprintf("unexpected character %q", c)}
+			}
+			items = append(items, item{itemOperator, pos, op})
+			pos += len(op)
+		}
+	}
+}
+
+// lexString returns the value of the quoted string at the start of s, and the length of the quoted string.
+// like in promql, backticks quote raw strings, and the other quotes support go's escape sequences.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case '\n':
+			if quote != '`' {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+		case quote:
+			if quote == '`' {
+				return s[1:i], i + 1, nil
+			}
+			quoted := s[:i+1]
+			if quote == '\'' {
+				// strconv only unquotes single characters in single quotes, so we requote the string
+				quoted = requote(s[1:i])
+			}
+			val, err := strconv.Unquote(quoted)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return val, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// requote returns the body of a single quoted string as a double quoted string
+func requote(body string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body):
+			if body[i+1] != '\'' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(body[i+1])
+			i++
+		case body[i] == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(body[i])
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlphaNum(c byte) bool {
+	return isAlpha(c) || isDigit(c)
+}
@@ -0,0 +1,581 @@
+// Package promql implements the subset of the prometheus query language that metrictank supports,
+// by translating queries into graphite targets that are executed by the expr package.
+package promql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/prompb"
+)
+
+// ParseError is an error in a query, at the given byte offset
+type ParseError struct {
+	Pos int
+	Err string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("parse error at char %d: %s", e.Pos+1, e.Err)
+}
+
+// Node is a node of a parsed query
+type Node interface {
+	String() string
+}
+
+type NumberLiteral struct {
+	Val float64
+}
+
+// VectorSelector selects series by their labels. if Range is set, it is a range vector selector such as foo[5m]
+type VectorSelector struct {
+	Matchers []prompb.LabelMatcher
+	Range    time.Duration
+}
+
+type Call struct {
+	Func string
+	Args []Node
+}
+
+type AggregateExpr struct {
+	Op       string
+	Grouping []string // the labels of the by clause
+	Expr     Node
+}
+
+type BinaryExpr struct {
+	Op  string
+	LHS Node
+	RHS Node
+}
+
+var (
+	// the functions we support, with the types of their arguments
+	functions = map[string][]string{
+		"rate":               {"range"},
+		"irate":              {"range"},
+		"increase":           {"range"},
+		"histogram_quantile": {"scalar", "vector"},
+	}
+	aggregators = map[string]struct{}{
+		"sum":   {},
+		"avg":   {},
+		"max":   {},
+		"min":   {},
+		"count": {},
+	}
+	unsupportedKeywords = map[string]struct{}{
+		"offset":       {},
+		"without":      {},
+		"bool":         {},
+		"on":           {},
+		"ignoring":     {},
+		"group_left":   {},
+		"group_right":  {},
+		"and":          {},
+		"or":           {},
+		"unless":       {},
+		"stddev":       {},
+		"stdvar":       {},
+		"topk":         {},
+		"bottomk":      {},
+		"quantile":     {},
+		"count_values": {},
+	}
+)
+
+func (n *NumberLiteral) String() string {
+	return strconv.FormatFloat(n.Val, 'g', -1, 64)
+}
+
+func (n *VectorSelector) String() string {
+	matchers := make([]string, 0, len(n.Matchers))
+	for _, m := range n.Matchers {
+		matchers = append(matchers, m.Name+m.Type.String()+strconv.Quote(m.Value))
+	}
+	out := "{" + strings.Join(matchers, ",") + "}"
+	if n.Range != 0 {
+		out += "[" + strconv.FormatInt(int64(n.Range/time.Second), 10) + "s]"
+	}
+	return out
+}
+
+func (n *Call) String() string {
+	args := make([]string, 0, len(n.Args))
+	for _, arg := range n.Args {
+		args = append(args, arg.String())
+	}
+	return n.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *AggregateExpr) String() string {
+	out := n.Op
+	if n.Grouping != nil {
+		out += " by (" + strings.Join(n.Grouping, ", ") + ")"
+	}
+	return out + " (" + n.Expr.String() + ")"
+}
+
+func (n *BinaryExpr) String() string {
+	return "(" + n.LHS.String() + " " + n.Op + " " + n.RHS.String() + ")"
+}
+
+type parser struct {
+	items []item
+	pos   int
+}
+
+// Parse parses the given query
+func Parse(query string) (Node, error) {
+	items, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{items: items}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.typ != itemEOF {
+		return nil, p.unexpected(next, "end of input")
+	}
+	return node, nil
+}
+
+func (p *parser) peek() item {
+	return p.items[p.pos]
+}
+
+func (p *parser) next() item {
+	it := p.items[p.pos]
+	if it.typ != itemEOF {
+		p.pos++
+	}
+	return it
+}
+
+func (p *parser) expect(typ itemType, desc string) (item, error) {
+	it := p.next()
+	if it.typ != typ {
+		return it, p.unexpected(it, desc)
+	}
+	return it, nil
+}
+
+func (p *parser) unexpected(it item, exp string) error {
+	return ParseError{it.pos, fmt.Sprintf("unexpected %s, expected %s", it, exp)}
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	it := p.peek()
+	if it.typ != itemOperator {
+		return false
+	}
+	for _, op := range ops {
+		if it.val == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpr parses an expression consisting of additions and subtractions.
+// operators of the same precedence are left-associative, except for ^ which is right-associative.
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next().val
+		rhs, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{op, lhs, rhs}
+	}
+	if it := p.peek(); p.isOperator("==", "!=", ">", "<", ">=", "<=") {
+		return nil, ParseError{it.pos, fmt.Sprintf("comparison operator %s is not supported", it.val)}
+	}
+	if it := p.peek(); it.typ == itemIdentifier && isUnsupported(it.val) {
+		return nil, ParseError{it.pos, fmt.Sprintf("%s is not supported", it.val)}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseMul() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "%") {
+		op := p.next()
+		if op.val == "%" {
+			return nil, ParseError{op.pos, "operator % is not supported"}
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{op.val, lhs, rhs}
+	}
+	return lhs, nil
+}
+
+// parseUnary parses an expression with an optional sign. like in promql, -2^2 is -4.
+func (p *parser) parseUnary() (Node, error) {
+	if p.isOperator("+", "-") {
+		op := p.next().val
+		node, err := p.parseUnary()
+		if err != nil || op == "+" {
+			return node, err
+		}
+		if num, ok := node.(*NumberLiteral); ok {
+			return &NumberLiteral{-num.Val}, nil
+		}
+		return &BinaryExpr{"*", &NumberLiteral{-1}, node}, nil
+	}
+	return p.parsePow()
+}
+
+func (p *parser) parsePow() (Node, error) {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("^") {
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{"^", lhs, rhs}, nil
+	}
+	return lhs, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	it := p.peek()
+	switch it.typ {
+	case itemNumber:
+		p.next()
+		val, err := parseNumber(it.val)
+		if err != nil {
+			return nil, ParseError{it.pos, fmt.Sprintf("invalid number %q", it.val)}
+		}
+		return &NumberLiteral{val}, nil
+	case itemLeftParen:
+		p.next()
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(itemRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case itemLeftBrace:
+		return p.parseSelector("")
+	case itemIdentifier:
+		lower := strings.ToLower(it.val)
+		switch {
+		case lower == "inf" || lower == "nan":
+			p.next()
+			val, _ := parseNumber(lower)
+			return &NumberLiteral{val}, nil
+		case isUnsupported(it.val):
+			return nil, ParseError{it.pos, fmt.Sprintf("%s is not supported", it.val)}
+		}
+		if _, ok := aggregators[it.val]; ok && p.items[p.pos+1].typ != itemLeftBrace && p.items[p.pos+1].typ != itemDuration {
+			return p.parseAggregate()
+		}
+		if p.items[p.pos+1].typ == itemLeftParen {
+			return p.parseCall()
+		}
+		p.next()
+		return p.parseSelector(it.val)
+	}
+	return nil, p.unexpected(it, "expression")
+}
+
+func isUnsupported(keyword string) bool {
+	_, ok := unsupportedKeywords[keyword]
+	return ok
+}
+
+func parseNumber(s string) (float64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err := strconv.ParseInt(s[2:], 16, 64)
+		return float64(v), err
+	}
+	switch strings.ToLower(s) {
+	case "inf":
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (p *parser) parseCall() (Node, error) {
+	name := p.next()
+	argTypes, ok := functions[name.val]
+	if !ok {
+		return nil, ParseError{name.pos, fmt.Sprintf("unknown or unsupported function %s", name.val)}
+	}
+	p.next() // (
+	call := &Call{Func: name.val}
+	for p.peek().typ != itemRightParen {
+		if len(call.Args) > 0 {
+			if _, err := p.expect(itemComma, ", or )"); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	end := p.next()
+	if len(call.Args) != len(argTypes) {
+		return nil, ParseError{end.pos, fmt.Sprintf("%s expects %d arguments, got %d", name.val, len(argTypes), len(call.Args))}
+	}
+	for i, typ := range argTypes {
+		if got := typeOf(call.Args[i]); got != typ {
+			return nil, ParseError{name.pos, fmt.Sprintf("argument %d of %s must be of type %s, got %s", i+1, name.val, typeDesc(typ), typeDesc(got))}
+		}
+	}
+	return call, nil
+}
+
+// parseAggregate parses an aggregation. the by clause can come before or after the expression.
+func (p *parser) parseAggregate() (Node, error) {
+	op := p.next()
+	agg := &AggregateExpr{Op: op.val}
+	var err error
+	if it := p.peek(); it.typ == itemIdentifier {
+		if isUnsupported(it.val) {
+			return nil, ParseError{it.pos, fmt.Sprintf("%s is not supported", it.val)}
+		}
+		if it.val != "by" {
+			return nil, p.unexpected(it, "by or (")
+		}
+		if agg.Grouping, err = p.parseGrouping(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(itemLeftParen, "("); err != nil {
+		return nil, err
+	}
+	if agg.Expr, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(itemRightParen, ")"); err != nil {
+		return nil, err
+	}
+	if it := p.peek(); it.typ == itemIdentifier && (it.val == "by" || it.val == "without") {
+		if it.val == "without" {
+			return nil, ParseError{it.pos, "without is not supported"}
+		}
+		if agg.Grouping != nil {
+			return nil, p.unexpected(it, "end of aggregation")
+		}
+		if agg.Grouping, err = p.parseGrouping(); err != nil {
+			return nil, err
+		}
+	}
+	if typ := typeOf(agg.Expr); typ != "vector" {
+		return nil, ParseError{op.pos, fmt.Sprintf("%s expects an argument of type instant vector, got %s", op.val, typeDesc(typ))}
+	}
+	return agg, nil
+}
+
+func (p *parser) parseGrouping() ([]string, error) {
+	p.next() // by
+	if _, err := p.expect(itemLeftParen, "("); err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for p.peek().typ != itemRightParen {
+		if len(labels) > 0 {
+			if _, err := p.expect(itemComma, ", or )"); err != nil {
+				return nil, err
+			}
+		}
+		label, err := p.expect(itemIdentifier, "label name")
+		if err != nil {
+			return nil, err
+		}
+		if !isLabelName(label.val) {
+			return nil, ParseError{label.pos, fmt.Sprintf("invalid label name %q", label.val)}
+		}
+		labels = append(labels, label.val)
+	}
+	p.next()
+	return labels, nil
+}
+
+// parseSelector parses a vector selector with the given metric name, if any.
+func (p *parser) parseSelector(name string) (Node, error) {
+	start := p.peek()
+	sel := &VectorSelector{}
+	if name != "" {
+		sel.Matchers = append(sel.Matchers, prompb.LabelMatcher{Type: prompb.MatchEqual, Name: "__name__", Value: name})
+	}
+	if p.peek().typ == itemLeftBrace {
+		p.next()
+		for p.peek().typ != itemRightBrace {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			sel.Matchers = append(sel.Matchers, m)
+			if p.peek().typ != itemComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(itemRightBrace, ", or }"); err != nil {
+			return nil, err
+		}
+	}
+	if len(sel.Matchers) == 0 {
+		return nil, ParseError{start.pos, "vector selector must contain at least one matcher"}
+	}
+	if it := p.peek(); it.typ == itemDuration {
+		p.next()
+		d, err := ParseDuration(it.val)
+		if err != nil {
+			return nil, ParseError{it.pos, err.Error()}
+		}
+		sel.Range = d
+	}
+	if it := p.peek(); it.typ == itemIdentifier && it.val == "offset" {
+		return nil, ParseError{it.pos, "the offset modifier is not supported"}
+	}
+	return sel, nil
+}
+
+func (p *parser) parseMatcher() (prompb.LabelMatcher, error) {
+	var m prompb.LabelMatcher
+	label, err := p.expect(itemIdentifier, "label name")
+	if err != nil {
+		return m, err
+	}
+	if !isLabelName(label.val) {
+		return m, ParseError{label.pos, fmt.Sprintf("invalid label name %q", label.val)}
+	}
+	op, err := p.expect(itemOperator, "label matching operator")
+	if err != nil {
+		return m, err
+	}
+	switch op.val {
+	case "=":
+		m.Type = prompb.MatchEqual
+	case "!=":
+		m.Type = prompb.MatchNotEqual
+	case "=~":
+		m.Type = prompb.MatchRegexp
+	case "!~":
+		m.Type = prompb.MatchNotRegexp
+	default:
+		return m, p.unexpected(op, "label matching operator")
+	}
+	val, err := p.expect(itemString, "string")
+	if err != nil {
+		return m, err
+	}
+	m.Name = label.val
+	m.Value = val.val
+	return m, nil
+}
+
+func isLabelName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isAlpha(s[i]) && (i == 0 || !isDigit(s[i])) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ParseDuration parses a promql duration such as 1h30m. units are ms, s, m, h, d, w and y.
+func ParseDuration(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		d      time.Duration
+	}{
+		{"ms", time.Millisecond},
+		{"s", time.Second},
+		{"m", time.Minute},
+		{"h", time.Hour},
+		{"d", 24 * time.Hour},
+		{"w", 7 * 24 * time.Hour},
+		{"y", 365 * 24 * time.Hour},
+	}
+	orig := s
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+		s = s[i:]
+		found := false
+		for _, u := range units {
+			if strings.HasPrefix(s, u.suffix) {
+				total += time.Duration(n) * u.d
+				s = s[len(u.suffix):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", orig)
+	}
+	return total, nil
+}
+
+// typeOf returns the type the node evaluates to: scalar, vector or range
+func typeOf(n Node) string {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return "scalar"
+	case *VectorSelector:
+		if n.Range != 0 {
+			return "range"
+		}
+	case *BinaryExpr:
+		if typeOf(n.LHS) == "scalar" && typeOf(n.RHS) == "scalar" {
+			return "scalar"
+		}
+	}
+	return "vector"
+}
+
+func typeDesc(typ string) string {
+	switch typ {
+	case "range":
+		return "range vector"
+	case "vector":
+		return "instant vector"
+	}
+	return typ
+}
@@ -0,0 +1,90 @@
+package promql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		query string
+		exp   string
+	}{
+		{"cpu", `{__name__="cpu"}`},
+		{"cpu.usage{host='a', dc!~`east|west`,}", `{__name__="cpu.usage",host="a",dc!~"east|west"}`},
+		{`{job=~"api.*"}[5m]`, `{job=~"api.*"}[300s]`},
+		{"rate(http_requests_total[1m30s])", `rate({__name__="http_requests_total"}[90s])`},
+		{"sum by (host, dc) (irate(x[1m]))", `sum by (host, dc) (irate({__name__="x"}[60s]))`},
+		{"avg(x) by (host)", `avg by (host) ({__name__="x"})`},
+		{"max(x)", `max ({__name__="x"})`},
+		{"histogram_quantile(0.9, sum by (le) (rate(lat_bucket[5m])))", `histogram_quantile(0.9, sum by (le) (rate({__name__="lat_bucket"}[300s])))`},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"2 ^ 3 ^ 2", "(2 ^ (3 ^ 2))"},
+		{"-x / 2", `((-1 * {__name__="x"}) / 2)`},
+		{"-1.5e3 - 0x10 # comment", "(-1500 - 16)"},
+	}
+	for _, c := range cases {
+		n, err := Parse(c.query)
+		if err != nil {
+			t.Errorf("query %q: unexpected error %s", c.query, err)
+			continue
+		}
+		if got := n.String(); got != c.exp {
+			t.Errorf("query %q: expected %s, got %s", c.query, c.exp, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"x +",
+		"x > 1",
+		"x offset 5m",
+		"sum without (host) (x)",
+		"topk(3, x)",
+		"foo(x)",
+		"rate(x)",
+		"rate(x[5m], 1)",
+		"histogram_quantile(x, y)",
+		"sum(x[5m])",
+		"{}",
+		`{host=""}[5m`,
+		"x % 2",
+		`x{host="a}`,
+		"x{1host='a'}",
+		"x[5z]",
+	}
+	for _, query := range cases {
+		if n, err := Parse(query); err == nil {
+			t.Errorf("query %q: expected an error, got %s", query, n)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		in  string
+		exp time.Duration
+		err bool
+	}{
+		{"5m", 5 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"", 0, true},
+		{"5", 0, true},
+		{"m", 0, true},
+		{"5x", 0, true},
+	}
+	for _, c := range cases {
+		got, err := ParseDuration(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("duration %q: expected error %t, got %v", c.in, c.err, err)
+			continue
+		}
+		if got != c.exp {
+			t.Errorf("duration %q: expected %s, got %s", c.in, c.exp, got)
+		}
+	}
+}
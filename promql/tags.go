@@ -0,0 +1,52 @@
+package promql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/metrictank/prompb"
+)
+
+// TagExpressions translates prometheus label matchers into tag index expressions.
+// the __name__ label is the name of the series, and prometheus regular expressions are fully anchored.
+func TagExpressions(matchers []prompb.LabelMatcher) ([]string, error) {
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("no matchers specified")
+	}
+	expressions := make([]string, 0, len(matchers))
+	positive := false
+	for _, m := range matchers {
+		name := m.Name
+		if name == "__name__" {
+			name = "name"
+		}
+		if name == "" || strings.ContainsAny(name, ";!=~") || strings.Contains(m.Value, ";") {
+			return nil, fmt.Errorf("unsupported matcher %s%s%q", m.Name, m.Type, m.Value)
+		}
+		value := m.Value
+		if value != "" && (m.Type == prompb.MatchRegexp || m.Type == prompb.MatchNotRegexp) {
+			value = "^(?:" + value + ")$"
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("invalid regular expression in matcher %s%s%q: %s", m.Name, m.Type, m.Value, err)
+			}
+		}
+		switch m.Type {
+		case prompb.MatchEqual:
+			expressions = append(expressions, name+"="+value)
+		case prompb.MatchNotEqual:
+			expressions = append(expressions, name+"!="+value)
+		case prompb.MatchRegexp:
+			expressions = append(expressions, name+"=~"+value)
+		case prompb.MatchNotRegexp:
+			expressions = append(expressions, name+"!=~"+value)
+		default:
+			return nil, fmt.Errorf("unknown matcher type %d", int32(m.Type))
+		}
+		positive = positive || (value != "" && (m.Type == prompb.MatchEqual || m.Type == prompb.MatchRegexp))
+	}
+	if !positive {
+		return nil, fmt.Errorf("at least one matcher must be an equality or regular expression match on a non-empty value")
+	}
+	return expressions, nil
+}
@@ -0,0 +1,65 @@
+package promql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/prompb"
+)
+
+func TestTagExpressions(t *testing.T) {
+	cases := []struct {
+		matchers []prompb.LabelMatcher
+		exp      []string
+		err      bool
+	}{
+		{
+			matchers: []prompb.LabelMatcher{
+				{Type: prompb.MatchEqual, Name: "__name__", Value: "cpu"},
+				{Type: prompb.MatchNotEqual, Name: "dc", Value: "east"},
+				{Type: prompb.MatchRegexp, Name: "host", Value: "web.*"},
+				{Type: prompb.MatchNotRegexp, Name: "mode", Value: "idle|wait"},
+			},
+			exp: []string{"name=cpu", "dc!=east", "host=~^(?:web.*)$", "mode!=~^(?:idle|wait)$"},
+		},
+		{
+			matchers: []prompb.LabelMatcher{
+				{Type: prompb.MatchRegexp, Name: "__name__", Value: "cpu|mem"},
+				{Type: prompb.MatchEqual, Name: "dc", Value: ""},
+			},
+			exp: []string{"name=~^(?:cpu|mem)$", "dc="},
+		},
+		{
+			// only matchers that also match series without the label
+			matchers: []prompb.LabelMatcher{
+				{Type: prompb.MatchNotEqual, Name: "__name__", Value: "cpu"},
+				{Type: prompb.MatchEqual, Name: "dc", Value: ""},
+			},
+			err: true,
+		},
+		{
+			matchers: []prompb.LabelMatcher{{Type: prompb.MatchRegexp, Name: "__name__", Value: "cpu("}},
+			err:      true,
+		},
+		{
+			matchers: []prompb.LabelMatcher{{Type: prompb.MatchEqual, Name: "__name__", Value: "a;b"}},
+			err:      true,
+		},
+		{
+			matchers: []prompb.LabelMatcher{{Type: 4, Name: "__name__", Value: "cpu"}},
+			err:      true,
+		},
+		{
+			err: true,
+		},
+	}
+	for i, c := range cases {
+		got, err := TagExpressions(c.matchers)
+		if (err != nil) != c.err {
+			t.Fatalf("case %d: expected error %t, got %v", i, c.err, err)
+		}
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.exp, got)
+		}
+	}
+}
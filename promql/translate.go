@@ -0,0 +1,266 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Program describes how metrictank computes the result of a query:
+// a graphite target computes the series, and histogram_quantile and the arithmetic applied to it,
+// which have no graphite counterpart, are computed from the output of the target.
+type Program struct {
+	Target string  // the graphite target that computes the series of the query. empty if the query is a scalar
+	Scalar float64 // the value of a scalar query
+
+	labels    labels
+	histogram bool       // whether the output of the target are histogram buckets to compute a quantile from
+	quantile  float64    // the quantile to compute from the histogram buckets
+	ops       []scalarOp // the arithmetic applied to the computed quantiles
+}
+
+// labels describes which tags of the output series of a target are labels of the query result
+type labels struct {
+	name       bool     // whether the series keep their metric name
+	aggregated bool     // whether the series are aggregated, in which case they only have the labels they are grouped by
+	by         []string // the labels the series are grouped by
+}
+
+// scalarOp is an arithmetic operation between a series and a scalar
+type scalarOp struct {
+	op        string
+	val       float64
+	scalarLHS bool // whether the scalar is the left hand side of the operation
+}
+
+func (o scalarOp) apply(v float64) float64 {
+	lhs, rhs := v, o.val
+	if o.scalarLHS {
+		lhs, rhs = rhs, lhs
+	}
+	return arithmetic(o.op, lhs, rhs)
+}
+
+func arithmetic(op string, lhs, rhs float64) float64 {
+	switch op {
+	case "+":
+		return lhs + rhs
+	case "-":
+		return lhs - rhs
+	case "*":
+		return lhs * rhs
+	case "/":
+		return lhs / rhs
+	}
+	return math.Pow(lhs, rhs)
+}
+
+// Compile returns the program that computes the result of the given parsed query
+func Compile(n Node) (Program, error) {
+	if typeOf(n) == "scalar" {
+		return Program{Scalar: scalarValue(n)}, nil
+	}
+	switch n := n.(type) {
+	case *Call:
+		if n.Func == "histogram_quantile" {
+			target, labels, err := translate(n.Args[1])
+			if err != nil {
+				return Program{}, err
+			}
+			return Program{
+				Target:    target,
+				labels:    labels,
+				histogram: true,
+				quantile:  scalarValue(n.Args[0]),
+			}, nil
+		}
+	case *BinaryExpr:
+		if hasHistogramQuantile(n) {
+			vector, scalar, scalarLHS := n.LHS, n.RHS, false
+			if typeOf(vector) == "scalar" {
+				vector, scalar, scalarLHS = scalar, vector, true
+			}
+			if typeOf(scalar) != "scalar" {
+				return Program{}, errVectorOp
+			}
+			prog, err := Compile(vector)
+			if err != nil {
+				return prog, err
+			}
+			prog.ops = append(prog.ops, scalarOp{n.Op, scalarValue(scalar), scalarLHS})
+			return prog, nil
+		}
+	}
+	target, labels, err := translate(n)
+	return Program{Target: target, labels: labels}, err
+}
+
+var errVectorOp = fmt.Errorf("binary operations are only supported between a vector and a scalar")
+
+func hasHistogramQuantile(n Node) bool {
+	switch n := n.(type) {
+	case *Call:
+		return n.Func == "histogram_quantile"
+	case *BinaryExpr:
+		return hasHistogramQuantile(n.LHS) || hasHistogramQuantile(n.RHS)
+	case *AggregateExpr:
+		return hasHistogramQuantile(n.Expr)
+	}
+	return false
+}
+
+// scalarValue returns the value of a node of type scalar
+func scalarValue(n Node) float64 {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return n.Val
+	case *BinaryExpr:
+		return arithmetic(n.Op, scalarValue(n.LHS), scalarValue(n.RHS))
+	}
+	panic(fmt.Sprintf("scalarValue called on %s", n))
+}
+
+// translate returns the graphite target that computes the given vector
+func translate(n Node) (string, labels, error) {
+	switch n := n.(type) {
+	case *VectorSelector:
+		if n.Range != 0 {
+			return "", labels{}, fmt.Errorf("range vector %s is only supported as argument of rate, irate and increase", n)
+		}
+		target, err := seriesByTag(n)
+		return target, labels{name: true}, err
+	case *Call:
+		return translateCall(n)
+	case *AggregateExpr:
+		return translateAggregate(n)
+	case *BinaryExpr:
+		return translateBinary(n)
+	}
+	return "", labels{}, fmt.Errorf("expected an instant vector, got %s", n)
+}
+
+func seriesByTag(sel *VectorSelector) (string, error) {
+	expressions, err := TagExpressions(sel.Matchers)
+	if err != nil {
+		return "", err
+	}
+	args := make([]string, 0, len(expressions))
+	for _, e := range expressions {
+		arg, err := quote(e)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	return "seriesByTag(" + strings.Join(args, ",") + ")", nil
+}
+
+// quote returns the given string as a graphite string. graphite strings have no escape sequences,
+// so we can only quote strings that don't contain both kinds of quotes.
+func quote(s string) (string, error) {
+	switch {
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", nil
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, nil
+	}
+	return "", fmt.Errorf("unsupported value %s: values can't contain both single and double quotes", s)
+}
+
+// translateCall translates the functions that compute the rate of counters.
+// rate and increase average the rate between the points within the window, rather than extrapolating like prometheus.
+// irate is the rate between the last two points. the rate across a counter reset is null.
+func translateCall(n *Call) (string, labels, error) {
+	if n.Func == "histogram_quantile" {
+		return "", labels{}, fmt.Errorf("histogram_quantile is only supported at the top level of a query, optionally with arithmetic applied to it")
+	}
+	// the parser assures the only arg of the other functions is a range vector
+	sel := *n.Args[0].(*VectorSelector)
+	window := int64(sel.Range / time.Second)
+	if window <= 0 {
+		return "", labels{}, fmt.Errorf("the range of %s must be at least 1s", n)
+	}
+	sel.Range = 0
+	in, err := seriesByTag(&sel)
+	if err != nil {
+		return "", labels{}, err
+	}
+	var target string
+	switch n.Func {
+	case "irate":
+		target = "perSecond(" + in + ")"
+	case "rate":
+		target = fmt.Sprintf("movingAverage(perSecond(%s),'%ds')", in, window)
+	case "increase":
+		target = fmt.Sprintf("scale(movingAverage(perSecond(%s),'%ds'),%d)", in, window, window)
+	}
+	return target, labels{}, nil
+}
+
+func translateAggregate(n *AggregateExpr) (string, labels, error) {
+	in, _, err := translate(n.Expr)
+	if err != nil {
+		return "", labels{}, err
+	}
+	fn := n.Op
+	if fn == "avg" {
+		fn = "average"
+	}
+	if len(n.Grouping) == 0 {
+		return fn + "Series(" + in + ")", labels{aggregated: true}, nil
+	}
+	target := in + ",'" + fn + "'"
+	for _, label := range n.Grouping {
+		if label == "__name__" {
+			label = "name"
+		}
+		target += ",'" + label + "'"
+	}
+	return "groupByTags(" + target + ")", labels{aggregated: true, by: n.Grouping}, nil
+}
+
+// translateBinary translates arithmetic between a vector and a scalar
+func translateBinary(n *BinaryExpr) (string, labels, error) {
+	vector, scalar, scalarLHS := n.LHS, n.RHS, false
+	if typeOf(vector) == "scalar" {
+		vector, scalar, scalarLHS = scalar, vector, true
+	}
+	if typeOf(scalar) != "scalar" {
+		return "", labels{}, errVectorOp
+	}
+	in, labels, err := translate(vector)
+	if err != nil {
+		return "", labels, err
+	}
+	labels.name = false
+	val := scalarValue(scalar)
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return "", labels, fmt.Errorf("arithmetic with the non-finite scalar %s is not supported", number(val))
+	}
+	switch {
+	case n.Op == "+":
+		return "offset(" + in + "," + number(val) + ")", labels, nil
+	case n.Op == "-" && !scalarLHS:
+		return "offset(" + in + "," + number(-val) + ")", labels, nil
+	case n.Op == "-":
+		return "offset(scale(" + in + ",-1)," + number(val) + ")", labels, nil
+	case n.Op == "*":
+		return "scale(" + in + "," + number(val) + ")", labels, nil
+	case n.Op == "/" && !scalarLHS:
+		if val == 0 {
+			return "", labels, fmt.Errorf("division by zero is not supported")
+		}
+		return "scale(" + in + "," + number(1/val) + ")", labels, nil
+	case n.Op == "/":
+		return "scale(invert(" + in + ")," + number(val) + ")", labels, nil
+	case n.Op == "^" && !scalarLHS:
+		return "pow(" + in + "," + number(val) + ")", labels, nil
+	}
+	return "", labels, fmt.Errorf("operator %s with a scalar left hand side and a vector right hand side is not supported", n.Op)
+}
+
+func number(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
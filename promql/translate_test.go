@@ -0,0 +1,68 @@
+package promql
+
+import (
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	cases := []struct {
+		query  string
+		target string
+		err    bool
+	}{
+		{"cpu", "seriesByTag('name=cpu')", false},
+		{`cpu{host=~"web.*",dc!="east"}`, "seriesByTag('name=cpu','host=~^(?:web.*)$','dc!=east')", false},
+		{`{job='it"s'}`, `seriesByTag('job=it"s')`, false},
+		{"irate(x[1m])", "perSecond(seriesByTag('name=x'))", false},
+		{"rate(x[5m])", "movingAverage(perSecond(seriesByTag('name=x')),'300s')", false},
+		{"increase(x[1h])", "scale(movingAverage(perSecond(seriesByTag('name=x')),'3600s'),3600)", false},
+		{"sum(rate(x[1m]))", "sumSeries(movingAverage(perSecond(seriesByTag('name=x')),'60s'))", false},
+		{"avg by (host, __name__) (x)", "groupByTags(seriesByTag('name=x'),'average','host','name')", false},
+		{"x + 1", "offset(seriesByTag('name=x'),1)", false},
+		{"x - 2", "offset(seriesByTag('name=x'),-2)", false},
+		{"10 - x", "offset(scale(seriesByTag('name=x'),-1),10)", false},
+		{"x * 8", "scale(seriesByTag('name=x'),8)", false},
+		{"x / 4", "scale(seriesByTag('name=x'),0.25)", false},
+		{"1 / x", "scale(invert(seriesByTag('name=x')),1)", false},
+		{"x ^ 2", "pow(seriesByTag('name=x'),2)", false},
+		{"histogram_quantile(0.9, rate(x[5m])) * 1000", "movingAverage(perSecond(seriesByTag('name=x')),'300s')", false},
+		{"1 + 1", "", false},
+		{"x + y", "", true},
+		{"2 ^ x", "", true},
+		{"x / 0", "", true},
+		{"x[5m]", "", true},
+		{"rate(x[500ms])", "", true},
+		{"sum(histogram_quantile(0.9, x))", "", true},
+		{`{job=~"("}`, "", true},
+		{`{job="a'b\""}`, "", true},
+	}
+	for _, c := range cases {
+		n, err := Parse(c.query)
+		if err != nil {
+			t.Errorf("query %q: unexpected parse error %s", c.query, err)
+			continue
+		}
+		prog, err := Compile(n)
+		if (err != nil) != c.err {
+			t.Errorf("query %q: expected error %t, got %v", c.query, c.err, err)
+			continue
+		}
+		if prog.Target != c.target {
+			t.Errorf("query %q: expected target %s, got %s", c.query, c.target, prog.Target)
+		}
+	}
+}
+
+func TestCompileScalar(t *testing.T) {
+	n, err := Parse("(1 + 2) * 3 ^ 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Compile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prog.Target != "" || prog.Scalar != 27 {
+		t.Fatalf("expected scalar 27, got %+v", prog)
+	}
+}